@@ -0,0 +1,85 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+
+// Command zapcbor converts logs written by zapcore's CBOR encoder to JSON,
+// one entry per line.
+//
+// Usage:
+//   zapcbor [file...]
+//
+// The files are converted in order and written to standard output. Without
+// any files, zapcbor converts standard input.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [file...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	out := bufio.NewWriter(os.Stdout)
+	ok := do(out, flag.Args())
+	if err := out.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		ok = false
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func do(out io.Writer, paths []string) bool {
+	if len(paths) == 0 {
+		if err := zapcore.CBORToJSON(out, os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "stdin: %v\n", err)
+			return false
+		}
+		return true
+	}
+
+	for _, path := range paths {
+		if err := convert(out, path); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return false
+		}
+	}
+	return true
+}
+
+func convert(out io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return zapcore.CBORToJSON(out, f)
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Command zapverify checks the hash chain in logs written through
+// zapcore.HashChain.
+//
+// Usage:
+//   zapverify [-key-file path] [-prev hex] file...
+//
+// The files are checked in order, as one continuous chain. For each file,
+// zapverify prints the chain value of its last line, or the first line that
+// breaks the chain; it exits with a non-zero status if any file fails.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	keyFile = flag.String("key-file", "", "file holding the HMAC key; a single trailing newline is ignored")
+	prevHex = flag.String("prev", "", "hex-encoded chain value that the first file continues")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-key-file path] [-prev hex] file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if !do(flag.Args()) {
+		os.Exit(1)
+	}
+}
+
+func do(paths []string) bool {
+	var key []byte
+	if *keyFile != "" {
+		var err error
+		if key, err = ioutil.ReadFile(*keyFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+		key = bytes.TrimSuffix(key, []byte{'\n'})
+	}
+	prev, err := hex.DecodeString(*prevHex)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -prev: %v\n", err)
+		return false
+	}
+
+	for _, path := range paths {
+		if prev, err = verify(path, key, prev); err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			return false
+		}
+		fmt.Printf("%s: ok, chain %x\n", path, prev)
+	}
+	return true
+}
+
+func verify(path string, key, prev []byte) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return zapcore.VerifyHashChain(f, key, prev)
+}
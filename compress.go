@@ -0,0 +1,152 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Compression is CPU-bound, so cap the number of files compressed at once
+// across all sinks to keep background work from starving the application.
+const _maxConcurrentCompressions = 2
+
+var _compressionSlots = make(chan struct{}, _maxConcurrentCompressions)
+
+const _compressedSuffix = ".gz"
+
+// backgroundCompressor gzips files in background goroutines, retrying failed
+// attempts with exponential backoff. Failures that persist after all retries
+// are reported to the error output.
+type backgroundCompressor struct {
+	retries int
+	backoff time.Duration
+
+	mu          sync.Mutex
+	errorOutput zapcore.WriteSyncer
+
+	wg sync.WaitGroup
+}
+
+func newBackgroundCompressor() *backgroundCompressor {
+	return &backgroundCompressor{
+		retries:     3,
+		backoff:     100 * time.Millisecond,
+		errorOutput: zapcore.Lock(os.Stderr),
+	}
+}
+
+func (c *backgroundCompressor) setErrorOutput(ws zapcore.WriteSyncer) {
+	c.mu.Lock()
+	c.errorOutput = ws
+	c.mu.Unlock()
+}
+
+// compress gzips the named file to name.gz in the background and removes the
+// original once the compressed copy is safely on disk.
+func (c *backgroundCompressor) compress(name string) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		_compressionSlots <- struct{}{}
+		defer func() { <-_compressionSlots }()
+
+		backoff := c.backoff
+		err := gzipFile(name)
+		for i := 0; err != nil && i < c.retries; i++ {
+			time.Sleep(backoff)
+			backoff *= 2
+			err = gzipFile(name)
+		}
+		if err != nil {
+			c.reportError(fmt.Errorf("can't compress %q: %v", name, err))
+		}
+	}()
+}
+
+func (c *backgroundCompressor) reportError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.errorOutput, "%v compression error: %v\n", time.Now(), err)
+	c.errorOutput.Sync()
+}
+
+// wait blocks until all in-flight compressions finish.
+func (c *backgroundCompressor) wait() {
+	c.wg.Wait()
+}
+
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if os.IsNotExist(err) {
+		// Already compressed or pruned; there's nothing left to do.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary name first so that a crash never leaves behind a
+	// truncated archive that looks complete.
+	tmp := name + _compressedSuffix + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	if err := copyGzip(dst, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, name+_compressedSuffix); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(name)
+}
+
+func copyGzip(dst *os.File, src io.Reader) error {
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return dst.Sync()
+}
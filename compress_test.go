@@ -0,0 +1,104 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func readGzipFile(t testing.TB, name string) string {
+	f, err := os.Open(name)
+	require.NoError(t, err, "Failed to open compressed file.")
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err, "Failed to read gzip header.")
+	contents, err := ioutil.ReadAll(gz)
+	require.NoError(t, err, "Failed to decompress file.")
+	return string(contents)
+}
+
+func TestGzipFile(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		name := filepath.Join(dir, "app.log")
+		require.NoError(t, ioutil.WriteFile(name, []byte("foo\nbar\n"), 0600))
+
+		require.NoError(t, gzipFile(name), "Unexpected error compressing file.")
+		assert.Equal(t, []string{"app.log.gz"}, readDir(t, dir), "Expected only the compressed file to remain.")
+		assert.Equal(t, "foo\nbar\n", readGzipFile(t, name+".gz"), "Unexpected decompressed contents.")
+
+		info, err := os.Stat(name + ".gz")
+		require.NoError(t, err, "Failed to stat compressed file.")
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "Expected compressed file to keep the original's permissions.")
+
+		assert.NoError(t, gzipFile(name), "Expected compressing a missing file to be a no-op.")
+	})
+}
+
+func TestBackgroundCompressor(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		c := newBackgroundCompressor()
+		names := []string{"a.log", "b.log", "c.log", "d.log"}
+		for _, n := range names {
+			require.NoError(t, ioutil.WriteFile(filepath.Join(dir, n), []byte(n), 0644))
+			c.compress(filepath.Join(dir, n))
+		}
+		c.wait()
+
+		assert.Equal(t, []string{"a.log.gz", "b.log.gz", "c.log.gz", "d.log.gz"}, readDir(t, dir), "Unexpected files after compression.")
+		for _, n := range names {
+			assert.Equal(t, n, readGzipFile(t, filepath.Join(dir, n+".gz")), "Unexpected decompressed contents.")
+		}
+	})
+}
+
+func TestBackgroundCompressorReportsErrors(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		name := filepath.Join(dir, "app.log")
+		require.NoError(t, ioutil.WriteFile(name, []byte("foo"), 0644))
+		// Block the temporary file's name so every attempt fails.
+		require.NoError(t, os.Mkdir(name+".gz.tmp", 0755))
+
+		errOut := &bytes.Buffer{}
+		c := newBackgroundCompressor()
+		c.retries = 2
+		c.backoff = time.Millisecond
+		c.setErrorOutput(zapcore.AddSync(errOut))
+		c.compress(name)
+		c.wait()
+
+		assert.Contains(t, errOut.String(), "compression error: can't compress", "Expected the failure to be reported.")
+		assert.Contains(t, errOut.String(), name, "Expected the failure to name the file.")
+		assert.Equal(t, 1, bytes.Count(errOut.Bytes(), []byte("\n")), "Expected retries to be reported only once.")
+		assert.Equal(t, "foo", readFile(t, name), "Expected the original file to survive a failed compression.")
+	})
+}
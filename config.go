@@ -21,10 +21,17 @@
 package zap
 
 import (
+	"context"
+	"errors"
+	"os"
 	"sort"
+	"sync"
+	"syscall"
 	"time"
 
 	"go.uber.org/zap/zapcore"
+
+	"go.uber.org/multierr"
 )
 
 // SamplingConfig sets a sampling strategy for the logger. Sampling caps the
@@ -67,8 +74,9 @@ type Config struct {
 	DisableStacktrace bool `json:"disableStacktrace" yaml:"disableStacktrace"`
 	// Sampling sets a sampling policy. A nil SamplingConfig disables sampling.
 	Sampling *SamplingConfig `json:"sampling" yaml:"sampling"`
-	// Encoding sets the logger's encoding. Valid values are "json" and
-	// "console", as well as any third-party encodings registered via
+	// Encoding sets the logger's encoding. Valid values are "json",
+	// "console", "logfmt", "cbor", "msgpack", "gelf", "ecs", "syslog", and
+	// "journald", as well as any third-party encodings registered via
 	// RegisterEncoder.
 	Encoding string `json:"encoding" yaml:"encoding"`
 	// EncoderConfig sets options for the chosen encoder. See
@@ -106,6 +114,26 @@ func NewProductionEncoderConfig() zapcore.EncoderConfig {
 	}
 }
 
+// NewECSEncoderConfig returns an EncoderConfig for the "ecs" encoder, which
+// writes entries in the Elastic Common Schema. Its keys are the ECS field
+// names, times are ISO8601 strings, and durations are in nanoseconds, as ECS
+// expects.
+func NewECSEncoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		TimeKey:        "@timestamp",
+		LevelKey:       "log.level",
+		NameKey:        "log.logger",
+		CallerKey:      "log.origin",
+		MessageKey:     "message",
+		StacktraceKey:  "error.stack_trace",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.NanosDurationEncoder,
+		EncodeCaller:   zapcore.FullCallerEncoder,
+	}
+}
+
 // NewProductionConfig is a reasonable production logging configuration.
 // Logging is enabled at InfoLevel and above.
 //
@@ -163,15 +191,45 @@ func NewDevelopmentConfig() Config {
 }
 
 // Build constructs a logger from the Config and Options.
+//
+// The sinks the logger writes to stay open, and keep reporting their
+// statistics through AllSinkStats, for the life of the process; use
+// BuildWithClose to release them.
 func (cfg Config) Build(opts ...Option) (*Logger, error) {
-	enc, err := cfg.buildEncoder()
+	log, _, err := cfg.BuildWithClose(opts...)
+	return log, err
+}
+
+// BuildWithClose constructs a logger from the Config and Options, and also
+// returns a function that syncs and closes every sink the logger opened,
+// including those in ErrorOutputPaths. It's safe to call the returned
+// function more than once, but the logger shouldn't be used after the first
+// call. Until then, the sinks report their statistics through AllSinkStats.
+// The close function ignores errors from syncing files that don't support it,
+// like standard output attached to a pipe or terminal.
+func (cfg Config) BuildWithClose(opts ...Option) (*Logger, zapcore.CloseFunc, error) {
+	log, close, err := cfg.BuildWithCloseContext(opts...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	return log, func() error { return close(context.Background()) }, nil
+}
 
-	sink, errSink, err := cfg.openSinks()
+// BuildWithCloseContext is like BuildWithClose, but the returned function
+// stops waiting for sinks to sync and close once ctx is done, which bounds
+// how long shutdown waits on a hung destination. Sinks that implement
+// ContextCloser are closed with ctx; others are abandoned, and keep closing
+// in the background. Only the first call's ctx is used.
+func (cfg Config) BuildWithCloseContext(opts ...Option) (*Logger, func(context.Context) error, error) {
+	sink, errSink, syslogOpts, close, err := cfg.openSinks()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	enc, err := cfg.buildEncoder(syslogOpts)
+	if err != nil {
+		close(context.Background())
+		return nil, nil, err
 	}
 
 	log := New(
@@ -181,7 +239,7 @@ func (cfg Config) Build(opts ...Option) (*Logger, error) {
 	if len(opts) > 0 {
 		log = log.WithOptions(opts...)
 	}
-	return log, nil
+	return log, close, nil
 }
 
 func (cfg Config) buildOptions(errSink zapcore.WriteSyncer) []Option {
@@ -225,19 +283,86 @@ func (cfg Config) buildOptions(errSink zapcore.WriteSyncer) []Option {
 	return opts
 }
 
-func (cfg Config) openSinks() (zapcore.WriteSyncer, zapcore.WriteSyncer, error) {
-	sink, closeOut, err := Open(cfg.OutputPaths...)
+func (cfg Config) openSinks() (zapcore.WriteSyncer, zapcore.WriteSyncer, *zapcore.SyslogOptions, func(context.Context) error, error) {
+	writers, closeOut, err := open(cfg.OutputPaths)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, nil, err
 	}
-	errSink, _, err := Open(cfg.ErrorOutputPaths...)
+	syslogOpts, err := syslogOptions(writers)
 	if err != nil {
-		closeOut()
-		return nil, nil, err
+		closeOut(context.Background())
+		return nil, nil, nil, nil, err
+	}
+	errWriters, closeErrOut, err := open(cfg.ErrorOutputPaths)
+	if err != nil {
+		closeOut(context.Background())
+		return nil, nil, nil, nil, err
+	}
+	sink := CombineWriteSyncers(writers...)
+	errSink := CombineWriteSyncers(errWriters...)
+	for _, w := range writers {
+		if r, ok := w.(errorReporter); ok {
+			r.setErrorOutput(errSink)
+		}
+	}
+
+	var (
+		once     sync.Once
+		closeErr error
+	)
+	close := func(ctx context.Context) error {
+		once.Do(func() {
+			// Close the error output last, so that it can report problems
+			// closing the other sinks.
+			closeErr = multierr.Combine(
+				ignoreUnsupportedSync(zapcore.SyncContext(ctx, sink)),
+				closeOut(ctx),
+				ignoreUnsupportedSync(zapcore.SyncContext(ctx, errSink)),
+				closeErrOut(ctx),
+			)
+		})
+		return closeErr
+	}
+	return sink, errSink, syslogOpts, close, nil
+}
+
+// ignoreUnsupportedSync drops the errors returned by syncing files that don't
+// support it, like the pipes and terminals that standard output and standard
+// error usually are, so that they don't fail BuildWithClose's close function.
+func ignoreUnsupportedSync(err error) error {
+	var kept error
+	for _, e := range multierr.Errors(err) {
+		if pe, ok := e.(*os.PathError); ok && (pe.Err == syscall.EINVAL || pe.Err == syscall.ENOTSUP) {
+			continue
+		}
+		kept = multierr.Append(kept, e)
 	}
-	return sink, errSink, nil
+	return kept
 }
 
-func (cfg Config) buildEncoder() (zapcore.Encoder, error) {
+// syslogOptions returns the options of the syslog sinks among the writers,
+// or nil if there aren't any. Since the sinks share an encoder, their options
+// must match.
+func syslogOptions(writers []zapcore.WriteSyncer) (*zapcore.SyslogOptions, error) {
+	var opts *zapcore.SyslogOptions
+	for _, w := range writers {
+		o, ok := sinkSyslogOptions(w)
+		if !ok {
+			continue
+		}
+		if opts != nil && o != *opts {
+			return nil, errors.New("syslog sinks with different options can't share an encoder")
+		}
+		opts = &o
+	}
+	return opts, nil
+}
+
+// buildEncoder builds the encoder named by the Config. The "syslog" encoder
+// uses the options of the logger's syslog sinks, if it has any.
+func (cfg Config) buildEncoder(syslogOpts *zapcore.SyslogOptions) (zapcore.Encoder, error) {
+	if cfg.Encoding == "syslog" && syslogOpts != nil {
+		return zapcore.NewSyslogEncoderWithOptions(cfg.EncoderConfig, *syslogOpts)
+	}
 	return newEncoder(cfg.Encoding, cfg.EncoderConfig)
 }
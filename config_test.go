@@ -21,12 +21,21 @@
 package zap
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/zapcore"
+
+	"go.uber.org/multierr"
 )
 
 func TestConfig(t *testing.T) {
@@ -52,6 +61,18 @@ func TestConfig(t *testing.T) {
 				"WARN\tzap/config_test.go:" + `\d+` + "\twarn\t" + `{"k": "v", "z": "zz"}` + "\n" +
 				`testing.\w+`,
 		},
+		{
+			desc: "ecs",
+			cfg: func() Config {
+				cfg := NewProductionConfig()
+				cfg.Encoding = "ecs"
+				cfg.EncoderConfig = NewECSEncoderConfig()
+				return cfg
+			}(),
+			expectN: 2 + 100 + 1,
+			expectRe: `{"log.level":"info","message":"info","ecs.version":"1.6.0","log":{"origin":{"file":{"name":"[^"]*zap/config_test.go","line":\d+},"function":"[^"]+"}},"k":"v","z":"zz"}` + "\n" +
+				`{"log.level":"warn","message":"warn","ecs.version":"1.6.0","log":{"origin":{"file":{"name":"[^"]*zap/config_test.go","line":\d+},"function":"[^"]+"}},"k":"v","z":"zz"}` + "\n",
+		},
 	}
 
 	for _, tt := range tests {
@@ -106,3 +127,150 @@ func TestConfigWithInvalidPaths(t *testing.T) {
 		})
 	}
 }
+
+type reportingSink struct {
+	nopCloserSink
+	errorOutput zapcore.WriteSyncer
+}
+
+func (s *reportingSink) setErrorOutput(ws zapcore.WriteSyncer) {
+	s.errorOutput = ws
+}
+
+func TestConfigWiresErrorReporters(t *testing.T) {
+	defer resetSinkRegistry()
+
+	sink := &reportingSink{nopCloserSink: nopCloserSink{zapcore.AddSync(&bytes.Buffer{})}}
+	require.NoError(t, RegisterSink("reporting", func(*url.URL) (Sink, error) {
+		return sink, nil
+	}), "Failed to register sink factory.")
+
+	errPath := tempFileName("", "zap-config-errors")
+	defer os.Remove(errPath)
+
+	cfg := NewProductionConfig()
+	cfg.OutputPaths = []string{"reporting://somewhere"}
+	cfg.ErrorOutputPaths = []string{errPath}
+	_, err := cfg.Build()
+	require.NoError(t, err, "Unexpected error building logger.")
+
+	require.NotNil(t, sink.errorOutput, "Expected the sink to receive the logger's error output.")
+	sink.errorOutput.Write([]byte("background failure\n"))
+	assert.Equal(t, "background failure\n", readFile(t, errPath), "Expected sink errors to reach ErrorOutputPaths.")
+}
+
+type recordingSink struct {
+	name  string
+	calls *[]string
+}
+
+func (s *recordingSink) Write(p []byte) (int, error) { return len(p), nil }
+
+func (s *recordingSink) Sync() error {
+	*s.calls = append(*s.calls, "sync "+s.name)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	*s.calls = append(*s.calls, "close "+s.name)
+	return errors.New("close failed: " + s.name)
+}
+
+func TestConfigBuildWithClose(t *testing.T) {
+	defer resetSinkRegistry()
+
+	var calls []string
+	require.NoError(t, RegisterSink("recording", func(u *url.URL) (Sink, error) {
+		return &recordingSink{name: u.Host, calls: &calls}, nil
+	}), "Failed to register sink factory.")
+
+	cfg := NewProductionConfig()
+	cfg.OutputPaths = []string{"recording://out"}
+	cfg.ErrorOutputPaths = []string{"recording://err"}
+	logger, close, err := cfg.BuildWithClose()
+	require.NoError(t, err, "Unexpected error building logger.")
+	logger.Info("hello")
+
+	err = close()
+	assert.Equal(t, []string{"sync out", "close out", "sync err", "close err"}, calls, "Expected output sinks to be closed before the error output.")
+	if assert.Error(t, err, "Expected errors closing sinks to be returned.") {
+		assert.Contains(t, err.Error(), "close failed: out", "Expected the output sink's error.")
+		assert.Contains(t, err.Error(), "close failed: err", "Expected the error output's error.")
+	}
+
+	assert.Equal(t, err, close(), "Expected closing again to return the same error.")
+	assert.Len(t, calls, 4, "Expected sinks to be closed only once.")
+}
+
+// stalledSink is a Sink whose Close blocks until it's released.
+type stalledSink struct {
+	zapcore.WriteSyncer
+	release chan struct{}
+}
+
+func (s stalledSink) Close() error {
+	<-s.release
+	return nil
+}
+
+func TestConfigBuildWithCloseContext(t *testing.T) {
+	defer resetSinkRegistry()
+
+	release := make(chan struct{})
+	defer close(release)
+	require.NoError(t, RegisterSink("stalled", func(*url.URL) (Sink, error) {
+		return stalledSink{zapcore.AddSync(ioutil.Discard), release}, nil
+	}), "Failed to register sink factory.")
+
+	cfg := NewProductionConfig()
+	cfg.OutputPaths = []string{"stalled://out"}
+	cfg.ErrorOutputPaths = []string{"stderr"}
+	logger, closeLogger, err := cfg.BuildWithCloseContext()
+	require.NoError(t, err, "Unexpected error building logger.")
+	logger.Info("hello")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = closeLogger(ctx)
+	assert.Contains(t, multierr.Errors(err), context.DeadlineExceeded, "Expected the deadline's error.")
+	assert.True(t, time.Since(start) < time.Second, "Expected close to return once the deadline passed.")
+}
+
+func TestConfigBuildWithCloseStdout(t *testing.T) {
+	cfg := NewProductionConfig()
+	cfg.OutputPaths = []string{"stdout"}
+	cfg.ErrorOutputPaths = []string{"stderr"}
+	_, close, err := cfg.BuildWithClose()
+	require.NoError(t, err, "Unexpected error building logger.")
+	assert.NoError(t, close(), "Expected closing standard output and error to succeed.")
+}
+
+func TestIgnoreUnsupportedSync(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err, "Failed to create pipe.")
+	defer r.Close()
+	defer w.Close()
+
+	pipeErr := w.Sync()
+	require.Error(t, pipeErr, "Expected syncing a pipe to fail.")
+	assert.NoError(t, ignoreUnsupportedSync(pipeErr), "Expected errors syncing a pipe to be ignored.")
+
+	failed := errors.New("failed")
+	assert.Equal(
+		t,
+		failed,
+		ignoreUnsupportedSync(multierr.Append(pipeErr, failed)),
+		"Expected other errors to be kept.",
+	)
+	assert.Error(t, zapcore.AddSync(w).Sync(), "Expected Sync to keep failing outside BuildWithClose.")
+}
+
+func TestConfigBuildWithCloseFailure(t *testing.T) {
+	cfg := NewProductionConfig()
+	cfg.OutputPaths = []string{"/tmp/not-there/foo.log"}
+	logger, close, err := cfg.BuildWithClose()
+	assert.Error(t, err, "Expected an error opening a non-existent directory.")
+	assert.Nil(t, logger, "Expected no logger on failure.")
+	assert.Nil(t, close, "Expected no close function on failure.")
+}
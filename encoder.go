@@ -38,12 +38,34 @@ var (
 		"json": func(encoderConfig zapcore.EncoderConfig) (zapcore.Encoder, error) {
 			return zapcore.NewJSONEncoder(encoderConfig), nil
 		},
+		"journald": func(encoderConfig zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return zapcore.NewJournaldEncoder(encoderConfig), nil
+		},
+		"syslog": func(encoderConfig zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return zapcore.NewSyslogEncoder(encoderConfig), nil
+		},
+		"logfmt": func(encoderConfig zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return zapcore.NewLogfmtEncoder(encoderConfig), nil
+		},
+		"cbor": func(encoderConfig zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return zapcore.NewCBOREncoder(encoderConfig), nil
+		},
+		"msgpack": func(encoderConfig zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return zapcore.NewMsgpackEncoder(encoderConfig), nil
+		},
+		"gelf": func(encoderConfig zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return zapcore.NewGELFEncoder(encoderConfig), nil
+		},
+		"ecs": func(encoderConfig zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return zapcore.NewECSEncoder(encoderConfig), nil
+		},
 	}
 	_encoderMutex sync.RWMutex
 )
 
 // RegisterEncoder registers an encoder constructor, which the Config struct
-// can then reference. By default, the "json" and "console" encoders are
+// can then reference. By default, the "json", "console", "logfmt", "cbor",
+// "msgpack", "gelf", "ecs", "syslog", and "journald" encoders are
 // registered.
 //
 // Attempting to register an encoder whose name is already taken returns an
@@ -29,7 +29,7 @@ import (
 )
 
 func TestRegisterDefaultEncoders(t *testing.T) {
-	testEncodersRegistered(t, "console", "json")
+	testEncodersRegistered(t, "cbor", "console", "ecs", "gelf", "journald", "json", "logfmt", "msgpack", "syslog")
 }
 
 func TestRegisterEncoder(t *testing.T) {
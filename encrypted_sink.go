@@ -0,0 +1,310 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Each encrypted segment starts with a header holding a magic number, the
+// length of the sealed data that follows the nonce, and the nonce.
+const (
+	_encryptedMagic            = "ZEN1"
+	_encryptedSegmentSize      = 64 * 1024 // plaintext bytes
+	_maxEncryptedSegmentLength = 1 << 24   // sealed bytes accepted when reading
+	_encryptedNonceSize        = 12
+	_encryptedHeaderSize       = len(_encryptedMagic) + 4 + _encryptedNonceSize
+)
+
+type encryptedSink struct {
+	mu   sync.Mutex
+	sink Sink
+	aead cipher.AEAD
+	buf  []byte // plaintext that hasn't been sealed yet
+	out  []byte // scratch space for sealed segments
+}
+
+// NewEncryptedSink wraps a Sink so that everything written to it is
+// encrypted with AES-GCM under key, which must be 16, 24, or 32 bytes long.
+//
+// Output is buffered and sealed in segments: whenever the sink is synced or
+// closed, and whenever 64kB of output accumulates. Each segment has its own
+// random nonce and authentication tag, so files may be appended to by more
+// than one encrypted sink. Since nothing reaches the wrapped Sink until a
+// segment is sealed, callers should sync the sink periodically. Use
+// NewDecryptingReader to read the output back; it skips damaged segments and
+// carries on with the intact ones after them.
+//
+// Because segments are independent, removing or reordering whole segments
+// isn't detected. Random nonces also limit each key to about four billion
+// segments, so keys should be rotated long before then.
+func NewEncryptedSink(sink Sink, key []byte) (Sink, error) {
+	aead, err := newEncryptionAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedSink{
+		sink: sink,
+		aead: aead,
+		buf:  make([]byte, 0, _encryptedSegmentSize),
+	}, nil
+}
+
+func newEncryptionAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *encryptedSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n := 0; n < len(p); {
+		free := _encryptedSegmentSize - len(s.buf)
+		if free > len(p)-n {
+			free = len(p) - n
+		}
+		s.buf = append(s.buf, p[n:n+free]...)
+		n += free
+		if len(s.buf) == _encryptedSegmentSize {
+			if err := s.seal(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (s *encryptedSink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.seal(); err != nil {
+		return err
+	}
+	return s.sink.Sync()
+}
+
+func (s *encryptedSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.seal()
+	if closeErr := s.sink.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// seal encrypts any buffered output as a single segment and writes it to the
+// wrapped Sink. The plaintext is discarded even if the write fails, since
+// retrying could duplicate a partially-written segment. Callers must hold the
+// lock.
+func (s *encryptedSink) seal() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	defer func() { s.buf = s.buf[:0] }()
+
+	sealedLen := len(s.buf) + s.aead.Overhead()
+	if need := _encryptedHeaderSize + sealedLen; cap(s.out) < need {
+		s.out = make([]byte, 0, need)
+	}
+	header := s.out[:_encryptedHeaderSize]
+	copy(header, _encryptedMagic)
+	binary.BigEndian.PutUint32(header[len(_encryptedMagic):], uint32(sealedLen))
+	nonce := header[len(_encryptedMagic)+4:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("can't generate nonce: %v", err)
+	}
+
+	// Authenticate the magic number and length along with the output.
+	segment := s.aead.Seal(header, nonce, s.buf, header[:len(_encryptedMagic)+4])
+	_, err := s.sink.Write(segment)
+	return err
+}
+
+type decryptingReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	buf    []byte // scratch space for input
+	data   []byte // buffered input that hasn't been decrypted yet
+	offset int64  // of the start of data
+	out    []byte // scratch space for plaintext
+	plain  []byte // decrypted but unread
+	damage error  // describes the first damaged segment
+	err    error
+}
+
+// A segmentError describes input that isn't an intact encrypted segment.
+type segmentError struct{ error }
+
+// NewDecryptingReader returns a Reader that decrypts output written by
+// NewEncryptedSink with the same key. Damaged input is skipped, and reading
+// resumes at the next segment header. Once the input is exhausted, reads fail
+// with an error describing the first damaged segment instead of returning
+// io.EOF; if the input ends partway through a segment, that error is
+// io.ErrUnexpectedEOF.
+func NewDecryptingReader(r io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newEncryptionAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingReader{
+		r:    r,
+		aead: aead,
+		buf:  make([]byte, _encryptedHeaderSize+_encryptedSegmentSize+aead.Overhead()),
+	}, nil
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.plain, d.err = d.next()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next decrypts the next intact segment, skipping any damaged input before
+// it.
+func (d *decryptingReader) next() ([]byte, error) {
+	for {
+		plain, err := d.segment()
+		if err == nil {
+			return plain, nil
+		}
+		damage, ok := err.(segmentError)
+		if !ok {
+			return nil, d.end(err)
+		}
+		if d.damage == nil {
+			d.damage = damage.error
+		}
+		if err := d.skip(); err != nil {
+			return nil, d.end(err)
+		}
+	}
+}
+
+// end returns the error to report once reading stops because of err.
+func (d *decryptingReader) end(err error) error {
+	if err == io.EOF && d.damage != nil {
+		return d.damage
+	}
+	return err
+}
+
+// segment decrypts the segment at the start of the buffered input.
+func (d *decryptingReader) segment() ([]byte, error) {
+	if err := d.fill(_encryptedHeaderSize); err != nil {
+		return nil, d.truncated(err)
+	}
+	header := d.data[:_encryptedHeaderSize]
+	if string(header[:len(_encryptedMagic)]) != _encryptedMagic {
+		return nil, segmentError{fmt.Errorf("no encrypted segment at offset %d", d.offset)}
+	}
+	sealedLen := int(binary.BigEndian.Uint32(header[len(_encryptedMagic):]))
+	if sealedLen < d.aead.Overhead() || sealedLen > _maxEncryptedSegmentLength {
+		return nil, segmentError{fmt.Errorf("invalid length %d for encrypted segment at offset %d", sealedLen, d.offset)}
+	}
+	if err := d.fill(_encryptedHeaderSize + sealedLen); err != nil {
+		return nil, d.truncated(err)
+	}
+
+	// Decrypt into separate space, since the sealed data may hold the start of
+	// the next intact segment if this one turns out to be damaged.
+	header = d.data[:_encryptedHeaderSize]
+	nonce := header[len(_encryptedMagic)+4:]
+	sealed := d.data[_encryptedHeaderSize : _encryptedHeaderSize+sealedLen]
+	plain, err := d.aead.Open(d.out[:0], nonce, sealed, header[:len(_encryptedMagic)+4])
+	if err != nil {
+		return nil, segmentError{fmt.Errorf("can't decrypt segment at offset %d: %v", d.offset, err)}
+	}
+	d.out = plain
+	d.consume(_encryptedHeaderSize + sealedLen)
+	return plain, nil
+}
+
+// truncated treats the end of the input partway through a segment as damage.
+func (d *decryptingReader) truncated(err error) error {
+	if err == io.EOF && len(d.data) > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == io.ErrUnexpectedEOF {
+		return segmentError{err}
+	}
+	return err
+}
+
+// skip discards buffered input up to the next magic number after the start
+// of a damaged segment.
+func (d *decryptingReader) skip() error {
+	d.consume(1)
+	for {
+		if i := bytes.Index(d.data, []byte(_encryptedMagic)); i >= 0 {
+			d.consume(i)
+			return nil
+		}
+		// Keep anything that could be the start of a magic number.
+		if keep := len(_encryptedMagic) - 1; len(d.data) > keep {
+			d.consume(len(d.data) - keep)
+		}
+		if err := d.fill(len(d.data) + 1); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return err
+		}
+	}
+}
+
+// fill reads until at least n bytes of input are buffered.
+func (d *decryptingReader) fill(n int) error {
+	if len(d.data) >= n {
+		return nil
+	}
+	if len(d.buf) < n {
+		d.buf = make([]byte, n)
+	}
+	d.data = d.buf[:copy(d.buf, d.data)]
+	read, err := io.ReadAtLeast(d.r, d.buf[len(d.data):], n-len(d.data))
+	d.data = d.buf[:len(d.data)+read]
+	return err
+}
+
+func (d *decryptingReader) consume(n int) {
+	d.data = d.data[n:]
+	d.offset += int64(n)
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/internal/ztest"
+	"go.uber.org/zap/zapcore"
+)
+
+var _testEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+// bufferSink is a Sink that records whether it's been closed.
+type bufferSink struct {
+	ztest.Buffer
+	closed bool
+}
+
+func (s *bufferSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func decryptAll(t testing.TB, data, key []byte) (string, error) {
+	r, err := NewDecryptingReader(bytes.NewReader(data), key)
+	require.NoError(t, err, "Failed to create decrypting reader.")
+	plain, err := ioutil.ReadAll(r)
+	return string(plain), err
+}
+
+func TestEncryptedSinkRoundTrip(t *testing.T) {
+	out := &bufferSink{}
+	sink, err := NewEncryptedSink(out, _testEncryptionKey)
+	require.NoError(t, err, "Failed to create encrypted sink.")
+
+	sink.Write([]byte("foo\n"))
+	assert.Equal(t, 0, len(out.Bytes()), "Expected output to be buffered until Sync.")
+	require.NoError(t, sink.Sync(), "Unexpected error syncing.")
+	assert.True(t, out.Called(), "Expected Sync to sync the wrapped sink.")
+	assert.False(t, bytes.Contains(out.Bytes(), []byte("foo")), "Expected output to be encrypted.")
+	first := len(out.Bytes())
+
+	sink.Write([]byte("bar\n"))
+	require.NoError(t, sink.Close(), "Unexpected error closing.")
+	assert.True(t, out.closed, "Expected Close to close the wrapped sink.")
+
+	plain, err := decryptAll(t, out.Bytes(), _testEncryptionKey)
+	require.NoError(t, err, "Unexpected error decrypting.")
+	assert.Equal(t, "foo\nbar\n", plain, "Unexpected plaintext.")
+
+	plain, err = decryptAll(t, out.Bytes()[first:], _testEncryptionKey)
+	require.NoError(t, err, "Expected segments to decrypt independently.")
+	assert.Equal(t, "bar\n", plain, "Unexpected plaintext of the second segment.")
+}
+
+func TestEncryptedSinkLargeWrites(t *testing.T) {
+	out := &bufferSink{}
+	sink, err := NewEncryptedSink(out, _testEncryptionKey[:16])
+	require.NoError(t, err, "Failed to create encrypted sink.")
+
+	big := strings.Repeat("x", 3*_encryptedSegmentSize/2)
+	n, err := sink.Write([]byte(big))
+	require.NoError(t, err, "Unexpected error writing.")
+	assert.Equal(t, len(big), n, "Unexpected number of bytes written.")
+	assert.Equal(t, _encryptedHeaderSize+_encryptedSegmentSize+16, len(out.Bytes()), "Expected a full segment to be sealed immediately.")
+	require.NoError(t, sink.Close(), "Unexpected error closing.")
+
+	plain, err := decryptAll(t, out.Bytes(), _testEncryptionKey[:16])
+	require.NoError(t, err, "Unexpected error decrypting.")
+	assert.Equal(t, big, plain, "Unexpected plaintext.")
+}
+
+func TestEncryptedSinkErrors(t *testing.T) {
+	_, err := NewEncryptedSink(&bufferSink{}, []byte("short"))
+	assert.Error(t, err, "Expected an error with an invalid key.")
+	_, err = NewDecryptingReader(&bytes.Buffer{}, []byte("short"))
+	assert.Error(t, err, "Expected an error with an invalid key.")
+
+	sink, err := NewEncryptedSink(nopCloserSink{zapcore.AddSync(&ztest.FailWriter{})}, _testEncryptionKey)
+	require.NoError(t, err, "Failed to create encrypted sink.")
+	sink.Write([]byte("foo"))
+	assert.Error(t, sink.Sync(), "Expected write errors to propagate.")
+
+	failing := &bufferSink{}
+	failing.SetError(errors.New("fail"))
+	sink, err = NewEncryptedSink(failing, _testEncryptionKey)
+	require.NoError(t, err, "Failed to create encrypted sink.")
+	assert.Error(t, sink.Sync(), "Expected sync errors to propagate.")
+}
+
+func TestDecryptingReaderErrors(t *testing.T) {
+	out := &bufferSink{}
+	sink, err := NewEncryptedSink(out, _testEncryptionKey)
+	require.NoError(t, err, "Failed to create encrypted sink.")
+	sink.Write([]byte("foo\n"))
+	sink.Sync()
+	sink.Write([]byte("bar\n"))
+	sink.Sync()
+	data := out.Bytes()
+
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-1] ^= 1
+	plain, err := decryptAll(t, tampered, _testEncryptionKey)
+	assert.Equal(t, "foo\n", plain, "Expected segments before the damage to decrypt.")
+	assert.EqualError(t, err, "can't decrypt segment at offset 40: cipher: message authentication failed", "Unexpected error.")
+
+	tampered = append([]byte(nil), data...)
+	tampered[39] ^= 1
+	plain, err = decryptAll(t, tampered, _testEncryptionKey)
+	assert.Equal(t, "bar\n", plain, "Expected segments after the damage to decrypt.")
+	assert.EqualError(t, err, "can't decrypt segment at offset 0: cipher: message authentication failed", "Unexpected error.")
+
+	_, err = decryptAll(t, data, []byte("fedcba9876543210fedcba9876543210"))
+	assert.Error(t, err, "Expected an error with the wrong key.")
+
+	_, err = decryptAll(t, data[:len(data)-1], _testEncryptionKey)
+	assert.Equal(t, io.ErrUnexpectedEOF, err, "Expected an error from a truncated segment.")
+
+	_, err = decryptAll(t, []byte("not encrypted at all"), _testEncryptionKey)
+	assert.EqualError(t, err, "no encrypted segment at offset 0", "Unexpected error.")
+}
+
+func TestDecryptingReaderResynchronizes(t *testing.T) {
+	out := &bufferSink{}
+	sink, err := NewEncryptedSink(out, _testEncryptionKey)
+	require.NoError(t, err, "Failed to create encrypted sink.")
+	var offsets []int
+	for _, s := range []string{"foo\n", "bar\n", "baz\n"} {
+		offsets = append(offsets, len(out.Bytes()))
+		sink.Write([]byte(s))
+		sink.Sync()
+	}
+	data := out.Bytes()
+	middle := data[offsets[1]:offsets[2]]
+
+	corrupt := func(f func([]byte) []byte) []byte {
+		damaged := f(append([]byte(nil), middle...))
+		return append(append(append([]byte(nil), data[:offsets[1]]...), damaged...), data[offsets[2]:]...)
+	}
+
+	tests := []struct {
+		desc  string
+		data  []byte
+		plain string
+		err   string
+	}{
+		{
+			desc: "tampered ciphertext",
+			data: corrupt(func(b []byte) []byte {
+				b[len(b)-1] ^= 1
+				return b
+			}),
+			err: "can't decrypt segment at offset 40: cipher: message authentication failed",
+		},
+		{
+			desc: "invalid length",
+			data: corrupt(func(b []byte) []byte {
+				b[4] = 0xff
+				return b
+			}),
+			err: "invalid length 4278190100 for encrypted segment at offset 40",
+		},
+		{
+			desc: "length past the end of the input",
+			data: corrupt(func(b []byte) []byte {
+				b[5] = 0x10
+				return b
+			}),
+			err: io.ErrUnexpectedEOF.Error(),
+		},
+		{
+			desc: "damaged magic number",
+			data: corrupt(func(b []byte) []byte {
+				b[0] = 'z'
+				return b
+			}),
+			err: "no encrypted segment at offset 40",
+		},
+		{
+			desc: "truncated segment",
+			data: corrupt(func(b []byte) []byte { return b[:len(b)/2] }),
+			err:  "can't decrypt segment at offset 40: cipher: message authentication failed",
+		},
+		{
+			desc:  "garbage between segments",
+			data:  corrupt(func(b []byte) []byte { return append([]byte("ZEN"), b...) }),
+			plain: "foo\nbar\nbaz\n",
+			err:   "no encrypted segment at offset 40",
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.plain == "" {
+			tt.plain = "foo\nbaz\n"
+		}
+		plain, err := decryptAll(t, tt.data, _testEncryptionKey)
+		assert.Equal(t, tt.plain, plain, "%s: expected the intact segments to decrypt.", tt.desc)
+		assert.EqualError(t, err, tt.err, "%s: unexpected error.", tt.desc)
+	}
+
+	plain, err := decryptAll(t, data, _testEncryptionKey)
+	require.NoError(t, err, "Unexpected error decrypting intact input.")
+	assert.Equal(t, "foo\nbar\nbaz\n", plain, "Unexpected plaintext.")
+}
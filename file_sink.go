@@ -0,0 +1,300 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const _defaultFileMode os.FileMode = 0644
+
+// fsyncPolicy controls when a fileSink flushes its file to stable storage.
+type fsyncPolicy int
+
+const (
+	fsyncOnSync fsyncPolicy = iota
+	fsyncAlways
+	fsyncInterval
+	fsyncNever
+)
+
+// fileOptions configures a fileSink. Its zero value isn't useful; start with
+// defaultFileOptions.
+type fileOptions struct {
+	mode          os.FileMode
+	mkdir         bool
+	fsync         fsyncPolicy
+	fsyncInterval time.Duration
+	utc           bool // expand path templates in UTC rather than local time
+}
+
+func defaultFileOptions() fileOptions {
+	return fileOptions{
+		mode:          _defaultFileMode,
+		fsyncInterval: time.Second,
+	}
+}
+
+// setOption applies a URL query parameter to the options.
+func (o *fileOptions) setOption(key, val string) error {
+	var err error
+	switch key {
+	case "mode":
+		var mode uint64
+		mode, err = strconv.ParseUint(val, 8, 32)
+		if err == nil && mode > 0777 {
+			err = fmt.Errorf("must be an octal permission like 0600, got %q", val)
+		}
+		o.mode = os.FileMode(mode)
+	case "mkdir":
+		o.mkdir, err = strconv.ParseBool(val)
+	case "fsync":
+		switch val {
+		case "sync":
+			o.fsync = fsyncOnSync
+		case "always":
+			o.fsync = fsyncAlways
+		case "interval":
+			o.fsync = fsyncInterval
+		case "never":
+			o.fsync = fsyncNever
+		default:
+			err = fmt.Errorf(`must be "sync", "always", "interval", or "never", got %q`, val)
+		}
+	case "fsyncInterval":
+		o.fsyncInterval, err = parsePositiveDuration(val)
+	case "utc":
+		o.utc, err = strconv.ParseBool(val)
+	default:
+		err = errors.New("unknown parameter")
+	}
+	return err
+}
+
+// open opens (or creates) the file at path for appending.
+func (o fileOptions) open(path string) (*os.File, error) {
+	if o.mkdir {
+		// Let anyone who can read files also list the directory.
+		dirMode := o.mode | (o.mode&0444)>>2
+		if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+			return nil, err
+		}
+	}
+	return openLogFile(path, o.mode)
+}
+
+// fileSink is a Sink that writes to a file on the local filesystem. Unlike a
+// bare *os.File, it can close and reopen its path, which lets external tools
+// like logrotate move the file aside and signal the process to start a new
+// one.
+//
+// If its path is a template, like /var/log/app-{date}.log, the sink checks
+// the expanded path at most once a second and switches to a new file when it
+// changes.
+//
+// It's safe for concurrent use.
+type fileSink struct {
+	mu   sync.Mutex
+	path string // expanded, if there's a template
+	opts fileOptions
+	file *os.File
+
+	template *pathTemplate // nil if path has no placeholders
+	now      func() time.Time
+	checked  int64 // Unix time when the template was last expanded
+
+	// Used only with the interval fsync policy.
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	errMu       sync.Mutex
+	errorOutput zapcore.WriteSyncer
+}
+
+func openFileSink(path string, opts fileOptions) (*fileSink, error) {
+	template, err := parsePathTemplate(path, opts.utc)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now
+	if template != nil {
+		path = template.expand(now())
+	}
+	f, err := opts.open(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &fileSink{
+		path:        path,
+		opts:        opts,
+		file:        f,
+		template:    template,
+		now:         now,
+		checked:     now().Unix(),
+		errorOutput: zapcore.Lock(os.Stderr),
+	}
+	if opts.fsync == fsyncInterval {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.fsyncLoop()
+	}
+	trackReopener(s)
+	return s, nil
+}
+
+func openLogFile(path string, mode os.FileMode) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, mode)
+}
+
+func (s *fileSink) setErrorOutput(ws zapcore.WriteSyncer) {
+	s.errMu.Lock()
+	s.errorOutput = ws
+	s.errMu.Unlock()
+}
+
+func (s *fileSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return 0, errors.New("write to closed file sink")
+	}
+	if s.template != nil {
+		s.rollover()
+	}
+	n, err := s.file.Write(p)
+	if err == nil && s.opts.fsync == fsyncAlways {
+		err = s.file.Sync()
+	}
+	return n, err
+}
+
+func (s *fileSink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil || s.opts.fsync == fsyncNever {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+func (s *fileSink) Close() error {
+	untrackReopener(s)
+	if s.stop != nil {
+		s.stopOnce.Do(func() { close(s.stop) })
+		<-s.done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Reopen closes the current file and reopens the sink's path, creating it if
+// necessary. Writes are held off until the new file is in place; if the path
+// can't be opened, the sink keeps writing to the old file.
+func (s *fileSink) Reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	f, err := s.opts.open(s.path)
+	if err != nil {
+		return err
+	}
+	old := s.file
+	s.file = f
+	return old.Close()
+}
+
+// rollover switches to a new file if the path template's expansion has
+// changed. If the new file can't be opened, the error is reported and writes
+// continue to the old file. Callers must hold the lock.
+func (s *fileSink) rollover() {
+	now := s.now()
+	if now.Unix() == s.checked {
+		return
+	}
+	s.checked = now.Unix()
+
+	path := s.template.expand(now)
+	if path == s.path {
+		return
+	}
+	f, err := s.opts.open(path)
+	if err != nil {
+		s.reportError("rollover", fmt.Errorf("can't open %q: %v", path, err))
+		return
+	}
+	old := s.file
+	s.file = f
+	s.path = path
+	if s.opts.fsync != fsyncNever {
+		if err := old.Sync(); err != nil {
+			s.reportError("fsync", err)
+		}
+	}
+	if err := old.Close(); err != nil {
+		s.reportError("rollover", err)
+	}
+}
+
+func (s *fileSink) fsyncLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.fsyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Sync(); err != nil {
+				s.reportError("fsync", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *fileSink) reportError(op string, err error) {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	fmt.Fprintf(s.errorOutput, "%v %s error: %v\n", time.Now(), op, err)
+	s.errorOutput.Sync()
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/internal/ztest"
+)
+
+func TestFileSinkReopen(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		path := filepath.Join(dir, "app.log")
+		s, err := openFileSink(path, defaultFileOptions())
+		require.NoError(t, err, "Failed to open file sink.")
+		defer s.Close()
+
+		s.Write([]byte("before\n"))
+		require.NoError(t, os.Rename(path, path+".1"), "Failed to move log file.")
+		s.Write([]byte("moved\n"))
+		require.NoError(t, s.Reopen(), "Unexpected error reopening file sink.")
+		s.Write([]byte("after\n"))
+		require.NoError(t, s.Sync(), "Unexpected error syncing file sink.")
+
+		assert.Equal(t, "before\nmoved\n", readFile(t, path+".1"), "Unexpected contents in moved file.")
+		assert.Equal(t, "after\n", readFile(t, path), "Unexpected contents in reopened file.")
+	})
+}
+
+func TestFileSinkReopenFailure(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		path := filepath.Join(dir, "logs", "app.log")
+		require.NoError(t, os.Mkdir(filepath.Dir(path), 0755))
+		s, err := openFileSink(path, defaultFileOptions())
+		require.NoError(t, err, "Failed to open file sink.")
+		defer s.Close()
+
+		require.NoError(t, os.Rename(filepath.Dir(path), filepath.Join(dir, "old")), "Failed to move log directory.")
+		assert.Error(t, s.Reopen(), "Expected reopening a path in a missing directory to fail.")
+
+		_, err = s.Write([]byte("still here\n"))
+		assert.NoError(t, err, "Expected writes to go to the old file after a failed reopen.")
+		assert.Equal(t, "still here\n", readFile(t, filepath.Join(dir, "old", "app.log")), "Unexpected contents in old file.")
+	})
+}
+
+func TestFileSinkConcurrentReopen(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		path := filepath.Join(dir, "app.log")
+		s, err := openFileSink(path, defaultFileOptions())
+		require.NoError(t, err, "Failed to open file sink.")
+		defer s.Close()
+
+		var wg sync.WaitGroup
+		runConcurrently(5, 100, &wg, func() {
+			_, err := s.Write([]byte("line\n"))
+			assert.NoError(t, err, "Unexpected error writing during reopen.")
+		})
+		runConcurrently(1, 20, &wg, func() {
+			assert.NoError(t, s.Reopen(), "Unexpected error reopening file sink.")
+		})
+		wg.Wait()
+
+		assert.Len(t, readFile(t, path), 500*len("line\n"), "Expected every write to land in the file.")
+	})
+}
+
+func TestFileSinkClosed(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		s, err := openFileSink(filepath.Join(dir, "app.log"), defaultFileOptions())
+		require.NoError(t, err, "Failed to open file sink.")
+		require.NoError(t, s.Close(), "Unexpected error closing file sink.")
+
+		assert.NoError(t, s.Close(), "Expected closing twice to be a no-op.")
+		assert.NoError(t, s.Sync(), "Expected syncing a closed sink to be a no-op.")
+		assert.NoError(t, s.Reopen(), "Expected reopening a closed sink to be a no-op.")
+		_, err = s.Write([]byte("foo"))
+		assert.Error(t, err, "Expected writing to a closed sink to fail.")
+	})
+}
+
+func TestFileSinkOptions(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		path := filepath.Join(dir, "audit", "nested", "app.log")
+		sink, err := newFileSink(mustParseURL(t, "file://"+path+"?mode=0600&mkdir=true&fsync=always"))
+		require.NoError(t, err, "Failed to open file sink.")
+		defer sink.Close()
+
+		s := sink.(*fileSink)
+		assert.Equal(t, fileOptions{
+			mode:          0600,
+			mkdir:         true,
+			fsync:         fsyncAlways,
+			fsyncInterval: time.Second,
+		}, s.opts, "Unexpected options.")
+
+		_, err = s.Write([]byte("foo\n"))
+		require.NoError(t, err, "Unexpected error writing with fsync=always.")
+		assert.Equal(t, "foo\n", readFile(t, path), "Unexpected file contents.")
+
+		info, err := os.Stat(path)
+		require.NoError(t, err, "Failed to stat log file.")
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "Unexpected file permissions.")
+		info, err = os.Stat(filepath.Dir(path))
+		require.NoError(t, err, "Failed to stat log directory.")
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm(), "Unexpected directory permissions.")
+
+		// Reopening recreates missing directories too.
+		require.NoError(t, os.RemoveAll(filepath.Join(dir, "audit")), "Failed to remove log directory.")
+		require.NoError(t, s.Reopen(), "Unexpected error reopening file sink.")
+		s.Write([]byte("bar\n"))
+		assert.Equal(t, "bar\n", readFile(t, path), "Unexpected file contents after reopening.")
+	})
+}
+
+func TestFileSinkFsyncPolicies(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		path := filepath.Join(dir, "app.log")
+
+		sink, err := newFileSink(mustParseURL(t, "file://"+path+"?fsync=interval&fsyncInterval=1ms"))
+		require.NoError(t, err, "Failed to open file sink.")
+		sink.Write([]byte("foo\n"))
+		time.Sleep(10 * time.Millisecond)
+		require.NoError(t, sink.Close(), "Unexpected error closing file sink.")
+		require.NoError(t, sink.Close(), "Expected closing twice to be a no-op.")
+
+		sink, err = newFileSink(mustParseURL(t, "file://"+path+"?fsync=never"))
+		require.NoError(t, err, "Failed to open file sink.")
+		defer sink.Close()
+		f := sink.(*fileSink).file
+		f.Close()
+		assert.NoError(t, sink.Sync(), "Expected Sync to skip fsync with fsync=never.")
+	})
+}
+
+func TestFileSinkPathTemplate(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		sink, err := newFileSink(mustParseURL(t, "file://"+dir+"/{%25Y}/app-{date}-{hour}.log?utc=true&mkdir=true"))
+		require.NoError(t, err, "Failed to open file sink.")
+		defer sink.Close()
+
+		s := sink.(*fileSink)
+		errOut := &ztest.Buffer{}
+		s.setErrorOutput(errOut)
+		now := time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC)
+		s.now = func() time.Time { return now }
+
+		s.Write([]byte("first\n"))
+		now = now.Add(500 * time.Millisecond)
+		s.Write([]byte("same second\n"))
+		now = now.Add(500 * time.Millisecond)
+		s.Write([]byte("new year\n"))
+
+		// If the new file can't be opened, keep writing to the old one.
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "2028"), nil, 0644), "Failed to block the next directory.")
+		now = now.AddDate(1, 0, 0)
+		_, err = s.Write([]byte("blocked\n"))
+		assert.NoError(t, err, "Expected writes to continue to the old file.")
+		assert.Contains(t, errOut.String(), "rollover error: can't open", "Expected the failure to be reported.")
+
+		old := filepath.Join(dir, "2026", "app-2026-12-31-23.log")
+		current := filepath.Join(dir, "2027", "app-2027-01-01-00.log")
+		assert.Equal(t, "first\nsame second\n", readFile(t, old), "Unexpected contents in the first file.")
+		assert.Equal(t, "new year\nblocked\n", readFile(t, current), "Unexpected contents in the second file.")
+	})
+}
+
+func TestFileSinkPathTemplateErrors(t *testing.T) {
+	_, err := newFileSink(mustParseURL(t, "file:///var/log/app-{%25Q}.log"))
+	assert.Error(t, err, "Expected an error for an invalid path template.")
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"go.uber.org/atomic"
+)
+
+const schemeGELF = "gelf"
+
+const (
+	_gelfDefaultPort      = "12201"
+	_gelfDefaultChunkSize = 1420 // fits in a typical WAN MTU
+	_gelfMinChunkSize     = 64
+	_gelfMaxChunkSize     = 65507 // the largest UDP payload over IPv4
+	_gelfMaxChunks        = 128
+	_gelfChunkHeaderSize  = 12 // magic bytes, message ID, sequence number and count
+)
+
+// gelfSink is a Sink that sends GELF messages, like those produced by the
+// "gelf" encoder, to Graylog over UDP. Each message is optionally gzipped,
+// then split into GELF chunks if it doesn't fit in a single datagram.
+type gelfSink struct {
+	*netSink
+
+	compress  bool
+	chunkSize int
+	nextID    *atomic.Uint64
+}
+
+// newGELFSink builds a GELF sink from URLs like
+//   gelf://graylog:12201
+//   gelf://graylog?compress=gzip&chunkSize=8154
+//
+// See Open for the supported query parameters.
+func newGELFSink(u *url.URL) (Sink, error) {
+	if u.User != nil {
+		return nil, fmt.Errorf("user and password not allowed with gelf URLs: got %v", u)
+	}
+	if u.Fragment != "" {
+		return nil, fmt.Errorf("fragments not allowed with gelf URLs: got %v", u)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("gelf URLs must include a host: got %v", u)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("paths not allowed with gelf URLs: got %v", u)
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), _gelfDefaultPort)
+	}
+
+	// Start message IDs at a random point, so that IDs from different
+	// processes are unlikely to collide.
+	var seed [8]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		return nil, err
+	}
+	s := &gelfSink{
+		chunkSize: _gelfDefaultChunkSize,
+		nextID:    atomic.NewUint64(binary.BigEndian.Uint64(seed[:])),
+	}
+	cfg := defaultNetSinkConfig("udp", address)
+	for key, vals := range u.Query() {
+		if len(vals) != 1 {
+			return nil, fmt.Errorf("gelf URL parameter %q must be set exactly once: got %v", key, u)
+		}
+		if err := s.setOption(&cfg, key, vals[0]); err != nil {
+			return nil, fmt.Errorf("invalid gelf URL parameter %q: %v", key, err)
+		}
+	}
+	s.netSink = startNetSink(cfg, net.DialTimeout)
+	return s, nil
+}
+
+func (s *gelfSink) setOption(cfg *netSinkConfig, key, val string) error {
+	switch key {
+	case "compress":
+		switch val {
+		case "gzip":
+			s.compress = true
+		case "none":
+			s.compress = false
+		default:
+			return fmt.Errorf(`must be "gzip" or "none", got %q`, val)
+		}
+	case "chunkSize":
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		if n < _gelfMinChunkSize || n > _gelfMaxChunkSize {
+			return fmt.Errorf("must be between %d and %d", _gelfMinChunkSize, _gelfMaxChunkSize)
+		}
+		s.chunkSize = n
+	default:
+		return cfg.setOption(key, val)
+	}
+	return nil
+}
+
+// Write sends a single GELF message. Trailing newlines and null bytes, which
+// Graylog's UDP input doesn't expect, are removed.
+func (s *gelfSink) Write(p []byte) (int, error) {
+	msg := bytes.TrimRight(p, "\n\x00")
+	if s.compress {
+		var err error
+		if msg, err = gzipBytes(msg); err != nil {
+			return 0, err
+		}
+	}
+
+	if len(msg) <= s.chunkSize {
+		if _, err := s.netSink.Write(msg); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	payload := s.chunkSize - _gelfChunkHeaderSize
+	count := (len(msg) + payload - 1) / payload
+	if count > _gelfMaxChunks {
+		return 0, fmt.Errorf("GELF message of %d bytes needs more than %d chunks", len(msg), _gelfMaxChunks)
+	}
+	id := s.nextID.Inc()
+	chunk := make([]byte, _gelfChunkHeaderSize, s.chunkSize)
+	chunk[0], chunk[1] = 0x1e, 0x0f
+	binary.BigEndian.PutUint64(chunk[2:], id)
+	chunk[11] = byte(count)
+	for seq := 0; seq < count; seq++ {
+		chunk[10] = byte(seq)
+		end := (seq + 1) * payload
+		if end > len(msg) {
+			end = len(msg)
+		}
+		chunk = append(chunk[:_gelfChunkHeaderSize], msg[seq*payload:end]...)
+		if _, err := s.netSink.Write(chunk); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
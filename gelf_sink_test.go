@@ -0,0 +1,149 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGELFSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen.")
+	defer conn.Close()
+
+	ws, cleanup, err := Open("gelf://" + conn.LocalAddr().String())
+	require.NoError(t, err, "Failed to open GELF sink.")
+	defer cleanup()
+
+	msg := `{"version":"1.1","host":"h","short_message":"hi","level":6}`
+	n, err := ws.Write([]byte(msg + "\n"))
+	require.NoError(t, err, "Unexpected error writing to GELF sink.")
+	assert.Equal(t, len(msg)+1, n, "Unexpected number of bytes written.")
+	assert.Equal(t, msg, readDatagram(t, conn), "Expected the message without its line ending.")
+}
+
+func TestGELFSinkCompression(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen.")
+	defer conn.Close()
+
+	ws, cleanup, err := Open("gelf://" + conn.LocalAddr().String() + "?compress=gzip")
+	require.NoError(t, err, "Failed to open GELF sink.")
+	defer cleanup()
+
+	ws.Write([]byte(`{"short_message":"hi"}` + "\x00"))
+	gz, err := gzip.NewReader(strings.NewReader(readDatagram(t, conn)))
+	require.NoError(t, err, "Expected a gzipped datagram.")
+	decompressed, err := ioutil.ReadAll(gz)
+	require.NoError(t, err, "Failed to decompress datagram.")
+	assert.Equal(t, `{"short_message":"hi"}`, string(decompressed), "Unexpected message.")
+}
+
+func TestGELFSinkChunking(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen.")
+	defer conn.Close()
+
+	ws, cleanup, err := Open("gelf://" + conn.LocalAddr().String() + "?chunkSize=64")
+	require.NoError(t, err, "Failed to open GELF sink.")
+	defer cleanup()
+
+	// With 52 bytes of payload per chunk, this needs three chunks.
+	msg := strings.Repeat("0123456789", 12)
+	_, err = ws.Write([]byte(msg))
+	require.NoError(t, err, "Unexpected error writing a large message.")
+
+	var (
+		reassembled bytes.Buffer
+		id          []byte
+	)
+	for seq := 0; seq < 3; seq++ {
+		chunk := []byte(readDatagram(t, conn))
+		require.True(t, len(chunk) > _gelfChunkHeaderSize, "Chunk too short.")
+		assert.True(t, len(chunk) <= 64, "Chunk larger than the chunk size.")
+		assert.Equal(t, []byte{0x1e, 0x0f}, chunk[:2], "Unexpected magic bytes.")
+		if id == nil {
+			id = chunk[2:10]
+		}
+		assert.Equal(t, id, chunk[2:10], "Expected every chunk to have the same message ID.")
+		assert.Equal(t, []byte{byte(seq), 3}, chunk[10:12], "Unexpected sequence number or count.")
+		reassembled.Write(chunk[_gelfChunkHeaderSize:])
+	}
+	assert.Equal(t, msg, reassembled.String(), "Unexpected reassembled message.")
+
+	_, err = ws.Write([]byte(msg))
+	require.NoError(t, err, "Unexpected error writing another large message.")
+	next := []byte(readDatagram(t, conn))
+	assert.Equal(t, binary.BigEndian.Uint64(id)+1, binary.BigEndian.Uint64(next[2:10]), "Expected a new message ID.")
+
+	_, err = ws.Write(bytes.Repeat([]byte{'x'}, 52*128+1))
+	assert.Error(t, err, "Expected an error writing a message that needs too many chunks.")
+}
+
+func TestGELFSinkURLErrors(t *testing.T) {
+	tests := []struct {
+		url string
+		err string
+	}{
+		{"gelf://user@localhost", "user and password not allowed"},
+		{"gelf://localhost#foo", "fragments not allowed"},
+		{"gelf:///path", "must include a host"},
+		{"gelf://localhost/path", "paths not allowed"},
+		{"gelf://localhost?compress=zstd", `must be "gzip" or "none"`},
+		{"gelf://localhost?chunkSize=big", `invalid gelf URL parameter "chunkSize"`},
+		{"gelf://localhost?chunkSize=63", "must be between 64 and 65507"},
+		{"gelf://localhost?chunkSize=65508", "must be between 64 and 65507"},
+		{"gelf://localhost?framing=octet", "not supported with udp sockets"},
+		{"gelf://localhost?bogus=1", `invalid gelf URL parameter "bogus": unknown parameter`},
+		{"gelf://localhost?compress=gzip&compress=none", "must be set exactly once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := newGELFSink(mustParseURL(t, tt.url))
+			if assert.Error(t, err, "Expected an error opening %q.", tt.url) {
+				assert.Contains(t, err.Error(), tt.err, "Unexpected error opening %q.", tt.url)
+			}
+		})
+	}
+}
+
+func TestGELFSinkURLOptions(t *testing.T) {
+	sink, err := newGELFSink(mustParseURL(t, "gelf://graylog?compress=gzip&chunkSize=8154&queueSize=7"))
+	require.NoError(t, err, "Unexpected error opening GELF sink.")
+	s := sink.(*gelfSink)
+	defer s.Close()
+
+	assert.Equal(t, "udp", s.cfg.network, "Unexpected network.")
+	assert.Equal(t, "graylog:12201", s.cfg.address, "Expected the default GELF port.")
+	assert.True(t, s.compress, "Expected compression.")
+	assert.Equal(t, 8154, s.chunkSize, "Unexpected chunk size.")
+	assert.Equal(t, 7, s.cfg.queueSize, "Unexpected queue size.")
+}
@@ -24,6 +24,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"go.uber.org/zap/zapcore"
 )
@@ -79,3 +80,81 @@ func (lvl AtomicLevel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 }
+
+// ServeHTTP dumps the sink's buffered output. Only GET requests are
+// supported.
+func (s *MemorySink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+		}{"Only GET is supported."})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(s.Snapshot())
+}
+
+// SinkStatsHandler returns a JSON endpoint that reports the statistics of
+// every open sink (see AllSinkStats). It responds with 503 Service
+// Unavailable if any sink is unhealthy, so it can serve as a health check.
+// Only GET requests are supported.
+func SinkStatsHandler() http.Handler {
+	type sinkPayload struct {
+		URL           string     `json:"url"`
+		Healthy       bool       `json:"healthy"`
+		Entries       int64      `json:"entries"`
+		BytesWritten  int64      `json:"bytesWritten"`
+		WriteErrors   int64      `json:"writeErrors"`
+		SyncErrors    int64      `json:"syncErrors"`
+		LastError     string     `json:"lastError,omitempty"`
+		LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+		LastWrite     *time.Time `json:"lastWrite,omitempty"`
+		LastSync      *time.Time `json:"lastSync,omitempty"`
+	}
+	nonZero := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := json.NewEncoder(w)
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			enc.Encode(struct {
+				Error string `json:"error"`
+			}{"Only GET is supported."})
+			return
+		}
+
+		stats := AllSinkStats()
+		sinks := make([]sinkPayload, len(stats))
+		code := http.StatusOK
+		for i, st := range stats {
+			sinks[i] = sinkPayload{
+				URL:           st.URL,
+				Healthy:       st.Healthy(),
+				Entries:       st.Entries,
+				BytesWritten:  st.BytesWritten,
+				WriteErrors:   st.WriteErrors,
+				SyncErrors:    st.SyncErrors,
+				LastErrorTime: nonZero(st.LastErrorTime),
+				LastWrite:     nonZero(st.LastWrite),
+				LastSync:      nonZero(st.LastSync),
+			}
+			if st.LastError != nil {
+				sinks[i].LastError = st.LastError.Error()
+			}
+			if !sinks[i].Healthy {
+				code = http.StatusServiceUnavailable
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		enc.Encode(struct {
+			Sinks []sinkPayload `json:"sinks"`
+		}{sinks})
+	})
+}
@@ -129,3 +129,50 @@ func TestHTTPHandlerMethodNotAllowed(t *testing.T) {
 	assertCodeMethodNotAllowed(t, code)
 	assertJSONError(t, body)
 }
+
+func TestMemorySinkHTTPHandler(t *testing.T) {
+	ws, cleanup, err := Open("memory://http-handler-test?size=1KB")
+	require.NoError(t, err, "Failed to open memory sink.")
+	defer cleanup()
+	ws.Write([]byte(`{"msg":"hello"}` + "\n"))
+
+	sink, ok := LookupMemorySink("http-handler-test")
+	require.True(t, ok, "Expected to find the memory sink.")
+
+	code, body := makeRequest(t, "GET", sink, nil)
+	assertCodeOK(t, code)
+	assert.Equal(t, `{"msg":"hello"}`+"\n", body, "Unexpected response body.")
+
+	code, body = makeRequest(t, "DELETE", sink, nil)
+	assertCodeMethodNotAllowed(t, code)
+	assertJSONError(t, body)
+}
+
+func TestSinkStatsHandler(t *testing.T) {
+	ws, cleanup, err := Open("memory://sink-stats-handler-test")
+	require.NoError(t, err, "Failed to open memory sink.")
+	defer cleanup()
+	ws.Write([]byte("foo\n"))
+
+	code, body := makeRequest(t, "GET", SinkStatsHandler(), nil)
+	require.NotEqual(t, http.StatusMethodNotAllowed, code, "Unexpected response status code.")
+	var resp struct {
+		Sinks []map[string]interface{} `json:"sinks"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &resp), "Expected a JSON response.")
+
+	var found map[string]interface{}
+	for _, s := range resp.Sinks {
+		if s["url"] == "memory://sink-stats-handler-test" {
+			found = s
+		}
+	}
+	require.NotNil(t, found, "Expected the open sink to be listed.")
+	assert.Equal(t, true, found["healthy"], "Expected the sink to be healthy.")
+	assert.Equal(t, float64(1), found["entries"], "Unexpected number of entries.")
+	assert.Equal(t, float64(4), found["bytesWritten"], "Unexpected number of bytes.")
+
+	code, body = makeRequest(t, "POST", SinkStatsHandler(), nil)
+	assertCodeMethodNotAllowed(t, code)
+	assertJSONError(t, body)
+}
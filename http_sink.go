@@ -0,0 +1,537 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	schemeHTTP  = "http"
+	schemeHTTPS = "https"
+
+	// Query parameters with this prefix are sent to the endpoint, without
+	// the prefix.
+	_httpQueryPrefix = "query."
+)
+
+// httpStatusError reports a response with a non-2xx status code.
+type httpStatusError struct {
+	code int
+	body string
+}
+
+func (e *httpStatusError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("unexpected status %d", e.code)
+	}
+	return fmt.Sprintf("unexpected status %d: %s", e.code, e.body)
+}
+
+// isRetryableHTTPError reports whether a failed request might succeed if
+// retried: transport errors, rate limiting, and server errors are retried,
+// but other client errors aren't.
+func isRetryableHTTPError(err error) bool {
+	if statusErr, ok := err.(*httpStatusError); ok {
+		return statusErr.code == http.StatusTooManyRequests || statusErr.code >= 500
+	}
+	return true
+}
+
+// httpSinkConfig describes an httpSink. Its zero value isn't useful; start
+// with defaultHTTPSinkConfig.
+type httpSinkConfig struct {
+	url            string
+	header         http.Header
+	compress       bool
+	batchSize      int
+	maxBatchBytes  int64
+	flushInterval  time.Duration
+	queueSize      int
+	dropWhenFull   bool
+	requestTimeout time.Duration
+	syncTimeout    time.Duration
+	maxRetries     int
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+}
+
+func defaultHTTPSinkConfig(target string) httpSinkConfig {
+	return httpSinkConfig{
+		url:            target,
+		header:         http.Header{"Content-Type": {"application/x-ndjson"}},
+		batchSize:      1000,
+		maxBatchBytes:  1 << 20,
+		flushInterval:  time.Second,
+		queueSize:      16,
+		dropWhenFull:   true,
+		requestTimeout: 10 * time.Second,
+		syncTimeout:    5 * time.Second,
+		maxRetries:     3,
+		minBackoff:     100 * time.Millisecond,
+		maxBackoff:     10 * time.Second,
+	}
+}
+
+// setOption applies a URL query parameter to the config.
+func (cfg *httpSinkConfig) setOption(key string, vals []string) error {
+	if key == "header" {
+		for _, val := range vals {
+			parts := strings.SplitN(val, ":", 2)
+			name := strings.TrimSpace(parts[0])
+			if len(parts) != 2 || name == "" {
+				return fmt.Errorf(`must look like "Name: value", got %q`, val)
+			}
+			cfg.header.Add(name, strings.TrimSpace(parts[1]))
+		}
+		return nil
+	}
+
+	var err error
+	val := vals[0]
+	switch key {
+	case "contentType":
+		cfg.header.Set("Content-Type", val)
+	case "compress":
+		switch val {
+		case "gzip":
+			cfg.compress = true
+		case "none":
+			cfg.compress = false
+		default:
+			err = fmt.Errorf("unsupported compression %q", val)
+		}
+	case "batchSize":
+		cfg.batchSize, err = strconv.Atoi(val)
+		if err == nil && cfg.batchSize < 1 {
+			err = errors.New("must be positive")
+		}
+	case "maxBatchBytes":
+		cfg.maxBatchBytes, err = parseSize(val)
+		if err == nil && cfg.maxBatchBytes < 1 {
+			err = errors.New("must be positive")
+		}
+	case "flushInterval":
+		cfg.flushInterval, err = parsePositiveDuration(val)
+	case "queueSize":
+		cfg.queueSize, err = strconv.Atoi(val)
+		if err == nil && cfg.queueSize < 1 {
+			err = errors.New("must be positive")
+		}
+	case "onFull":
+		switch val {
+		case "drop":
+			cfg.dropWhenFull = true
+		case "block":
+			cfg.dropWhenFull = false
+		default:
+			err = fmt.Errorf(`must be "drop" or "block", got %q`, val)
+		}
+	case "requestTimeout":
+		cfg.requestTimeout, err = parsePositiveDuration(val)
+	case "syncTimeout":
+		cfg.syncTimeout, err = parsePositiveDuration(val)
+	case "maxRetries":
+		cfg.maxRetries, err = strconv.Atoi(val)
+		if err == nil && cfg.maxRetries < 0 {
+			err = errors.New("must not be negative")
+		}
+	case "maxBackoff":
+		cfg.maxBackoff, err = parsePositiveDuration(val)
+	default:
+		err = errors.New("unknown parameter")
+	}
+	if err == nil && len(vals) != 1 {
+		err = errors.New("must be set exactly once")
+	}
+	return err
+}
+
+type httpBatch struct {
+	body    []byte
+	entries int
+	// Instead of a body, Sync sends a channel that's closed once every
+	// earlier batch has been sent.
+	synced chan struct{}
+}
+
+// httpSink is a Sink that batches log entries and POSTs each batch to an
+// HTTP endpoint from a background goroutine. Batches are sent once they're
+// full and on a timer; failed requests are retried with exponential backoff,
+// and batches that can't be delivered are reported to the error output.
+//
+// It's safe for concurrent use.
+type httpSink struct {
+	cfg      httpSinkConfig
+	client   *http.Client
+	redacted string // the endpoint, without credentials
+
+	mu      sync.Mutex
+	body    []byte
+	entries int
+
+	queue   chan httpBatch
+	closing chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	errMu       sync.Mutex
+	errorOutput zapcore.WriteSyncer
+}
+
+// newHTTPSink builds a sink for the http and https schemes from URLs like
+//   https://collector:8080/ingest?batchSize=500&compress=gzip
+//   http://localhost:3100/loki/api/v1/push?header=X-Scope-OrgID:%20tenant
+//
+// See Open for the supported query parameters.
+func newHTTPSink(u *url.URL) (Sink, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("%s URLs must include a host: got %v", u.Scheme, u)
+	}
+	if u.Fragment != "" {
+		return nil, fmt.Errorf("fragments not allowed with %s URLs: got %v", u.Scheme, u)
+	}
+
+	target := *u
+	forwarded := make(url.Values)
+	cfg := defaultHTTPSinkConfig("")
+	for key, vals := range u.Query() {
+		if name := strings.TrimPrefix(key, _httpQueryPrefix); name != key && name != "" {
+			forwarded[name] = append(forwarded[name], vals...)
+			continue
+		}
+		if err := cfg.setOption(key, vals); err != nil {
+			return nil, fmt.Errorf("invalid %s URL parameter %q: %v", u.Scheme, key, err)
+		}
+	}
+	target.RawQuery = forwarded.Encode()
+	cfg.url = target.String()
+	if cfg.compress {
+		cfg.header.Set("Content-Encoding", "gzip")
+	}
+	return startHTTPSink(cfg, &http.Client{Timeout: cfg.requestTimeout}), nil
+}
+
+func startHTTPSink(cfg httpSinkConfig, client *http.Client) *httpSink {
+	s := &httpSink{
+		cfg:         cfg,
+		client:      client,
+		redacted:    cfg.url,
+		queue:       make(chan httpBatch, cfg.queueSize),
+		closing:     make(chan struct{}),
+		done:        make(chan struct{}),
+		errorOutput: zapcore.Lock(os.Stderr),
+	}
+	if u, err := url.Parse(cfg.url); err == nil && u.User != nil {
+		u.User = nil
+		s.redacted = u.String()
+	}
+	go s.run()
+	go s.flushPeriodically()
+	return s
+}
+
+func (s *httpSink) setErrorOutput(ws zapcore.WriteSyncer) {
+	s.errMu.Lock()
+	s.errorOutput = ws
+	s.errMu.Unlock()
+}
+
+func (s *httpSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.closing:
+		return 0, errSinkClosed
+	default:
+	}
+	// If the queue is full, the earlier entries may be dropped without p.
+	var dropped int
+	if s.entries > 0 && int64(len(s.body)+len(p)) > s.cfg.maxBatchBytes {
+		dropped = s.enqueueLocked()
+	}
+	s.body = append(s.body, p...)
+	s.entries++
+	n := len(p)
+	if s.entries >= s.cfg.batchSize || int64(len(s.body)) >= s.cfg.maxBatchBytes {
+		if d := s.enqueueLocked(); d > 0 {
+			dropped += d
+			n = 0
+		}
+	}
+	if dropped > 0 {
+		return n, &dropError{entries: dropped, reason: "queue is full"}
+	}
+	return n, nil
+}
+
+// Sync sends the current batch and waits until every entry written so far
+// has been delivered (or given up on), or until the sync timeout expires.
+func (s *httpSink) Sync() error {
+	return s.SyncContext(context.Background())
+}
+
+// SyncContext is like Sync, but also gives up once ctx is done.
+func (s *httpSink) SyncContext(ctx context.Context) error {
+	timeout := time.NewTimer(s.cfg.syncTimeout)
+	defer timeout.Stop()
+
+	// Wait for room in the queue even if the sink drops batches when it's
+	// full, but give up (keeping the batch) once the deadline passes.
+	s.mu.Lock()
+	if batch := s.takeBatchLocked(); batch.entries > 0 {
+		select {
+		case s.queue <- batch:
+		case <-timeout.C:
+			s.body, s.entries = batch.body, batch.entries
+			s.mu.Unlock()
+			return fmt.Errorf("timed out syncing http sink %v", s.redacted)
+		case <-ctx.Done():
+			s.body, s.entries = batch.body, batch.entries
+			s.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+	s.mu.Unlock()
+
+	synced := make(chan struct{})
+	select {
+	case s.queue <- httpBatch{synced: synced}:
+	case <-s.done:
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("timed out syncing http sink %v", s.redacted)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-synced:
+		return nil
+	case <-s.done:
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("timed out syncing http sink %v", s.redacted)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting new entries and makes a single attempt to send those
+// already batched.
+func (s *httpSink) Close() error {
+	return s.CloseContext(context.Background())
+}
+
+// CloseContext is like Close, but stops waiting for batches to be sent once
+// ctx is done. They're still sent in the background.
+func (s *httpSink) CloseContext(ctx context.Context) error {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.reportDropped(s.enqueueLocked())
+		close(s.closing)
+		s.mu.Unlock()
+	})
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueueLocked hands the current batch to the background goroutine, and
+// returns the number of entries dropped because the queue was full. The
+// caller must hold s.mu.
+func (s *httpSink) enqueueLocked() int {
+	batch := s.takeBatchLocked()
+	if batch.entries == 0 {
+		return 0
+	}
+	if !s.cfg.dropWhenFull {
+		// The sink can't close while we hold the lock, so the background
+		// goroutine is still draining the queue.
+		s.queue <- batch
+		return 0
+	}
+	select {
+	case s.queue <- batch:
+		return 0
+	default:
+		return batch.entries
+	}
+}
+
+// reportDropped reports entries dropped by an enqueueLocked call that has no
+// Write to return an error from.
+func (s *httpSink) reportDropped(entries int) {
+	if entries > 0 {
+		s.reportError(&dropError{entries: entries, reason: "queue is full"})
+	}
+}
+
+// takeBatchLocked removes and returns the current batch. The caller must
+// hold s.mu.
+func (s *httpSink) takeBatchLocked() httpBatch {
+	batch := httpBatch{body: s.body, entries: s.entries}
+	s.body, s.entries = nil, 0
+	return batch
+}
+
+func (s *httpSink) flushPeriodically() {
+	ticker := time.NewTicker(s.cfg.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			select {
+			case <-s.closing:
+			default:
+				s.reportDropped(s.enqueueLocked())
+			}
+			s.mu.Unlock()
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+func (s *httpSink) run() {
+	defer close(s.done)
+	for {
+		select {
+		case batch := <-s.queue:
+			s.handle(batch, s.cfg.maxRetries)
+		case <-s.closing:
+			s.drain()
+			return
+		}
+	}
+}
+
+// drain makes a single attempt to send each remaining batch.
+func (s *httpSink) drain() {
+	for {
+		select {
+		case batch := <-s.queue:
+			s.handle(batch, 0)
+		default:
+			return
+		}
+	}
+}
+
+// handle sends a batch, retrying with backoff until it succeeds, the error
+// isn't retryable, or the sink is closed.
+func (s *httpSink) handle(batch httpBatch, retries int) {
+	if batch.synced != nil {
+		close(batch.synced)
+		return
+	}
+	body := batch.body
+	if s.cfg.compress {
+		var err error
+		if body, err = gzipBytes(body); err != nil {
+			s.reportError(fmt.Errorf("can't compress %d entries: %v", batch.entries, err))
+			return
+		}
+	}
+
+	backoff := s.cfg.minBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.post(body)
+		if err == nil {
+			return
+		}
+		if attempt >= retries || !isRetryableHTTPError(err) {
+			s.reportError(fmt.Errorf("can't send %d entries to %v: %v", batch.entries, s.redacted, err))
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-s.closing:
+			// Make one last attempt.
+			retries = attempt + 1
+		}
+		if backoff *= 2; backoff > s.cfg.maxBackoff {
+			backoff = s.cfg.maxBackoff
+		}
+	}
+}
+
+func (s *httpSink) post(body []byte) error {
+	req, err := http.NewRequest("POST", s.cfg.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, vals := range s.cfg.header {
+		req.Header[name] = vals
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Read a little of the body for error messages, and discard the rest so
+	// that the connection can be reused.
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return &httpStatusError{code: resp.StatusCode, body: strings.TrimSpace(string(msg))}
+}
+
+func (s *httpSink) reportError(err error) {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	fmt.Fprintf(s.errorOutput, "%v http sink error: %v\n", time.Now(), err)
+	s.errorOutput.Sync()
+}
+
+func gzipBytes(p []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(p); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
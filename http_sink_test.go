@@ -0,0 +1,375 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/internal/ztest"
+	"go.uber.org/zap/zapcore"
+)
+
+type httpRequest struct {
+	query  string
+	header http.Header
+	body   string
+}
+
+// recordingServer records every request it receives and responds with the
+// status codes it's given, then with 200s.
+type recordingServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []httpRequest
+	statuses []int
+}
+
+func newRecordingServer(statuses ...int) *recordingServer {
+	s := &recordingServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(bytes.NewReader(body))
+			if err == nil {
+				body, _ = ioutil.ReadAll(gz)
+			}
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, httpRequest{r.URL.RawQuery, r.Header, string(body)})
+		if len(s.statuses) > 0 {
+			w.WriteHeader(s.statuses[0])
+			w.Write([]byte("try again\n"))
+			s.statuses = s.statuses[1:]
+		}
+	}))
+	return s
+}
+
+func (s *recordingServer) Requests() []httpRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]httpRequest(nil), s.requests...)
+}
+
+func testHTTPSinkConfig(target string) httpSinkConfig {
+	cfg := defaultHTTPSinkConfig(target)
+	cfg.flushInterval = time.Hour
+	cfg.minBackoff = time.Millisecond
+	cfg.maxBackoff = 10 * time.Millisecond
+	cfg.syncTimeout = ztest.Timeout(time.Second)
+	return cfg
+}
+
+func TestHTTPSinkBatches(t *testing.T) {
+	srv := newRecordingServer()
+	defer srv.Close()
+
+	sink, err := newHTTPSink(mustParseURL(t, srv.URL+"/ingest?batchSize=2&flushInterval=1h"))
+	require.NoError(t, err, "Failed to open http sink.")
+	defer sink.Close()
+
+	for _, line := range []string{"one\n", "two\n", "three\n"} {
+		_, err := sink.Write([]byte(line))
+		require.NoError(t, err, "Unexpected error writing to http sink.")
+	}
+	require.NoError(t, sink.Sync(), "Unexpected error syncing.")
+
+	requests := srv.Requests()
+	require.Len(t, requests, 2, "Expected a full batch and a partial batch.")
+	assert.Equal(t, "one\ntwo\n", requests[0].body, "Unexpected first batch.")
+	assert.Equal(t, "three\n", requests[1].body, "Unexpected second batch.")
+	assert.Equal(t, "application/x-ndjson", requests[0].header.Get("Content-Type"), "Unexpected default content type.")
+}
+
+func TestHTTPSinkMaxBatchBytes(t *testing.T) {
+	srv := newRecordingServer()
+	defer srv.Close()
+
+	sink, err := newHTTPSink(mustParseURL(t, srv.URL+"?maxBatchBytes=8B"))
+	require.NoError(t, err, "Failed to open http sink.")
+	defer sink.Close()
+
+	for _, line := range []string{"abc\n", "def\n", "ghi\n"} {
+		sink.Write([]byte(line))
+	}
+	require.NoError(t, sink.Sync(), "Unexpected error syncing.")
+
+	requests := srv.Requests()
+	require.Len(t, requests, 2, "Expected batches to be split by size.")
+	assert.Equal(t, "abc\ndef\n", requests[0].body, "Unexpected first batch.")
+	assert.Equal(t, "ghi\n", requests[1].body, "Unexpected second batch.")
+}
+
+func TestHTTPSinkRequestOptions(t *testing.T) {
+	srv := newRecordingServer()
+	defer srv.Close()
+
+	sink, err := newHTTPSink(mustParseURL(t, srv.URL+
+		"/bulk?contentType=text/plain&header=X-Tenant:%20acme&header=X-Extra:1&compress=gzip&query.pipeline=logs"))
+	require.NoError(t, err, "Failed to open http sink.")
+	defer sink.Close()
+
+	sink.Write([]byte("hello\n"))
+	require.NoError(t, sink.Sync(), "Unexpected error syncing.")
+
+	requests := srv.Requests()
+	require.Len(t, requests, 1, "Expected a single request.")
+	req := requests[0]
+	assert.Equal(t, "hello\n", req.body, "Unexpected body.")
+	assert.Equal(t, "pipeline=logs", req.query, "Expected only query.-prefixed parameters to be forwarded.")
+	assert.Equal(t, "text/plain", req.header.Get("Content-Type"), "Unexpected content type.")
+	assert.Equal(t, "gzip", req.header.Get("Content-Encoding"), "Unexpected content encoding.")
+	assert.Equal(t, "acme", req.header.Get("X-Tenant"), "Unexpected custom header.")
+	assert.Equal(t, "1", req.header.Get("X-Extra"), "Unexpected custom header.")
+}
+
+func TestHTTPSinkFlushInterval(t *testing.T) {
+	srv := newRecordingServer()
+	defer srv.Close()
+
+	sink, err := newHTTPSink(mustParseURL(t, srv.URL+"?flushInterval=10ms"))
+	require.NoError(t, err, "Failed to open http sink.")
+	defer sink.Close()
+
+	sink.Write([]byte("tick\n"))
+	deadline := time.Now().Add(ztest.Timeout(time.Second))
+	for len(srv.Requests()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	requests := srv.Requests()
+	require.Len(t, requests, 1, "Expected the batch to be flushed on a timer.")
+	assert.Equal(t, "tick\n", requests[0].body, "Unexpected body.")
+}
+
+func TestHTTPSinkRetries(t *testing.T) {
+	tests := []struct {
+		desc     string
+		statuses []int
+		attempts int
+		errOut   string
+	}{
+		{"server errors", []int{503, 500}, 3, ""},
+		{"rate limited", []int{429}, 2, ""},
+		{"out of retries", []int{503, 503, 503, 503}, 4, "http sink error: can't send 1 entries to"},
+		{"client error", []int{400}, 1, "unexpected status 400: try again"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			srv := newRecordingServer(tt.statuses...)
+			defer srv.Close()
+
+			errOut := &bytes.Buffer{}
+			sink := startHTTPSink(testHTTPSinkConfig(srv.URL), http.DefaultClient)
+			sink.setErrorOutput(zapcore.AddSync(errOut))
+			defer sink.Close()
+
+			sink.Write([]byte("entry\n"))
+			require.NoError(t, sink.Sync(), "Unexpected error syncing.")
+			assert.Len(t, srv.Requests(), tt.attempts, "Unexpected number of attempts.")
+			if tt.errOut == "" {
+				assert.Empty(t, errOut.String(), "Unexpected error output.")
+			} else {
+				assert.Contains(t, errOut.String(), tt.errOut, "Unexpected error output.")
+			}
+		})
+	}
+}
+
+func TestHTTPSinkQueuePolicies(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	cfg := testHTTPSinkConfig(srv.URL)
+	cfg.batchSize = 1
+	cfg.queueSize = 1
+	errOut := &bytes.Buffer{}
+	sink := startHTTPSink(cfg, http.DefaultClient)
+	sink.setErrorOutput(zapcore.AddSync(errOut))
+	defer sink.Close()
+	defer close(release)
+
+	// The first batch blocks the background goroutine and the second fills
+	// the queue, so later batches are dropped.
+	sink.Write([]byte("one\n"))
+	deadline := time.Now().Add(ztest.Timeout(time.Second))
+	for len(sink.queue) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	sink.Write([]byte("two\n"))
+	ws := &statsSink{Sink: sink}
+	n, err := ws.Write([]byte("three\n"))
+	assert.Equal(t, 0, n, "Expected the dropped entry not to be written.")
+	assert.Equal(t, &dropError{entries: 1, reason: "queue is full"}, err, "Expected the Write that dropped a batch to fail.")
+	assert.Equal(t, int64(1), ws.Stats().Dropped, "Expected the dropped entry to be counted.")
+	assert.Empty(t, errOut.String(), "Expected the dropped batch to be reported by Write only.")
+}
+
+func TestHTTPSinkClose(t *testing.T) {
+	srv := newRecordingServer()
+	defer srv.Close()
+
+	sink, err := newHTTPSink(mustParseURL(t, srv.URL))
+	require.NoError(t, err, "Failed to open http sink.")
+	sink.Write([]byte("last\n"))
+	require.NoError(t, sink.Close(), "Unexpected error closing http sink.")
+
+	requests := srv.Requests()
+	require.Len(t, requests, 1, "Expected Close to send the last batch.")
+	assert.Equal(t, "last\n", requests[0].body, "Unexpected body.")
+
+	_, err = sink.Write([]byte("late\n"))
+	assert.Equal(t, errSinkClosed, err, "Expected writes after Close to fail.")
+	assert.NoError(t, sink.Sync(), "Expected Sync after Close to succeed.")
+}
+
+func TestHTTPSinkURLErrors(t *testing.T) {
+	tests := []struct {
+		url string
+		err string
+	}{
+		{"http:///ingest", "must include a host"},
+		{"http://localhost/ingest#foo", "fragments not allowed"},
+		{"http://localhost?batchSize=0", "must be positive"},
+		{"http://localhost?maxBatchBytes=lots", `can't parse "lots" as a size`},
+		{"https://localhost?flushInterval=0s", "must be positive"},
+		{"http://localhost?compress=zstd", `unsupported compression "zstd"`},
+		{"http://localhost?onFull=sometimes", `must be "drop" or "block"`},
+		{"http://localhost?maxRetries=-1", "must not be negative"},
+		{"http://localhost?header=nocolon", `must look like "Name: value"`},
+		{"http://localhost?header=:value", `must look like "Name: value"`},
+		{"http://localhost?batchSize=1&batchSize=2", "must be set exactly once"},
+		{"http://localhost?batchsize=1", `invalid http URL parameter "batchsize": unknown parameter`},
+		{"http://localhost?query.=1", `invalid http URL parameter "query.": unknown parameter`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := newHTTPSink(mustParseURL(t, tt.url))
+			if assert.Error(t, err, "Expected an error opening %q.", tt.url) {
+				assert.Contains(t, err.Error(), tt.err, "Unexpected error opening %q.", tt.url)
+			}
+		})
+	}
+}
+
+func TestHTTPSinkConfig(t *testing.T) {
+	srv := newRecordingServer()
+	defer srv.Close()
+
+	cfg := NewProductionConfig()
+	cfg.OutputPaths = []string{srv.URL + "/logs"}
+	cfg.EncoderConfig.TimeKey = ""
+	logger, close, err := cfg.BuildWithClose()
+	require.NoError(t, err, "Failed to build logger.")
+	defer close()
+
+	logger.Info("hello")
+	require.NoError(t, logger.Sync(), "Unexpected error syncing logger.")
+	requests := srv.Requests()
+	require.Len(t, requests, 1, "Expected a single request.")
+	assert.Contains(t, requests[0].body, `"msg":"hello"`, "Unexpected body.")
+}
+
+func TestHTTPSinkContext(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	sink, err := newHTTPSink(mustParseURL(t, srv.URL))
+	require.NoError(t, err, "Failed to open http sink.")
+	s := sink.(*httpSink)
+	s.Write([]byte("stuck\n"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.SyncContext(ctx), "Expected SyncContext to give up with the context.")
+	assert.Equal(t, context.DeadlineExceeded, s.CloseContext(ctx), "Expected CloseContext to give up with the context.")
+
+	close(release)
+	assert.NoError(t, s.Close(), "Expected Close to finish once the server responds.")
+}
+
+func TestHTTPSinkSyncContextFullQueue(t *testing.T) {
+	release := make(chan struct{})
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg := testHTTPSinkConfig(srv.URL)
+	cfg.batchSize = 2
+	cfg.queueSize = 1
+	cfg.dropWhenFull = false
+	sink := startHTTPSink(cfg, http.DefaultClient)
+
+	// The first batch blocks the background goroutine and the second fills
+	// the queue, leaving a third batch in progress.
+	sink.Write([]byte("one\n"))
+	sink.Write([]byte("two\n"))
+	deadline := time.Now().Add(ztest.Timeout(time.Second))
+	for len(sink.queue) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	sink.Write([]byte("three\n"))
+	sink.Write([]byte("four\n"))
+	sink.Write([]byte("five\n"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, sink.SyncContext(ctx), "Expected SyncContext to give up while the queue is full.")
+	sink.mu.Lock()
+	assert.Equal(t, 1, sink.entries, "Expected the batch in progress to be kept.")
+	sink.mu.Unlock()
+
+	close(release)
+	require.NoError(t, sink.Close(), "Unexpected error closing http sink.")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"one\ntwo\n", "three\nfour\n", "five\n"}, bodies, "Expected every batch to be sent.")
+}
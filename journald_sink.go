@@ -0,0 +1,54 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"fmt"
+	"net/url"
+)
+
+const (
+	schemeJournald = "journald"
+
+	// _journaldSocket is where journald listens for native protocol
+	// datagrams.
+	_journaldSocket = "/run/systemd/journal/socket"
+)
+
+// newJournaldSink builds a sink that sends each write to systemd-journald as
+// a single native protocol message. URLs look like
+//   journald://                              (the default socket)
+//   journald:///run/systemd/journal/socket
+//
+// Entries should be encoded with the "journald" encoder.
+func newJournaldSink(u *url.URL) (Sink, error) {
+	if u.RawQuery != "" {
+		return nil, fmt.Errorf("query parameters not allowed with journald URLs: got %v", u)
+	}
+	if err := checkLocalURL(u); err != nil {
+		return nil, err
+	}
+	path := u.Path
+	if path == "" {
+		path = _journaldSocket
+	}
+	return openJournaldSink(path)
+}
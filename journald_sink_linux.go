@@ -0,0 +1,134 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// journaldSink writes to journald's datagram socket. Entries too large for a
+// single datagram are written to a sealed memfd (or, on older kernels, an
+// unlinked file in /dev/shm), whose descriptor is passed to journald instead.
+type journaldSink struct {
+	conn *net.UnixConn
+}
+
+func openJournaldSink(path string) (Sink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journaldSink{conn: conn}, nil
+}
+
+func (s *journaldSink) Write(p []byte) (int, error) {
+	_, err := s.conn.Write(p)
+	if err != nil && isDatagramTooLarge(err) {
+		err = s.writeFile(p)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *journaldSink) Sync() error {
+	return nil
+}
+
+func (s *journaldSink) Close() error {
+	return s.conn.Close()
+}
+
+func (s *journaldSink) writeFile(p []byte) error {
+	f, err := createJournaldFile(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.sendRights(syscall.UnixRights(int(f.Fd())))
+}
+
+// sendRights sends an empty datagram carrying the given control message. We
+// can't use WriteMsgUnix, which refuses to write to a connected datagram
+// socket.
+func (s *journaldSink) sendRights(oob []byte) error {
+	raw, err := s.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sendErr error
+	err = raw.Write(func(fd uintptr) bool {
+		sendErr = syscall.Sendmsg(int(fd), nil, oob, nil, 0)
+		return sendErr != syscall.EAGAIN
+	})
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// createJournaldFile returns a file holding p that's safe to pass to journald.
+// journald only accepts memfds that are sealed against writes; unlinked files
+// in /dev/shm, for kernels without memfds, don't need seals.
+func createJournaldFile(p []byte) (*os.File, error) {
+	fd, err := unix.MemfdCreate("zap-journald", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return createJournaldTempFile(p)
+	}
+	f := os.NewFile(uintptr(fd), "zap-journald")
+	if _, err := f.Write(p); err != nil {
+		f.Close()
+		return nil, err
+	}
+	seals := unix.F_SEAL_SEAL | unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE
+	if _, err := unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, seals); err != nil {
+		f.Close()
+		return nil, os.NewSyscallError("fcntl", err)
+	}
+	return f, nil
+}
+
+func createJournaldTempFile(p []byte) (*os.File, error) {
+	f, err := ioutil.TempFile("/dev/shm", "zap-journald")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Write(p); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func isDatagramTooLarge(err error) bool {
+	err = unwrapSyscallError(err)
+	return err == syscall.EMSGSIZE || err == syscall.ENOBUFS
+}
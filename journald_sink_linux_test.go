@@ -0,0 +1,140 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"go.uber.org/zap/internal/ztest"
+)
+
+// readJournaldMessage reads a single message sent to a journald socket,
+// following any file descriptor that was passed instead.
+func readJournaldMessage(t testing.TB, conn *net.UnixConn) []byte {
+	buf := make([]byte, 64*1024)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	conn.SetReadDeadline(time.Now().Add(ztest.Timeout(time.Second)))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	require.NoError(t, err, "Failed to read from journald socket.")
+	if oobn == 0 {
+		return buf[:n]
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	require.NoError(t, err, "Failed to parse control message.")
+	require.Len(t, msgs, 1, "Expected a single control message.")
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	require.NoError(t, err, "Failed to parse file descriptors.")
+	require.Len(t, fds, 1, "Expected a single file descriptor.")
+
+	f := os.NewFile(uintptr(fds[0]), "journald")
+	defer f.Close()
+	_, err = f.Seek(0, os.SEEK_SET)
+	require.NoError(t, err, "Failed to seek to the start of the passed file.")
+	contents, err := ioutil.ReadAll(f)
+	require.NoError(t, err, "Failed to read passed file.")
+	return contents
+}
+
+func withJournaldSocket(t testing.TB, f func(path string, conn *net.UnixConn)) {
+	withTempDir(t, func(dir string) {
+		path := filepath.Join(dir, "journal.sock")
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+		require.NoError(t, err, "Failed to listen.")
+		defer conn.Close()
+		f(path, conn)
+	})
+}
+
+func TestJournaldSink(t *testing.T) {
+	withJournaldSocket(t, func(path string, conn *net.UnixConn) {
+		ws, cleanup, err := Open("journald://" + path)
+		require.NoError(t, err, "Failed to open journald sink.")
+		defer cleanup()
+
+		_, err = ws.Write([]byte("MESSAGE=hello\nPRIORITY=6\n"))
+		require.NoError(t, err, "Unexpected error writing a small entry.")
+		assert.Equal(t, "MESSAGE=hello\nPRIORITY=6\n", string(readJournaldMessage(t, conn)), "Unexpected datagram.")
+
+		// Larger than the default socket send buffer, so it can't be sent as
+		// a datagram.
+		large := append([]byte("MESSAGE="), bytes.Repeat([]byte("x"), 1<<20)...)
+		large = append(large, '\n')
+		_, err = ws.Write(large)
+		require.NoError(t, err, "Unexpected error writing a large entry.")
+		assert.Equal(t, large, readJournaldMessage(t, conn), "Expected large entries to be passed as a file.")
+	})
+}
+
+func TestJournaldFileIsSealed(t *testing.T) {
+	f, err := createJournaldFile([]byte("MESSAGE=hello\n"))
+	require.NoError(t, err, "Failed to create journald file.")
+	defer f.Close()
+
+	seals, err := unix.FcntlInt(f.Fd(), unix.F_GET_SEALS, 0)
+	require.NoError(t, err, "Failed to get the file's seals.")
+	assert.Equal(
+		t,
+		unix.F_SEAL_SEAL|unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE,
+		seals,
+		"Expected the memfd to be sealed.",
+	)
+	_, err = f.Write([]byte("x"))
+	assert.Error(t, err, "Expected writes to a sealed memfd to fail.")
+}
+
+func TestJournaldSinkMissingSocket(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		_, err := newJournaldSink(mustParseURL(t, "journald://"+filepath.Join(dir, "missing.sock")))
+		assert.Error(t, err, "Expected an error connecting to a missing socket.")
+	})
+}
+
+func TestJournaldConfig(t *testing.T) {
+	withJournaldSocket(t, func(path string, conn *net.UnixConn) {
+		cfg := NewProductionConfig()
+		cfg.Encoding = "journald"
+		cfg.OutputPaths = []string{"journald://" + path}
+		cfg.DisableCaller = true
+		logger, close, err := cfg.BuildWithClose()
+		require.NoError(t, err, "Failed to build logger.")
+		defer close()
+
+		logger.Named("api").Warn("slow request", String("path", "/users"), Namespace("db"), Int("queries", 12))
+		assert.Equal(
+			t,
+			"MESSAGE=slow request\nPRIORITY=4\nPATH=/users\nDB_QUERIES=12\nLOGGER=api\n",
+			string(readJournaldMessage(t, conn)),
+			"Unexpected journal entry.",
+		)
+	})
+}
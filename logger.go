@@ -21,6 +21,7 @@
 package zap
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -243,6 +244,13 @@ func (log *Logger) Sync() error {
 	return log.core.Sync()
 }
 
+// SyncContext is like Sync, but returns ctx's error once ctx is done, even if
+// the Core is still syncing. It bounds how long a graceful shutdown waits for
+// a hung destination.
+func (log *Logger) SyncContext(ctx context.Context) error {
+	return zapcore.SyncCoreContext(ctx, log.core)
+}
+
 // Core returns the Logger's underlying zapcore.Core.
 func (log *Logger) Core() zapcore.Core {
 	return log.core
@@ -21,9 +21,11 @@
 package zap
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"testing"
+	"time"
 
 	"go.uber.org/zap/internal/exit"
 	"go.uber.org/zap/internal/ztest"
@@ -321,6 +323,32 @@ func TestLoggerSync(t *testing.T) {
 	})
 }
 
+// hungSyncer is a WriteSyncer whose Sync blocks until it's released.
+type hungSyncer struct {
+	ztest.Discarder
+	release chan struct{}
+}
+
+func (s *hungSyncer) Sync() error {
+	<-s.release
+	return nil
+}
+
+func TestLoggerSyncContext(t *testing.T) {
+	withLogger(t, DebugLevel, nil, func(logger *Logger, _ *observer.ObservedLogs) {
+		assert.NoError(t, logger.SyncContext(context.Background()), "Expected syncing a test logger to succeed.")
+	})
+
+	hung := &hungSyncer{release: make(chan struct{})}
+	defer close(hung.release)
+	logger := New(zapcore.NewCore(zapcore.NewJSONEncoder(zapcore.EncoderConfig{}), hung, DebugLevel))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, logger.SyncContext(ctx), "Expected SyncContext to give up with the context.")
+	assert.Equal(t, context.DeadlineExceeded, logger.Sugar().SyncContext(ctx), "Expected SyncContext to give up with the context.")
+}
+
 func TestLoggerSyncFail(t *testing.T) {
 	noSync := &ztest.Buffer{}
 	err := errors.New("fail")
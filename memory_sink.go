@@ -0,0 +1,230 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+const (
+	schemeMemory = "memory"
+
+	_defaultMemorySinkSize = 1 << 20
+	_maxMemorySinkSize     = 1 << 30
+)
+
+var (
+	_memorySinkMutex sync.Mutex
+	_memorySinks     = make(map[string]*MemorySink)
+)
+
+// MemorySink is a Sink that keeps the most recent log output in a fixed-size
+// in-memory ring buffer, which is useful for inspecting recent logs from a
+// misbehaving process regardless of what reached disk. Zap creates memory
+// sinks for URLs with the "memory" scheme, like memory://recent?size=256KB;
+// use LookupMemorySink to retrieve them by name.
+//
+// Opening the same name again shares the sink. Once every Sink opened with
+// the name is closed, the name is released and LookupMemorySink no longer
+// finds it; closing doesn't discard the contents of the sinks already opened.
+// It's safe for concurrent use.
+type MemorySink struct {
+	name string
+	refs int // opened handles not yet closed, guarded by _memorySinkMutex
+
+	mu      sync.Mutex
+	buf     []byte
+	written int64 // total bytes ever written
+	aligned bool  // whether the oldest buffered byte starts an entry
+}
+
+// A memorySinkHandle is the Sink returned by each opening of a memory URL.
+// Each handle holds one reference to the shared MemorySink, which closing
+// the handle releases only once.
+type memorySinkHandle struct {
+	*MemorySink
+
+	closed bool // guarded by _memorySinkMutex
+}
+
+func (h *memorySinkHandle) Close() error {
+	_memorySinkMutex.Lock()
+	defer _memorySinkMutex.Unlock()
+
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	s := h.MemorySink
+	s.refs--
+	if s.refs == 0 && _memorySinks[s.name] == s {
+		delete(_memorySinks, s.name)
+	}
+	return nil
+}
+
+// newMemorySink builds a sink from URLs like
+//   memory://recent?size=256KB
+//
+// Opening a name that's still open returns a new handle to the existing
+// sink.
+func newMemorySink(u *url.URL) (Sink, error) {
+	if u.User != nil {
+		return nil, fmt.Errorf("user and password not allowed with memory URLs: got %v", u)
+	}
+	if u.Fragment != "" {
+		return nil, fmt.Errorf("fragments not allowed with memory URLs: got %v", u)
+	}
+	if u.Port() != "" {
+		return nil, fmt.Errorf("ports not allowed with memory URLs: got %v", u)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("paths not allowed with memory URLs: got %v", u)
+	}
+	name := u.Hostname()
+	if name == "" {
+		return nil, fmt.Errorf("memory URLs must include a name: got %v", u)
+	}
+
+	var size int64
+	for key, vals := range u.Query() {
+		if len(vals) != 1 {
+			return nil, fmt.Errorf("memory URL parameter %q must be set exactly once: got %v", key, u)
+		}
+		var err error
+		switch key {
+		case "size":
+			size, err = parseSize(vals[0])
+			if err == nil && size < 1 {
+				err = errors.New("must be positive")
+			}
+			if err == nil && size > _maxMemorySinkSize {
+				err = fmt.Errorf("must be at most %d bytes", _maxMemorySinkSize)
+			}
+		default:
+			err = errors.New("unknown parameter")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory URL parameter %q: %v", key, err)
+		}
+	}
+
+	_memorySinkMutex.Lock()
+	defer _memorySinkMutex.Unlock()
+
+	if s, ok := _memorySinks[name]; ok {
+		if size != 0 && size != int64(len(s.buf)) {
+			return nil, fmt.Errorf("memory sink %q already exists with size %d", name, len(s.buf))
+		}
+		s.refs++
+		return &memorySinkHandle{MemorySink: s}, nil
+	}
+	if size == 0 {
+		size = _defaultMemorySinkSize
+	}
+	s := &MemorySink{name: name, refs: 1, buf: make([]byte, size)}
+	_memorySinks[name] = s
+	return &memorySinkHandle{MemorySink: s}, nil
+}
+
+// LookupMemorySink returns the memory sink opened with the given name, if
+// any.
+func LookupMemorySink(name string) (*MemorySink, bool) {
+	_memorySinkMutex.Lock()
+	defer _memorySinkMutex.Unlock()
+	s, ok := _memorySinks[name]
+	return s, ok
+}
+
+// Write implements zapcore.WriteSyncer. Once the buffer is full, each write
+// overwrites the oldest output.
+func (s *MemorySink) Write(p []byte) (int, error) {
+	n := len(p)
+	if n == 0 {
+		return 0, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := int64(len(s.buf))
+	total := s.written + int64(n)
+	if total > size {
+		// Before overwriting anything, check whether the byte just before
+		// the oldest one we'll keep ends an entry.
+		var prev byte
+		if i := total - size - 1; i >= s.written {
+			prev = p[i-s.written]
+		} else {
+			prev = s.buf[i%size]
+		}
+		s.aligned = prev == '\n'
+	}
+
+	start := s.written
+	if int64(n) > size {
+		start += int64(n) - size
+		p = p[int64(n)-size:]
+	}
+	copied := copy(s.buf[start%size:], p)
+	copy(s.buf, p[copied:])
+	s.written = total
+	return n, nil
+}
+
+// Sync implements zapcore.WriteSyncer. It's a no-op.
+func (s *MemorySink) Sync() error {
+	return nil
+}
+
+// Close implements Sink. It's a no-op: the name is released once every Sink
+// opened with it is closed, and closing a sink found with LookupMemorySink
+// doesn't release anything.
+func (s *MemorySink) Close() error {
+	return nil
+}
+
+// Snapshot returns a copy of the buffered output, oldest first. If the
+// buffer has wrapped around, the partially overwritten oldest entry is
+// omitted.
+func (s *MemorySink) Snapshot() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := int64(len(s.buf))
+	if s.written <= size {
+		return append([]byte(nil), s.buf[:s.written]...)
+	}
+	start := s.written % size
+	out := make([]byte, 0, size)
+	out = append(out, s.buf[start:]...)
+	out = append(out, s.buf[:start]...)
+	if !s.aligned {
+		if i := bytes.IndexByte(out, '\n'); i >= 0 && i < len(out)-1 {
+			out = out[i+1:]
+		}
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openMemorySink(t testing.TB, rawURL string) *memorySinkHandle {
+	sink, err := newMemorySink(mustParseURL(t, rawURL))
+	require.NoError(t, err, "Failed to open memory sink.")
+	return sink.(*memorySinkHandle)
+}
+
+func TestMemorySinkRingBuffer(t *testing.T) {
+	tests := []struct {
+		desc   string
+		writes []string
+		want   string
+	}{
+		{"empty", nil, ""},
+		{"partially full", []string{"a\n", "b\n"}, "a\nb\n"},
+		{"exactly full", []string{"abcd\n", "efgh\n"}, "abcd\nefgh\n"},
+		{"wrapped mid-entry", []string{"abcd\n", "efgh\n", "ij\n"}, "efgh\nij\n"},
+		{"wrapped on an entry boundary", []string{"abc\n", "defgh\n", "ijkl\n"}, "defgh\nijkl\n"},
+		{"write larger than the buffer", []string{"a\n", "0123456789abcdef\n"}, "6789abcdef\n"},
+		{"oversized write ending on a boundary", []string{"0123456789\n0123456789\n"}, "0123456789\n"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			s := openMemorySink(t, "memory://ring-"+string('a'+rune(i))+"?size=11")
+			defer s.Close()
+			for _, w := range tt.writes {
+				n, err := s.Write([]byte(w))
+				require.NoError(t, err, "Unexpected error writing to memory sink.")
+				assert.Equal(t, len(w), n, "Unexpected number of bytes written.")
+			}
+			assert.Equal(t, tt.want, string(s.Snapshot()), "Unexpected snapshot.")
+		})
+	}
+}
+
+func TestMemorySinkManyWrites(t *testing.T) {
+	s := openMemorySink(t, "memory://many?size=1KB")
+	defer s.Close()
+	var all []string
+	for i := 0; i < 1000; i++ {
+		line := strings.Repeat("x", i%50) + "\n"
+		s.Write([]byte(line))
+		all = append(all, line)
+	}
+
+	snapshot := string(s.Snapshot())
+	assert.True(t, len(snapshot) <= 1024, "Expected the snapshot to fit in the buffer.")
+	assert.True(t, strings.HasSuffix(strings.Join(all, ""), snapshot), "Expected the snapshot to be the most recent output.")
+	assert.True(t, len(snapshot) > 1024-50, "Expected the snapshot to omit at most one entry.")
+}
+
+func TestMemorySinkRegistry(t *testing.T) {
+	s := openMemorySink(t, "memory://shared?size=64B")
+	s.Write([]byte("hello\n"))
+
+	found, ok := LookupMemorySink("shared")
+	require.True(t, ok, "Expected to find the memory sink by name.")
+	assert.True(t, s.MemorySink == found, "Expected to find the opened sink.")
+
+	other := openMemorySink(t, "memory://shared")
+	assert.True(t, s.MemorySink == other.MemorySink, "Expected reopening a name to share the sink.")
+	_, err := newMemorySink(mustParseURL(t, "memory://shared?size=128B"))
+	assert.Error(t, err, "Expected an error reopening a name with a different size.")
+
+	require.NoError(t, s.Close(), "Unexpected error closing memory sink.")
+	require.NoError(t, s.Close(), "Unexpected error closing memory sink again.")
+	require.NoError(t, found.Close(), "Unexpected error closing the sink found by name.")
+	_, ok = LookupMemorySink("shared")
+	assert.True(t, ok, "Expected the sink to stay registered while another handle is open.")
+
+	require.NoError(t, other.Close(), "Unexpected error closing memory sink.")
+	_, ok = LookupMemorySink("shared")
+	assert.False(t, ok, "Expected closing every opened sink to release the name.")
+	assert.Equal(t, "hello\n", string(s.Snapshot()), "Expected the contents to survive closing.")
+
+	reopened := openMemorySink(t, "memory://shared?size=128B")
+	defer reopened.Close()
+	assert.False(t, s.MemorySink == reopened.MemorySink, "Expected a released name to open a new sink.")
+	assert.Empty(t, reopened.Snapshot(), "Expected a new sink to start empty.")
+
+	_, ok = LookupMemorySink("missing")
+	assert.False(t, ok, "Expected no sink for an unknown name.")
+}
+
+func TestMemorySinkURLErrors(t *testing.T) {
+	tests := []struct {
+		url string
+		err string
+	}{
+		{"memory://", "must include a name"},
+		{"memory://name/path", "paths not allowed"},
+		{"memory://name:80", "ports not allowed"},
+		{"memory://user@name", "user and password not allowed"},
+		{"memory://name#foo", "fragments not allowed"},
+		{"memory://name?size=0", "must be positive"},
+		{"memory://name?size=big", `can't parse "big" as a size`},
+		{"memory://name?size=2GB", "must be at most 1073741824 bytes"},
+		{"memory://name?size=1000GB", "must be at most 1073741824 bytes"},
+		{"memory://name?bogus=1", "unknown parameter"},
+		{"memory://name?size=1KB&size=2KB", "must be set exactly once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := newMemorySink(mustParseURL(t, tt.url))
+			if assert.Error(t, err, "Expected an error opening %q.", tt.url) {
+				assert.Contains(t, err.Error(), tt.err, "Unexpected error opening %q.", tt.url)
+			}
+		})
+	}
+}
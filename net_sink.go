@@ -0,0 +1,484 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"go.uber.org/multierr"
+)
+
+const (
+	schemeTCP  = "tcp"
+	schemeUDP  = "udp"
+	schemeUnix = "unix"
+)
+
+var (
+	errSinkClosed = errors.New("sink is closed")
+	errQueueFull  = &dropError{entries: 1, reason: "queue is full"}
+)
+
+// A framing separates encoded log entries on a stream-oriented connection.
+type framing int
+
+const (
+	// frameNone writes entries as-is. It's the only option for datagram
+	// sockets, where each entry is a separate packet.
+	frameNone framing = iota
+	// frameNewline ensures each entry ends with a newline.
+	frameNewline
+	// frameOctet prefixes each entry with its length in ASCII decimal and a
+	// space, as described in RFC 6587.
+	frameOctet
+	// frameLength prefixes each entry with its length as a big-endian uint32,
+	// which suits binary encodings.
+	frameLength
+)
+
+func parseFraming(s string) (framing, error) {
+	switch s {
+	case "newline":
+		return frameNewline, nil
+	case "octet":
+		return frameOctet, nil
+	case "length":
+		return frameLength, nil
+	case "none":
+		return frameNone, nil
+	}
+	return frameNone, fmt.Errorf("unknown framing %q", s)
+}
+
+// appendFrame appends a framed copy of the entry to dst.
+func (f framing) appendFrame(dst, entry []byte) []byte {
+	switch f {
+	case frameNewline:
+		dst = append(dst, entry...)
+		if len(entry) == 0 || entry[len(entry)-1] != '\n' {
+			dst = append(dst, '\n')
+		}
+		return dst
+	case frameOctet:
+		dst = strconv.AppendInt(dst, int64(len(entry)), 10)
+		dst = append(dst, ' ')
+	case frameLength:
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(entry)))
+		dst = append(dst, size[:]...)
+	}
+	return append(dst, entry...)
+}
+
+type netItem struct {
+	data []byte
+	// Instead of data, Sync sends a channel that's closed once every earlier
+	// entry has been written.
+	synced chan struct{}
+}
+
+// netSinkConfig describes a netSink. Its zero value isn't useful; start with
+// defaultNetSinkConfig.
+type netSinkConfig struct {
+	network      string
+	address      string
+	framing      framing
+	queueSize    int
+	dropWhenFull bool
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+	syncTimeout  time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+}
+
+func defaultNetSinkConfig(network, address string) netSinkConfig {
+	cfg := netSinkConfig{
+		network:      network,
+		address:      address,
+		queueSize:    1024,
+		dropWhenFull: true,
+		dialTimeout:  5 * time.Second,
+		writeTimeout: 5 * time.Second,
+		syncTimeout:  5 * time.Second,
+		minBackoff:   100 * time.Millisecond,
+		maxBackoff:   10 * time.Second,
+	}
+	if !isDatagram(network) {
+		cfg.framing = frameNewline
+	}
+	return cfg
+}
+
+func isDatagram(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return true
+	}
+	return false
+}
+
+// setOption applies a URL query parameter to the config.
+func (cfg *netSinkConfig) setOption(key, val string) error {
+	var err error
+	switch key {
+	case "queueSize":
+		cfg.queueSize, err = strconv.Atoi(val)
+		if err == nil && cfg.queueSize < 1 {
+			err = errors.New("must be positive")
+		}
+	case "onFull":
+		switch val {
+		case "drop":
+			cfg.dropWhenFull = true
+		case "block":
+			cfg.dropWhenFull = false
+		default:
+			err = fmt.Errorf(`must be "drop" or "block", got %q`, val)
+		}
+	case "framing":
+		if isDatagram(cfg.network) {
+			return fmt.Errorf("not supported with %s sockets", cfg.network)
+		}
+		cfg.framing, err = parseFraming(val)
+	case "dialTimeout":
+		cfg.dialTimeout, err = parsePositiveDuration(val)
+	case "writeTimeout":
+		cfg.writeTimeout, err = parsePositiveDuration(val)
+	case "syncTimeout":
+		cfg.syncTimeout, err = parsePositiveDuration(val)
+	case "maxBackoff":
+		cfg.maxBackoff, err = parsePositiveDuration(val)
+	default:
+		err = errors.New("unknown parameter")
+	}
+	return err
+}
+
+func parsePositiveDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		err = errors.New("must be positive")
+	}
+	return d, err
+}
+
+// netSink is a Sink that writes each log entry to a network connection from a
+// background goroutine. Entries are queued in a bounded buffer; when the
+// queue is full, writes either fail immediately or block, depending on the
+// configuration. If the connection drops, the sink reconnects with
+// exponential backoff and retries the entry it was writing. Entries that can
+// never be sent, like datagrams too large for the socket, are dropped and
+// reported to the error output instead.
+//
+// It's safe for concurrent use.
+type netSink struct {
+	cfg  netSinkConfig
+	dial func(network, address string, timeout time.Duration) (net.Conn, error)
+
+	queue   chan netItem
+	closing chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	errMu       sync.Mutex
+	errorOutput zapcore.WriteSyncer
+
+	// Owned by the background goroutine until done is closed.
+	conn  net.Conn
+	frame []byte
+	err   error // entries dropped while closing
+}
+
+// newNetSink builds a sink for the tcp, udp, and unix schemes from URLs like
+//   tcp://localhost:5170?queueSize=4096&onFull=block&framing=octet
+//   unix:///var/run/collector.sock
+//
+// See Open for the supported query parameters.
+func newNetSink(u *url.URL) (Sink, error) {
+	if u.User != nil {
+		return nil, fmt.Errorf("user and password not allowed with %s URLs: got %v", u.Scheme, u)
+	}
+	if u.Fragment != "" {
+		return nil, fmt.Errorf("fragments not allowed with %s URLs: got %v", u.Scheme, u)
+	}
+
+	var address string
+	switch u.Scheme {
+	case schemeUnix:
+		if u.Host != "" {
+			return nil, fmt.Errorf("unix URLs must leave host empty: got %v", u)
+		}
+		if u.Path == "" {
+			return nil, fmt.Errorf("unix URLs must include a socket path: got %v", u)
+		}
+		address = u.Path
+	default:
+		if u.Hostname() == "" || u.Port() == "" {
+			return nil, fmt.Errorf("%s URLs must include a host and port: got %v", u.Scheme, u)
+		}
+		if u.Path != "" && u.Path != "/" {
+			return nil, fmt.Errorf("paths not allowed with %s URLs: got %v", u.Scheme, u)
+		}
+		address = u.Host
+	}
+
+	cfg := defaultNetSinkConfig(u.Scheme, address)
+	for key, vals := range u.Query() {
+		if len(vals) != 1 {
+			return nil, fmt.Errorf("%s URL parameter %q must be set exactly once: got %v", u.Scheme, key, u)
+		}
+		if err := cfg.setOption(key, vals[0]); err != nil {
+			return nil, fmt.Errorf("invalid %s URL parameter %q: %v", u.Scheme, key, err)
+		}
+	}
+	return startNetSink(cfg, net.DialTimeout), nil
+}
+
+func startNetSink(cfg netSinkConfig, dial func(string, string, time.Duration) (net.Conn, error)) *netSink {
+	s := &netSink{
+		cfg:         cfg,
+		dial:        dial,
+		queue:       make(chan netItem, cfg.queueSize),
+		closing:     make(chan struct{}),
+		done:        make(chan struct{}),
+		errorOutput: zapcore.Lock(os.Stderr),
+	}
+	go s.run()
+	return s
+}
+
+func (s *netSink) setErrorOutput(ws zapcore.WriteSyncer) {
+	s.errMu.Lock()
+	s.errorOutput = ws
+	s.errMu.Unlock()
+}
+
+func (s *netSink) Write(p []byte) (int, error) {
+	select {
+	case <-s.closing:
+		return 0, errSinkClosed
+	default:
+	}
+
+	// The caller may reuse p as soon as we return.
+	item := netItem{data: append([]byte(nil), p...)}
+	if s.cfg.dropWhenFull {
+		select {
+		case s.queue <- item:
+			return len(p), nil
+		default:
+			return 0, errQueueFull
+		}
+	}
+	select {
+	case s.queue <- item:
+		return len(p), nil
+	case <-s.closing:
+		return 0, errSinkClosed
+	}
+}
+
+// Sync waits until every entry written so far has been sent, or until the
+// sync timeout expires. Once the sink is closed, it returns the same error
+// as Close.
+func (s *netSink) Sync() error {
+	return s.SyncContext(context.Background())
+}
+
+// SyncContext is like Sync, but also gives up once ctx is done.
+func (s *netSink) SyncContext(ctx context.Context) error {
+	synced := make(chan struct{})
+	timeout := time.NewTimer(s.cfg.syncTimeout)
+	defer timeout.Stop()
+
+	select {
+	case s.queue <- netItem{synced: synced}:
+	case <-s.done:
+		return s.err
+	case <-timeout.C:
+		return fmt.Errorf("timed out syncing %s sink %v", s.cfg.network, s.cfg.address)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-synced:
+		return nil
+	case <-s.done:
+		return s.err
+	case <-timeout.C:
+		return fmt.Errorf("timed out syncing %s sink %v", s.cfg.network, s.cfg.address)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting new entries, makes a best effort to send those
+// already queued, and closes the connection. It returns an error if any
+// queued entries couldn't be sent.
+func (s *netSink) Close() error {
+	return s.CloseContext(context.Background())
+}
+
+// CloseContext is like Close, but stops waiting for queued entries to be
+// sent once ctx is done. They're still sent in the background.
+func (s *netSink) CloseContext(ctx context.Context) error {
+	s.once.Do(func() { close(s.closing) })
+	select {
+	case <-s.done:
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *netSink) run() {
+	defer close(s.done)
+	defer s.disconnect()
+
+	for {
+		select {
+		case item := <-s.queue:
+			s.err = multierr.Append(s.err, s.handle(item))
+		case <-s.closing:
+			s.err = multierr.Append(s.err, s.drain())
+			return
+		}
+	}
+}
+
+// handle writes an entry, reconnecting and retrying until it succeeds or the
+// sink is closed. It returns an error if it gives up because the sink is
+// closed.
+func (s *netSink) handle(item netItem) error {
+	if item.synced != nil {
+		close(item.synced)
+		return nil
+	}
+	backoff := s.cfg.minBackoff
+	for {
+		err := s.send(item.data)
+		if err == nil {
+			return nil
+		}
+		if isMessageTooLong(err) {
+			s.reportError(fmt.Errorf("dropped log entry: %v", err))
+			return nil
+		}
+		select {
+		case <-time.After(backoff):
+		case <-s.closing:
+			return fmt.Errorf("dropped log entry: %v", err)
+		}
+		if backoff *= 2; backoff > s.cfg.maxBackoff {
+			backoff = s.cfg.maxBackoff
+		}
+	}
+}
+
+// drain makes a single attempt to send each remaining entry, and stops at
+// the first one that fails for any reason but its size.
+func (s *netSink) drain() error {
+	var errs error
+	for {
+		select {
+		case item := <-s.queue:
+			if item.synced != nil {
+				close(item.synced)
+				continue
+			}
+			err := s.send(item.data)
+			if err == nil {
+				continue
+			}
+			if isMessageTooLong(err) {
+				errs = multierr.Append(errs, fmt.Errorf("dropped log entry: %v", err))
+				continue
+			}
+			return multierr.Append(errs, fmt.Errorf("dropped %d queued log entries: %v", 1+len(s.queue), err))
+		default:
+			return errs
+		}
+	}
+}
+
+// send writes a single framed entry, dialing first if necessary. On failure,
+// it drops the connection so that the next attempt redials.
+func (s *netSink) send(entry []byte) error {
+	if s.conn == nil {
+		conn, err := s.dial(s.cfg.network, s.cfg.address, s.cfg.dialTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	s.frame = s.cfg.framing.appendFrame(s.frame[:0], entry)
+	s.conn.SetWriteDeadline(time.Now().Add(s.cfg.writeTimeout))
+	if _, err := s.conn.Write(s.frame); err != nil {
+		s.disconnect()
+		return err
+	}
+	return nil
+}
+
+func (s *netSink) reportError(err error) {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	fmt.Fprintf(s.errorOutput, "%v %s sink error: %v\n", time.Now(), s.cfg.network, err)
+	s.errorOutput.Sync()
+}
+
+// isMessageTooLong reports whether a write failed because the entry is too
+// large for the socket, so retrying can't help.
+func isMessageTooLong(err error) bool {
+	return unwrapSyscallError(err) == syscall.EMSGSIZE
+}
+
+// unwrapSyscallError returns the system call error underlying a failed
+// network operation, if any.
+func unwrapSyscallError(err error) error {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return err
+}
+
+func (s *netSink) disconnect() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
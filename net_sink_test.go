@@ -0,0 +1,384 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/internal/ztest"
+)
+
+func testNetSinkConfig(network, address string) netSinkConfig {
+	cfg := defaultNetSinkConfig(network, address)
+	cfg.minBackoff = time.Millisecond
+	cfg.maxBackoff = 10 * time.Millisecond
+	cfg.syncTimeout = ztest.Timeout(time.Second)
+	return cfg
+}
+
+// acceptLines accepts connections on l and sends every line it reads to the
+// returned channel.
+func acceptLines(t testing.TB, l net.Listener) <-chan string {
+	lines := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}(conn)
+		}
+	}()
+	return lines
+}
+
+func receive(t testing.TB, lines <-chan string) string {
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(ztest.Timeout(time.Second)):
+		t.Fatal("Timed out waiting for a log entry.")
+		return ""
+	}
+}
+
+func TestAppendFrame(t *testing.T) {
+	tests := []struct {
+		framing framing
+		entry   string
+		want    string
+	}{
+		{frameNone, "foo\n", "foo\n"},
+		{frameNewline, "foo\n", "foo\n"},
+		{frameNewline, "foo", "foo\n"},
+		{frameNewline, "", "\n"},
+		{frameOctet, "foo\n", "4 foo\n"},
+		{frameLength, "foo", "\x00\x00\x00\x03foo"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, string(tt.framing.appendFrame(nil, []byte(tt.entry))), "Unexpected frame for %q.", tt.entry)
+	}
+}
+
+func TestNetSinkTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen.")
+	defer l.Close()
+	lines := acceptLines(t, l)
+
+	ws, cleanup, err := Open("tcp://" + l.Addr().String())
+	require.NoError(t, err, "Failed to open tcp sink.")
+	defer cleanup()
+
+	ws.Write([]byte(`{"msg":"one"}`))
+	ws.Write([]byte(`{"msg":"two"}` + "\n"))
+	require.NoError(t, ws.Sync(), "Unexpected error syncing.")
+	assert.Equal(t, `{"msg":"one"}`, receive(t, lines), "Unexpected first entry.")
+	assert.Equal(t, `{"msg":"two"}`, receive(t, lines), "Unexpected second entry.")
+}
+
+func TestNetSinkUnix(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		path := filepath.Join(dir, "collector.sock")
+		l, err := net.Listen("unix", path)
+		require.NoError(t, err, "Failed to listen.")
+		defer l.Close()
+		lines := acceptLines(t, l)
+
+		ws, cleanup, err := Open("unix://" + path + "?framing=octet")
+		require.NoError(t, err, "Failed to open unix sink.")
+		defer cleanup()
+
+		ws.Write([]byte("foo\n"))
+		assert.Equal(t, "4 foo", receive(t, lines), "Unexpected framed entry.")
+	})
+}
+
+func TestNetSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen.")
+	defer conn.Close()
+
+	ws, cleanup, err := Open("udp://" + conn.LocalAddr().String())
+	require.NoError(t, err, "Failed to open udp sink.")
+	defer cleanup()
+
+	for _, msg := range []string{"first\n", "second\n"} {
+		ws.Write([]byte(msg))
+		buf := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(ztest.Timeout(time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err, "Failed to read datagram.")
+		assert.Equal(t, msg, string(buf[:n]), "Expected each entry in its own datagram.")
+	}
+}
+
+func TestNetSinkReconnects(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen.")
+	addr := l.Addr().String()
+
+	var (
+		mu    sync.Mutex
+		conns []net.Conn
+	)
+	dial := func(network, address string, timeout time.Duration) (net.Conn, error) {
+		conn, err := net.DialTimeout(network, address, timeout)
+		if err == nil {
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+		return conn, err
+	}
+	s := startNetSink(testNetSinkConfig("tcp", addr), dial)
+	defer s.Close()
+
+	// The sink dials lazily, on its first write.
+	s.Write([]byte("before\n"))
+	server, err := l.Accept()
+	require.NoError(t, err, "Failed to accept connection.")
+	line, err := bufio.NewReader(server).ReadString('\n')
+	require.NoError(t, err, "Failed to read first entry.")
+	assert.Equal(t, "before\n", line, "Unexpected first entry.")
+
+	// Drop the connection and restart the listener on the same address.
+	server.Close()
+	l.Close()
+	l, err = net.Listen("tcp", addr)
+	require.NoError(t, err, "Failed to restart listener.")
+	defer l.Close()
+	lines := acceptLines(t, l)
+
+	// Writes to a connection the peer has closed may appear to succeed until
+	// the kernel notices, so keep writing until an entry makes it through.
+	deadline := time.Now().Add(ztest.Timeout(5 * time.Second))
+	for time.Now().Before(deadline) {
+		s.Write([]byte("after\n"))
+		select {
+		case line := <-lines:
+			assert.Equal(t, "after", line, "Unexpected entry after reconnecting.")
+			mu.Lock()
+			assert.True(t, len(conns) >= 2, "Expected the sink to redial.")
+			mu.Unlock()
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("Timed out waiting for the sink to reconnect.")
+}
+
+type blockingConn struct {
+	net.Conn
+	release chan struct{}
+}
+
+func (c *blockingConn) Write(p []byte) (int, error) {
+	<-c.release
+	return len(p), nil
+}
+
+func (c *blockingConn) SetWriteDeadline(time.Time) error { return nil }
+func (c *blockingConn) Close() error                     { return nil }
+
+func TestNetSinkQueuePolicies(t *testing.T) {
+	for _, drop := range []bool{true, false} {
+		conn := &blockingConn{release: make(chan struct{})}
+		cfg := testNetSinkConfig("tcp", "ignored:0")
+		cfg.queueSize = 1
+		cfg.dropWhenFull = drop
+		s := startNetSink(cfg, func(string, string, time.Duration) (net.Conn, error) {
+			return conn, nil
+		})
+
+		// The first entry is taken off the queue and blocks in Write; the second
+		// fills the queue.
+		s.Write([]byte("first"))
+		for len(s.queue) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		_, err := s.Write([]byte("second"))
+		require.NoError(t, err, "Unexpected error filling the queue.")
+
+		if drop {
+			_, err := s.Write([]byte("third"))
+			assert.Equal(t, errQueueFull, err, "Expected writes to a full queue to be dropped.")
+		} else {
+			written := make(chan struct{})
+			go func() {
+				s.Write([]byte("third"))
+				close(written)
+			}()
+			select {
+			case <-written:
+				t.Fatal("Expected writes to a full queue to block.")
+			case <-time.After(10 * time.Millisecond):
+			}
+			close(conn.release)
+			<-written
+		}
+		if drop {
+			close(conn.release)
+		}
+		require.NoError(t, s.Sync(), "Unexpected error syncing.")
+		s.Close()
+	}
+}
+
+func TestNetSinkSyncTimeout(t *testing.T) {
+	cfg := testNetSinkConfig("tcp", "ignored:0")
+	cfg.syncTimeout = 10 * time.Millisecond
+	s := startNetSink(cfg, func(string, string, time.Duration) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	})
+	defer s.Close()
+
+	s.Write([]byte("stuck"))
+	err := s.Sync()
+	if assert.Error(t, err, "Expected Sync to time out while disconnected.") {
+		assert.Contains(t, err.Error(), "timed out syncing tcp sink", "Unexpected error.")
+	}
+}
+
+func TestNetSinkClose(t *testing.T) {
+	cfg := testNetSinkConfig("tcp", "ignored:0")
+	s := startNetSink(cfg, func(string, string, time.Duration) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	})
+	s.Write([]byte("never sent"))
+	err := s.Close()
+	if assert.Error(t, err, "Expected Close to report the unsent entry.") {
+		assert.Contains(t, err.Error(), "connection refused", "Unexpected error closing.")
+	}
+	assert.Equal(t, err, s.Close(), "Expected closing twice to return the same error.")
+	assert.Equal(t, err, s.Sync(), "Expected syncing a closed sink to return the error from closing.")
+
+	_, err = s.Write([]byte("foo"))
+	assert.Equal(t, errSinkClosed, err, "Expected writes after Close to fail.")
+}
+
+func TestNetSinkDropsOversizedDatagrams(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen.")
+	defer conn.Close()
+
+	errOut := &ztest.Buffer{}
+	s := startNetSink(testNetSinkConfig("udp", conn.LocalAddr().String()), net.DialTimeout)
+	s.setErrorOutput(errOut)
+	defer s.Close()
+
+	s.Write(make([]byte, 1<<17))
+	s.Write([]byte("small\n"))
+	assert.Equal(t, "small\n", readDatagram(t, conn), "Expected entries after an oversized one to be sent.")
+	require.NoError(t, s.Sync(), "Unexpected error syncing.")
+	assert.Contains(t, errOut.String(), "udp sink error: dropped log entry", "Expected the oversized entry to be reported.")
+}
+
+func TestNetSinkURLErrors(t *testing.T) {
+	tests := []struct {
+		url string
+		err string
+	}{
+		{"tcp://localhost", "must include a host and port"},
+		{"tcp://:5170", "must include a host and port"},
+		{"udp://localhost:5170/path", "paths not allowed"},
+		{"tcp://user@localhost:5170", "user and password not allowed"},
+		{"tcp://localhost:5170#foo", "fragments not allowed"},
+		{"unix://host/tmp/sock", "must leave host empty"},
+		{"unix://", "must include a socket path"},
+		{"tcp://localhost:5170?queueSize=0", "must be positive"},
+		{"tcp://localhost:5170?onFull=sometimes", `must be "drop" or "block"`},
+		{"tcp://localhost:5170?framing=xml", `unknown framing "xml"`},
+		{"udp://localhost:5170?framing=octet", "not supported with udp sockets"},
+		{"tcp://localhost:5170?dialTimeout=0s", "must be positive"},
+		{"tcp://localhost:5170?writeTimeout=soon", `invalid tcp URL parameter "writeTimeout"`},
+		{"tcp://localhost:5170?bogus=1", "unknown parameter"},
+		{"tcp://localhost:5170?onFull=drop&onFull=block", "must be set exactly once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := newNetSink(mustParseURL(t, tt.url))
+			if assert.Error(t, err, "Expected an error opening %q.", tt.url) {
+				assert.Contains(t, err.Error(), tt.err, "Unexpected error opening %q.", tt.url)
+			}
+		})
+	}
+}
+
+func TestNetSinkURLOptions(t *testing.T) {
+	sink, err := newNetSink(mustParseURL(t, "tcp://localhost:5170?queueSize=7&onFull=block&framing=length&dialTimeout=1s&writeTimeout=2s&syncTimeout=3s&maxBackoff=4s"))
+	require.NoError(t, err, "Unexpected error opening tcp sink.")
+	s := sink.(*netSink)
+	defer s.Close()
+
+	assert.Equal(t, netSinkConfig{
+		network:      "tcp",
+		address:      "localhost:5170",
+		framing:      frameLength,
+		queueSize:    7,
+		dropWhenFull: false,
+		dialTimeout:  time.Second,
+		writeTimeout: 2 * time.Second,
+		syncTimeout:  3 * time.Second,
+		minBackoff:   100 * time.Millisecond,
+		maxBackoff:   4 * time.Second,
+	}, s.cfg, "Unexpected config.")
+}
+
+func mustParseURL(t testing.TB, s string) *url.URL {
+	u, err := url.Parse(s)
+	require.NoError(t, err, "Failed to parse URL %q.", s)
+	return u
+}
+
+func TestNetSinkContext(t *testing.T) {
+	conn := &blockingConn{release: make(chan struct{})}
+	s := startNetSink(testNetSinkConfig("tcp", "ignored:0"), func(string, string, time.Duration) (net.Conn, error) {
+		return conn, nil
+	})
+	s.Write([]byte("stuck"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.SyncContext(ctx), "Expected SyncContext to give up with the context.")
+	assert.Equal(t, context.DeadlineExceeded, s.CloseContext(ctx), "Expected CloseContext to give up with the context.")
+
+	close(conn.release)
+	assert.NoError(t, s.Close(), "Expected Close to finish once the connection unblocks.")
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// _namedTimeLayouts maps the named placeholders accepted in file paths to
+// time.Time layouts.
+var _namedTimeLayouts = map[string]string{
+	"date": "2006-01-02",
+	"hour": "15",
+}
+
+// _strftimeLayouts maps the supported strftime directives to time.Time
+// layouts.
+var _strftimeLayouts = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'b': "Jan",
+	'B': "January",
+	'd': "02",
+	'a': "Mon",
+	'A': "Monday",
+	'H': "15",
+	'I': "03",
+	'p': "PM",
+	'M': "04",
+	'S': "05",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+	'z': "-0700",
+	'Z': "MST",
+}
+
+// A pathTemplate is a file path with placeholders that expand to the current
+// time, like /var/log/app-{date}.log.
+type pathTemplate struct {
+	parts []templatePart
+	utc   bool
+}
+
+// A templatePart is either literal text or, if layout is set, a time
+// formatted with layout.
+type templatePart struct {
+	literal string
+	layout  string
+}
+
+// _timeLayoutPrefix marks a placeholder that holds a time.Time layout, like
+// {time:2006-01-02}.
+const _timeLayoutPrefix = "time:"
+
+// parsePathTemplate parses a path containing placeholders in braces. Each
+// placeholder is either a name ("date" or "hour"), a sequence of strftime
+// directives like "%Y%m%d", or a time.Time layout marked with a "time:"
+// prefix, like "time:2006-01-02". Braces around anything else, like "{name}"
+// or "{shard1}", are kept as literal text, so that paths from before
+// placeholders were supported keep working. If path has no placeholders,
+// parsePathTemplate returns nil.
+func parsePathTemplate(path string, utc bool) (*pathTemplate, error) {
+	t := &pathTemplate{utc: utc}
+	hasTime := false
+	for len(path) > 0 {
+		start := strings.IndexByte(path, '{')
+		end := -1
+		if start >= 0 {
+			end = strings.IndexByte(path[start:], '}')
+		}
+		if end < 0 {
+			t.parts = append(t.parts, templatePart{literal: path})
+			break
+		}
+		parts, err := parsePlaceholder(path[start+1 : start+end])
+		if err != nil {
+			return nil, err
+		}
+		if parts == nil {
+			// Not a placeholder, so keep the braces and their contents.
+			t.parts = append(t.parts, templatePart{literal: path[:start+end+1]})
+		} else {
+			if start > 0 {
+				t.parts = append(t.parts, templatePart{literal: path[:start]})
+			}
+			t.parts = append(t.parts, parts...)
+			hasTime = true
+		}
+		path = path[start+end+1:]
+	}
+	if !hasTime {
+		return nil, nil
+	}
+	return t, nil
+}
+
+// parsePlaceholder parses the text between a pair of braces. It returns nil
+// if the text isn't a placeholder.
+func parsePlaceholder(p string) ([]templatePart, error) {
+	var parts []templatePart
+	switch {
+	case strings.HasPrefix(p, "%"):
+		var err error
+		if parts, err = parseStrftime(p); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(p, _timeLayoutPrefix):
+		parts = []templatePart{{layout: strings.TrimPrefix(p, _timeLayoutPrefix)}}
+	default:
+		if layout, ok := _namedTimeLayouts[p]; ok {
+			return []templatePart{{layout: layout}}, nil
+		}
+		return nil, nil
+	}
+
+	// Reject placeholders that would never change, which are almost
+	// certainly mistakes.
+	t1 := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	t2 := time.Date(2012, 11, 10, 19, 58, 57, 0, time.UTC)
+	if expandParts(parts, t1) == expandParts(parts, t2) {
+		return nil, fmt.Errorf("placeholder {%s} doesn't contain any time fields", p)
+	}
+	return parts, nil
+}
+
+// parseStrftime converts strftime directives to layouts. Literal text is kept
+// separate, so that it's never mistaken for part of a layout.
+func parseStrftime(s string) ([]templatePart, error) {
+	var (
+		parts   []templatePart
+		literal []byte
+	)
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			literal = append(literal, s[i])
+			continue
+		}
+		if i+1 == len(s) {
+			return nil, fmt.Errorf("incomplete strftime directive in {%s}", s)
+		}
+		i++
+		if s[i] == '%' {
+			literal = append(literal, '%')
+			continue
+		}
+		layout, ok := _strftimeLayouts[s[i]]
+		if !ok {
+			return nil, fmt.Errorf("unsupported strftime directive %%%c in {%s}", s[i], s)
+		}
+		if len(literal) > 0 {
+			parts = append(parts, templatePart{literal: string(literal)})
+			literal = nil
+		}
+		parts = append(parts, templatePart{layout: layout})
+	}
+	if len(literal) > 0 {
+		parts = append(parts, templatePart{literal: string(literal)})
+	}
+	return parts, nil
+}
+
+// expand returns the path for the given time.
+func (t *pathTemplate) expand(now time.Time) string {
+	if t.utc {
+		now = now.UTC()
+	}
+	return expandParts(t.parts, now)
+}
+
+func expandParts(parts []templatePart, now time.Time) string {
+	var b []byte
+	for _, p := range parts {
+		if p.layout == "" {
+			b = append(b, p.literal...)
+			continue
+		}
+		b = now.AppendFormat(b, p.layout)
+	}
+	return string(b)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathTemplate(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 5, 3, 0, time.FixedZone("EST", -5*60*60))
+	tests := []struct {
+		path string
+		utc  bool
+		want string
+	}{
+		{"/var/log/app-{date}.log", false, "/var/log/app-2026-10-16.log"},
+		{"/var/log/app-{date}-{hour}.log", false, "/var/log/app-2026-10-16-09.log"},
+		{"/var/log/app-{date}-{hour}.log", true, "/var/log/app-2026-10-16-14.log"},
+		{"/var/log/{%Y}/{%m}/app-{%d}.log", false, "/var/log/2026/10/app-16.log"},
+		{"app-{%Y1%m-%%}.log", false, "app-2026110-%.log"},
+		{"app-{%F_%H%M%S}.log", false, "app-2026-10-16_090503.log"},
+		{"app-{time:2006-01-02T15}.log", false, "app-2026-10-16T09.log"},
+		{"app-{time:Jan}.log", false, "app-Oct.log"},
+		{"/tmp/{foo}/app-{date}.log", false, "/tmp/{foo}/app-2026-10-16.log"},
+		{"/tmp/{shard1}/{v2}/app-{date}.log", false, "/tmp/{shard1}/{v2}/app-2026-10-16.log"},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := parsePathTemplate(tt.path, tt.utc)
+		require.NoError(t, err, "Unexpected error parsing %q.", tt.path)
+		assert.Equal(t, tt.want, tmpl.expand(now), "Unexpected expansion of %q.", tt.path)
+	}
+}
+
+func TestPathTemplateWithoutPlaceholders(t *testing.T) {
+	for _, path := range []string{
+		"/var/log/app.log",
+		"/tmp/{foo}.log",
+		"/tmp/{shard1}.log",
+		"/tmp/{v2}.log",
+		"/tmp/{PM}.log",
+		"/tmp/{2006-01-02}.log",
+		"/tmp/{}.log",
+		"/tmp/{foo.log",
+		"/tmp/foo}.log",
+	} {
+		tmpl, err := parsePathTemplate(path, false)
+		assert.NoError(t, err, "Unexpected error parsing %q.", path)
+		assert.Nil(t, tmpl, "Expected no template for %q.", path)
+	}
+}
+
+func TestPathTemplateErrors(t *testing.T) {
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{"app-{%%}.log", "placeholder {%%} doesn't contain any time fields"},
+		{"app-{%Y%}.log", "incomplete strftime directive in {%Y%}"},
+		{"app-{%Q}.log", "unsupported strftime directive %Q in {%Q}"},
+		{"app-{time:}.log", "placeholder {time:} doesn't contain any time fields"},
+		{"app-{time:foo}.log", "placeholder {time:foo} doesn't contain any time fields"},
+	}
+
+	for _, tt := range tests {
+		_, err := parsePathTemplate(tt.path, false)
+		assert.EqualError(t, err, tt.err, "Unexpected error parsing %q.", tt.path)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"go.uber.org/multierr"
+)
+
+// A reopener is a Sink that can close and reopen its underlying file.
+type reopener interface {
+	Reopen() error
+}
+
+var (
+	_reopenMutex sync.Mutex
+	_reopeners   = make(map[reopener]struct{})
+)
+
+func trackReopener(r reopener) {
+	_reopenMutex.Lock()
+	_reopeners[r] = struct{}{}
+	_reopenMutex.Unlock()
+}
+
+func untrackReopener(r reopener) {
+	_reopenMutex.Lock()
+	delete(_reopeners, r)
+	_reopenMutex.Unlock()
+}
+
+// ReopenFileSinks closes and reopens the files behind every open sink with
+// the "file" or "rotate" scheme, including those opened by Config.Build.
+// Standard out and standard error are left alone.
+//
+// It's designed for use with external log rotation tools: once the tool has
+// moved a log file aside, reopening creates a fresh file at the original path
+// instead of writing to the renamed file forever. Writes are held off while
+// each file is swapped, so no log entries are split or lost.
+func ReopenFileSinks() error {
+	_reopenMutex.Lock()
+	rs := make([]reopener, 0, len(_reopeners))
+	for r := range _reopeners {
+		rs = append(rs, r)
+	}
+	_reopenMutex.Unlock()
+
+	var err error
+	for _, r := range rs {
+		err = multierr.Append(err, r.Reopen())
+	}
+	return err
+}
+
+// ReopenFileSinksOnSignal calls ReopenFileSinks each time the process receives
+// one of the supplied signals, typically syscall.SIGHUP. Errors are written to
+// standard error. It returns a function to stop handling the signals.
+//
+// For example, the following works with logrotate's default move-and-signal
+// behavior:
+//   stop := zap.ReopenFileSinksOnSignal(syscall.SIGHUP)
+//   defer stop()
+func ReopenFileSinksOnSignal(sigs ...os.Signal) func() {
+	return reopenOnSignal(zapcore.Lock(os.Stderr), sigs...)
+}
+
+func reopenOnSignal(errorOutput zapcore.WriteSyncer, sigs ...os.Signal) func() {
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	signal.Notify(c, sigs...)
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-c:
+				if err := ReopenFileSinks(); err != nil {
+					fmt.Fprintf(errorOutput, "%v reopen error: %v\n", time.Now(), err)
+					errorOutput.Sync()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+			<-stopped
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/internal/ztest"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestReopenFileSinks(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		plain := filepath.Join(dir, "plain.log")
+		rotated := filepath.Join(dir, "rotated.log")
+		tracked := numReopeners()
+		ws, cleanup, err := Open(plain, "rotate://"+rotated)
+		require.NoError(t, err, "Failed to open sinks.")
+
+		ws.Write([]byte("before\n"))
+		require.NoError(t, os.Rename(plain, plain+".1"))
+		require.NoError(t, os.Rename(rotated, rotated+".1"))
+		require.NoError(t, ReopenFileSinks(), "Unexpected error reopening file sinks.")
+		ws.Write([]byte("after\n"))
+
+		for _, path := range []string{plain, rotated} {
+			assert.Equal(t, "before\n", readFile(t, path+".1"), "Unexpected contents in moved file.")
+			assert.Equal(t, "after\n", readFile(t, path), "Unexpected contents in reopened file.")
+		}
+
+		assert.Equal(t, tracked+2, numReopeners(), "Expected file sinks to be tracked.")
+		cleanup()
+		assert.Equal(t, tracked, numReopeners(), "Expected closed sinks to stop being tracked.")
+	})
+}
+
+func numReopeners() int {
+	_reopenMutex.Lock()
+	defer _reopenMutex.Unlock()
+	return len(_reopeners)
+}
+
+func TestReopenFileSinksOnSignal(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		path := filepath.Join(dir, "app.log")
+		ws, cleanup, err := Open(path)
+		require.NoError(t, err, "Failed to open sink.")
+		defer cleanup()
+
+		errOut := &bytes.Buffer{}
+		stop := reopenOnSignal(zapcore.AddSync(errOut), syscall.SIGHUP)
+		defer stop()
+
+		require.NoError(t, os.Rename(path, path+".1"))
+		proc, err := os.FindProcess(os.Getpid())
+		require.NoError(t, err, "Failed to find current process.")
+		if err := proc.Signal(syscall.SIGHUP); err != nil {
+			t.Skipf("Can't send SIGHUP on this platform: %v", err)
+		}
+
+		deadline := time.Now().Add(ztest.Timeout(time.Second))
+		for !fileExists(path) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		require.True(t, fileExists(path), "Expected the signal to reopen the file sink.")
+
+		ws.Write([]byte("after\n"))
+		assert.Equal(t, "after\n", readFile(t, path), "Unexpected contents in reopened file.")
+		assert.Empty(t, errOut.String(), "Unexpected errors reopening file sinks.")
+
+		stop()
+		stop() // stopping twice is a no-op
+	})
+}
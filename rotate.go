@@ -0,0 +1,415 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"go.uber.org/multierr"
+)
+
+// Backup files are named after the active file, with the rotation time
+// inserted before the extension: app.log becomes
+// app-2018-08-06T15-04-05.000.log.
+const _backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// rotatingSink is a file-backed Sink that moves the active file aside and
+// starts a new one once it grows too large or a wall-clock interval passes.
+//
+// It's safe for concurrent use.
+type rotatingSink struct {
+	mu sync.Mutex
+
+	path       string
+	maxSize    int64                 // bytes; zero disables size-based rotation
+	maxBackups int                   // zero keeps every backup
+	interval   time.Duration         // zero disables time-based rotation
+	compressor *backgroundCompressor // nil disables compression
+	now        func() time.Time
+
+	file         *os.File // nil if closed, or if reopening the file failed
+	closed       bool
+	size         int64
+	nextRotation time.Time
+}
+
+// newRotatingSink builds a rotating file sink from a URL like
+//   rotate:///var/log/app.log?maxSize=100MB&maxBackups=7&interval=24h&compress=gzip
+//
+// The maxSize parameter accepts a plain number of bytes or a number suffixed
+// with KB, MB, or GB. The interval parameter accepts any string understood by
+// time.ParseDuration; rotations are aligned to multiples of the interval in
+// UTC, so an interval of 24h rotates at midnight UTC. If compress is set to
+// "gzip", backups are compressed in the background.
+func newRotatingSink(u *url.URL) (Sink, error) {
+	if err := checkLocalURL(u); err != nil {
+		return nil, err
+	}
+	if u.Path == "" {
+		return nil, fmt.Errorf("rotate URLs must include a file path: got %v", u)
+	}
+
+	s := &rotatingSink{
+		path: u.Path,
+		now:  time.Now,
+	}
+	for key, vals := range u.Query() {
+		if len(vals) != 1 {
+			return nil, fmt.Errorf("rotate URL parameter %q must be set exactly once: got %v", key, u)
+		}
+		if err := s.setOption(key, vals[0]); err != nil {
+			return nil, fmt.Errorf("invalid rotate URL parameter %q: %v", key, err)
+		}
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	trackReopener(s)
+	return s, nil
+}
+
+func (s *rotatingSink) setOption(key, val string) error {
+	var err error
+	switch key {
+	case "maxSize":
+		s.maxSize, err = parseSize(val)
+	case "maxBackups":
+		s.maxBackups, err = strconv.Atoi(val)
+		if err == nil && s.maxBackups < 0 {
+			err = errors.New("must not be negative")
+		}
+	case "interval":
+		s.interval, err = time.ParseDuration(val)
+		if err == nil && s.interval < 0 {
+			err = errors.New("must not be negative")
+		}
+	case "compress":
+		switch val {
+		case "gzip":
+			s.compressor = newBackgroundCompressor()
+		case "", "none":
+			s.compressor = nil
+		default:
+			err = fmt.Errorf("unsupported compression %q", val)
+		}
+	default:
+		err = errors.New("unknown parameter")
+	}
+	return err
+}
+
+func (s *rotatingSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.ensureOpen(); err != nil {
+		return 0, err
+	}
+	var rotateErr error
+	if s.shouldRotate(len(p)) {
+		rotateErr = s.rotate()
+		if s.file == nil {
+			return 0, rotateErr
+		}
+	}
+	// Even if rotating failed, there's still a file to write to.
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	return n, multierr.Append(rotateErr, err)
+}
+
+// ensureOpen opens the active file if an earlier attempt to reopen it
+// failed. Callers must hold the lock.
+func (s *rotatingSink) ensureOpen() error {
+	if s.closed {
+		return errors.New("rotating sink is closed")
+	}
+	if s.file == nil {
+		return s.open()
+	}
+	return nil
+}
+
+func (s *rotatingSink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+// Close closes the active file and waits for any in-flight compression of
+// backups to finish.
+func (s *rotatingSink) Close() error {
+	untrackReopener(s)
+
+	err := s.closeFile()
+	// Wait without holding the lock, since compression may retry with
+	// backoff.
+	if s.compressor != nil {
+		s.compressor.wait()
+	}
+	return err
+}
+
+func (s *rotatingSink) closeFile() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *rotatingSink) setErrorOutput(ws zapcore.WriteSyncer) {
+	if s.compressor != nil {
+		s.compressor.setErrorOutput(ws)
+	}
+}
+
+// Reopen closes and reopens the active file without rotating it, which
+// accommodates external tools that move the file aside.
+func (s *rotatingSink) Reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	if s.file == nil {
+		return s.open()
+	}
+	// Open the new file first, so that a failure leaves the sink writing to
+	// the old one.
+	old := s.file
+	if err := s.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+// Rotate forces a rotation, regardless of the configured size and interval.
+func (s *rotatingSink) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.ensureOpen(); err != nil {
+		return err
+	}
+	return s.rotate()
+}
+
+func (s *rotatingSink) shouldRotate(n int) bool {
+	if s.interval > 0 && !s.now().Before(s.nextRotation) {
+		return true
+	}
+	// Never rotate an empty file, even if a single write exceeds maxSize.
+	return s.maxSize > 0 && s.size > 0 && s.size+int64(n) > s.maxSize
+}
+
+// open opens (or creates) the active file. Callers must hold the lock, except
+// during construction.
+func (s *rotatingSink) open() error {
+	f, err := openLogFile(s.path, _defaultFileMode)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	if s.interval > 0 {
+		s.nextRotation = s.now().Truncate(s.interval).Add(s.interval)
+	}
+	return nil
+}
+
+// rotate moves the active file to a timestamped backup, opens a fresh file,
+// and prunes old backups. If it can't open a file, it leaves s.file nil, and
+// the next write tries again. Callers must hold the lock.
+func (s *rotatingSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+
+	backup := s.backupName()
+	if err := os.Rename(s.path, backup); err != nil {
+		if !os.IsNotExist(err) {
+			// Keep writing to the original file rather than losing logs.
+			if openErr := s.open(); openErr != nil {
+				return openErr
+			}
+			return fmt.Errorf("can't rotate %q: %v", s.path, err)
+		}
+		backup = ""
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	if backup != "" && s.compressor != nil {
+		s.compressor.compress(backup)
+	}
+	return s.prune()
+}
+
+// backupName returns an unused name for a backup of the active file.
+func (s *rotatingSink) backupName() string {
+	dir, prefix, ext := s.backupParts()
+	t := s.now().UTC()
+	for {
+		name := filepath.Join(dir, prefix+t.Format(_backupTimeFormat)+ext)
+		_, err := os.Lstat(name)
+		_, gzErr := os.Lstat(name + _compressedSuffix)
+		if os.IsNotExist(err) && os.IsNotExist(gzErr) {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// backupParts splits the active file's path into the directory, the prefix
+// shared by all backups, and the extension.
+func (s *rotatingSink) backupParts() (dir, prefix, ext string) {
+	dir, base := filepath.Split(s.path)
+	ext = filepath.Ext(base)
+	return dir, strings.TrimSuffix(base, ext) + "-", ext
+}
+
+type backupFile struct {
+	names []string // both the plain and compressed names exist mid-compression
+	t     time.Time
+}
+
+// backups lists the existing backups of the active file, newest first.
+func (s *rotatingSink) backups() ([]backupFile, error) {
+	dir, prefix, ext := s.backupParts()
+	if dir == "" {
+		dir = "."
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backupFile
+	byStamp := make(map[string]int)
+	for _, info := range infos {
+		name := info.Name()
+		trimmed := strings.TrimSuffix(name, _compressedSuffix)
+		if info.IsDir() || !strings.HasPrefix(trimmed, prefix) || !strings.HasSuffix(trimmed, ext) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(trimmed, prefix), ext)
+		t, err := time.Parse(_backupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if i, ok := byStamp[stamp]; ok {
+			backups[i].names = append(backups[i].names, path)
+			continue
+		}
+		byStamp[stamp] = len(backups)
+		backups = append(backups, backupFile{[]string{path}, t})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].t.After(backups[j].t)
+	})
+	return backups, nil
+}
+
+// prune removes the oldest backups beyond maxBackups. Callers must hold the
+// lock.
+func (s *rotatingSink) prune() error {
+	if s.maxBackups == 0 {
+		return nil
+	}
+	backups, err := s.backups()
+	if err != nil || len(backups) <= s.maxBackups {
+		return err
+	}
+	for _, b := range backups[s.maxBackups:] {
+		for _, name := range b.names {
+			if rmErr := os.Remove(name); rmErr != nil && !os.IsNotExist(rmErr) {
+				err = multierr.Append(err, rmErr)
+			}
+		}
+	}
+	return err
+}
+
+// parseSize parses a byte count like "512", "64KB", "100MB", or "1GB". Units
+// are powers of 1024 and case-insensitive.
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	scale := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper = strings.TrimSpace(strings.TrimSuffix(upper, u.suffix))
+			scale = u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("can't parse %q as a size", s)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("size %q must not be negative", s)
+	}
+	if n > math.MaxInt64/scale {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * scale, nil
+}
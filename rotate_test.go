@@ -0,0 +1,344 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withTempDir(t testing.TB, f func(dir string)) {
+	dir, err := ioutil.TempDir("", "zap-test")
+	require.NoError(t, err, "Failed to create temporary directory.")
+	defer os.RemoveAll(dir)
+	f(dir)
+}
+
+func readDir(t testing.TB, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err, "Failed to list directory.")
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readFile(t testing.TB, name string) string {
+	contents, err := ioutil.ReadFile(name)
+	require.NoError(t, err, "Failed to read file %q.", name)
+	return string(contents)
+}
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time       { return c.t }
+func (c *fakeClock) Add(d time.Duration)  { c.t = c.t.Add(d) }
+func newFakeClock(t time.Time) *fakeClock { return &fakeClock{t} }
+func rotateURL(path, query string) *url.URL {
+	return &url.URL{Scheme: schemeRotate, Path: path, RawQuery: query}
+}
+
+func openRotatingSink(t testing.TB, path, query string, clock *fakeClock) *rotatingSink {
+	sink, err := newRotatingSink(rotateURL(path, query))
+	require.NoError(t, err, "Failed to open rotating sink.")
+	s := sink.(*rotatingSink)
+	if clock != nil {
+		s.now = clock.Now
+		s.nextRotation = clock.Now().Truncate(s.interval).Add(s.interval)
+	}
+	return s
+}
+
+func TestRotatingSinkBySize(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		clock := newFakeClock(time.Date(2018, 8, 6, 15, 4, 5, 0, time.UTC))
+		path := filepath.Join(dir, "app.log")
+		s := openRotatingSink(t, path, "maxSize=10", nil)
+		s.now = clock.Now
+		defer s.Close()
+
+		for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n"} {
+			_, err := s.Write([]byte(line))
+			require.NoError(t, err, "Unexpected error writing to rotating sink.")
+			clock.Add(time.Second)
+		}
+		assert.NoError(t, s.Sync(), "Unexpected error syncing rotating sink.")
+
+		assert.Equal(t, []string{"app-2018-08-06T15-04-07.000.log", "app.log"}, readDir(t, dir), "Unexpected files after rotation.")
+		assert.Equal(t, "aaaa\nbbbb\n", readFile(t, filepath.Join(dir, "app-2018-08-06T15-04-07.000.log")), "Unexpected backup contents.")
+		assert.Equal(t, "cccc\n", readFile(t, path), "Unexpected active file contents.")
+	})
+}
+
+func TestRotatingSinkOversizedWrite(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		s := openRotatingSink(t, filepath.Join(dir, "app.log"), "maxSize=4", nil)
+		defer s.Close()
+
+		_, err := s.Write([]byte("much too long\n"))
+		require.NoError(t, err, "Unexpected error writing to rotating sink.")
+		assert.Equal(t, []string{"app.log"}, readDir(t, dir), "Expected an oversized write to an empty file not to rotate.")
+	})
+}
+
+func TestRotatingSinkByInterval(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		clock := newFakeClock(time.Date(2018, 8, 6, 23, 59, 0, 0, time.UTC))
+		path := filepath.Join(dir, "app.log")
+		s := openRotatingSink(t, path, "interval=24h", clock)
+		defer s.Close()
+
+		s.Write([]byte("monday\n"))
+		clock.Add(30 * time.Second)
+		s.Write([]byte("still monday\n"))
+		clock.Add(time.Minute)
+		s.Write([]byte("tuesday\n"))
+
+		assert.Equal(t, []string{"app-2018-08-07T00-00-30.000.log", "app.log"}, readDir(t, dir), "Unexpected files after rotation.")
+		assert.Equal(t, "monday\nstill monday\n", readFile(t, filepath.Join(dir, "app-2018-08-07T00-00-30.000.log")), "Unexpected backup contents.")
+		assert.Equal(t, "tuesday\n", readFile(t, path), "Unexpected active file contents.")
+	})
+}
+
+func TestRotatingSinkMaxBackups(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		clock := newFakeClock(time.Date(2018, 8, 6, 0, 0, 0, 0, time.UTC))
+		s := openRotatingSink(t, filepath.Join(dir, "app.log"), "maxBackups=2", nil)
+		s.now = clock.Now
+		defer s.Close()
+
+		for i := 0; i < 4; i++ {
+			s.Write([]byte("log\n"))
+			require.NoError(t, s.Rotate(), "Unexpected error forcing rotation.")
+			clock.Add(time.Hour)
+		}
+		// Unrelated files in the same directory must be left alone.
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app-notes.log"), nil, 0644))
+		s.Write([]byte("log\n"))
+		require.NoError(t, s.Rotate(), "Unexpected error forcing rotation.")
+
+		assert.Equal(t, []string{
+			"app-2018-08-06T03-00-00.000.log",
+			"app-2018-08-06T04-00-00.000.log",
+			"app-notes.log",
+			"app.log",
+		}, readDir(t, dir), "Unexpected files after pruning backups.")
+	})
+}
+
+func TestRotatingSinkBackupNameCollision(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		clock := newFakeClock(time.Date(2018, 8, 6, 0, 0, 0, 0, time.UTC))
+		s := openRotatingSink(t, filepath.Join(dir, "app"), "", nil)
+		s.now = clock.Now
+		defer s.Close()
+
+		require.NoError(t, s.Rotate(), "Unexpected error forcing rotation.")
+		require.NoError(t, s.Rotate(), "Unexpected error forcing rotation.")
+		assert.Equal(t, []string{
+			"app",
+			"app-2018-08-06T00-00-00.000",
+			"app-2018-08-06T00-00-00.001",
+		}, readDir(t, dir), "Expected backups with colliding timestamps to get unique names.")
+	})
+}
+
+func TestRotatingSinkClosed(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		s := openRotatingSink(t, filepath.Join(dir, "app.log"), "", nil)
+		require.NoError(t, s.Close(), "Unexpected error closing rotating sink.")
+		assert.NoError(t, s.Close(), "Expected closing twice to be a no-op.")
+		assert.NoError(t, s.Sync(), "Expected syncing a closed sink to be a no-op.")
+
+		_, err := s.Write([]byte("foo"))
+		assert.Error(t, err, "Expected writing to a closed sink to fail.")
+		assert.Error(t, s.Rotate(), "Expected rotating a closed sink to fail.")
+	})
+}
+
+func TestRotatingSinkReopenFailure(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		logDir := filepath.Join(dir, "logs")
+		require.NoError(t, os.Mkdir(logDir, 0755), "Failed to create log directory.")
+		path := filepath.Join(logDir, "app.log")
+		s := openRotatingSink(t, path, "", nil)
+		defer s.Close()
+
+		require.NoError(t, os.Rename(logDir, logDir+".old"), "Failed to move log directory.")
+		assert.Error(t, s.Reopen(), "Expected reopening to fail without the log directory.")
+		_, err := s.Write([]byte("foo\n"))
+		assert.NoError(t, err, "Expected writes to go to the old file after a failed reopen.")
+
+		require.NoError(t, os.Mkdir(logDir, 0755), "Failed to recreate log directory.")
+		require.NoError(t, s.Reopen(), "Expected a later reopen to succeed.")
+		_, err = s.Write([]byte("bar\n"))
+		assert.NoError(t, err, "Unexpected error writing after reopening.")
+		assert.Equal(t, "foo\n", readFile(t, filepath.Join(logDir+".old", "app.log")), "Unexpected contents in the old file.")
+		assert.Equal(t, "bar\n", readFile(t, path), "Unexpected contents in the reopened file.")
+	})
+}
+
+func TestRotatingSinkRecoversFromFailedRotation(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		logDir := filepath.Join(dir, "logs")
+		require.NoError(t, os.Mkdir(logDir, 0755), "Failed to create log directory.")
+		path := filepath.Join(logDir, "app.log")
+		s := openRotatingSink(t, path, "maxSize=4", nil)
+		defer s.Close()
+
+		_, err := s.Write([]byte("foo\n"))
+		require.NoError(t, err, "Unexpected error writing.")
+		require.NoError(t, os.RemoveAll(logDir), "Failed to remove log directory.")
+		_, err = s.Write([]byte("bar\n"))
+		assert.Error(t, err, "Expected an error when there's no file to rotate to.")
+		_, err = s.Write([]byte("baz\n"))
+		assert.Error(t, err, "Expected writes to fail until the file can be opened.")
+
+		require.NoError(t, os.Mkdir(logDir, 0755), "Failed to recreate log directory.")
+		_, err = s.Write([]byte("qux\n"))
+		assert.NoError(t, err, "Expected writes to reopen the file.")
+		assert.Equal(t, "qux\n", readFile(t, path), "Unexpected contents in the reopened file.")
+
+		require.NoError(t, os.RemoveAll(logDir), "Failed to remove log directory.")
+		s.Rotate()
+		require.NoError(t, os.Mkdir(logDir, 0755), "Failed to recreate log directory.")
+		assert.NoError(t, s.Reopen(), "Expected Reopen to recover a sink without a file.")
+		_, err = s.Write([]byte("quux\n"))
+		assert.NoError(t, err, "Unexpected error writing after reopening.")
+		assert.Equal(t, "quux\n", readFile(t, path), "Unexpected contents in the reopened file.")
+	})
+}
+
+func TestOpenRotatingSink(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		path := filepath.Join(dir, "app.log")
+		ws, cleanup, err := Open("rotate://" + path + "?maxSize=1KB&maxBackups=3&interval=1h")
+		require.NoError(t, err, "Failed to open rotate URL.")
+		defer cleanup()
+
+		_, err = ws.Write([]byte("foo\n"))
+		assert.NoError(t, err, "Unexpected error writing to rotating sink.")
+		assert.Equal(t, "foo\n", readFile(t, path), "Unexpected file contents.")
+	})
+}
+
+func TestRotatingSinkURLErrors(t *testing.T) {
+	tests := []struct {
+		url string
+		err string
+	}{
+		{"rotate://", "must include a file path"},
+		{"rotate://host01.test.com/tmp/app.log", "must leave host empty or use localhost"},
+		{"rotate://rms@localhost/tmp/app.log", "user and password not allowed"},
+		{"rotate:///tmp/app.log#foo", "fragments not allowed"},
+		{"rotate://localhost:8080/tmp/app.log", "ports not allowed"},
+		{"rotate:///tmp/app.log?maxSize=lots", `invalid rotate URL parameter "maxSize"`},
+		{"rotate:///tmp/app.log?maxSize=-1", "must not be negative"},
+		{"rotate:///tmp/app.log?maxBackups=-1", "must not be negative"},
+		{"rotate:///tmp/app.log?interval=-1h", "must not be negative"},
+		{"rotate:///tmp/app.log?interval=daily", `invalid rotate URL parameter "interval"`},
+		{"rotate:///tmp/app.log?bogus=true", "unknown parameter"},
+		{"rotate:///tmp/app.log?maxBackups=1&maxBackups=2", "must be set exactly once"},
+		{"rotate:///non-existent-dir/app.log", "no such file or directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, _, err := Open(tt.url)
+			if assert.Error(t, err, "Expected an error opening %q.", tt.url) {
+				assert.Contains(t, err.Error(), tt.err, "Unexpected error opening %q.", tt.url)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  bool
+	}{
+		{"0", 0, false},
+		{"512", 512, false},
+		{"512B", 512, false},
+		{"64kb", 64 << 10, false},
+		{"100MB", 100 << 20, false},
+		{" 2 GB ", 2 << 30, false},
+		{"", 0, true},
+		{"MB", 0, true},
+		{"1.5MB", 0, true},
+		{"-1KB", 0, true},
+		{"8589934591GB", 8589934591 << 30, false},
+		{"8589934592GB", 0, true},
+		{"9000000000000GB", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if tt.err {
+			assert.Error(t, err, "Expected an error parsing %q.", tt.in)
+			continue
+		}
+		if assert.NoError(t, err, "Unexpected error parsing %q.", tt.in) {
+			assert.Equal(t, tt.want, got, "Unexpected result parsing %q.", tt.in)
+		}
+	}
+}
+
+func TestRotatingSinkCompression(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		clock := newFakeClock(time.Date(2018, 8, 6, 0, 0, 0, 0, time.UTC))
+		s := openRotatingSink(t, filepath.Join(dir, "app.log"), "compress=gzip&maxBackups=2", nil)
+		s.now = clock.Now
+
+		for _, line := range []string{"one\n", "two\n", "three\n"} {
+			s.Write([]byte(line))
+			require.NoError(t, s.Rotate(), "Unexpected error forcing rotation.")
+			s.compressor.wait()
+			clock.Add(time.Hour)
+		}
+		require.NoError(t, s.Close(), "Unexpected error closing rotating sink.")
+
+		assert.Equal(t, []string{
+			"app-2018-08-06T01-00-00.000.log.gz",
+			"app-2018-08-06T02-00-00.000.log.gz",
+			"app.log",
+		}, readDir(t, dir), "Unexpected files after compressing and pruning backups.")
+		assert.Equal(t, "three\n", readGzipFile(t, filepath.Join(dir, "app-2018-08-06T02-00-00.000.log.gz")), "Unexpected decompressed backup.")
+	})
+}
+
+func TestRotatingSinkUnsupportedCompression(t *testing.T) {
+	_, err := newRotatingSink(rotateURL("/tmp/app.log", "compress=zstd"))
+	if assert.Error(t, err, "Expected an error for an unsupported compression format.") {
+		assert.Contains(t, err.Error(), `unsupported compression "zstd"`, "Unexpected error.")
+	}
+}
@@ -21,6 +21,7 @@
 package zap
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -32,7 +33,10 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-const schemeFile = "file"
+const (
+	schemeFile   = "file"
+	schemeRotate = "rotate"
+)
 
 var (
 	_sinkMutex     sync.RWMutex
@@ -48,7 +52,17 @@ func resetSinkRegistry() {
 	defer _sinkMutex.Unlock()
 
 	_sinkFactories = map[string]func(*url.URL) (Sink, error){
-		schemeFile: newFileSink,
+		schemeFile:     newFileSink,
+		schemeRotate:   newRotatingSink,
+		schemeTCP:      newNetSink,
+		schemeUDP:      newNetSink,
+		schemeUnix:     newNetSink,
+		schemeSyslog:   newSyslogSink,
+		schemeGELF:     newGELFSink,
+		schemeJournald: newJournaldSink,
+		schemeHTTP:     newHTTPSink,
+		schemeHTTPS:    newHTTPSink,
+		schemeMemory:   newMemorySink,
 	}
 }
 
@@ -58,10 +72,60 @@ type Sink interface {
 	io.Closer
 }
 
+// A ContextCloser is a Sink whose Close method can be cut short, which
+// bounds how long shutdown waits on a hung destination; the function returned
+// by Config.BuildWithCloseContext passes its context along. CloseContext should
+// return ctx's error promptly once ctx is done; any remaining work may
+// continue in the background. Sinks that can block while syncing should
+// also implement zapcore.ContextSyncer.
+type ContextCloser interface {
+	CloseContext(ctx context.Context) error
+}
+
+// closeContext closes a Sink, returning early with ctx's error if ctx is
+// done first.
+func closeContext(ctx context.Context, sink Sink) error {
+	if cc, ok := sink.(ContextCloser); ok {
+		return cc.CloseContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- sink.Close() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 type nopCloserSink struct{ zapcore.WriteSyncer }
 
 func (nopCloserSink) Close() error { return nil }
 
+// An errorReporter is a Sink that does work in the background and can report
+// failures to a Logger's error output. Config.Build wires each such Sink to the
+// Logger's ErrorOutputPaths; otherwise, errors go to standard error.
+type errorReporter interface {
+	setErrorOutput(zapcore.WriteSyncer)
+}
+
+// A syslogConfigurer is a Sink that may carry options for the "syslog"
+// encoder, like the facility and the header fields set in a syslog URL.
+// Config.Build passes them to the encoder.
+type syslogConfigurer interface {
+	syslogOptions() (zapcore.SyslogOptions, bool)
+}
+
+func sinkSyslogOptions(ws zapcore.WriteSyncer) (zapcore.SyslogOptions, bool) {
+	if c, ok := ws.(syslogConfigurer); ok {
+		return c.syslogOptions()
+	}
+	return zapcore.SyslogOptions{}, false
+}
+
 type errSinkNotFound struct {
 	scheme string
 }
@@ -75,8 +139,9 @@ func (e *errSinkNotFound) Error() string {
 //
 // All schemes must be ASCII, valid under section 3.1 of RFC 3986
 // (https://tools.ietf.org/html/rfc3986#section-3.1), and must not already
-// have a factory registered. Zap automatically registers a factory for the
-// "file" scheme.
+// have a factory registered. Zap automatically registers factories for the
+// "file", "rotate", "tcp", "udp", "unix", "syslog", "gelf", "journald",
+// "http", "https", and "memory" schemes.
 func RegisterSink(scheme string, factory func(*url.URL) (Sink, error)) error {
 	_sinkMutex.Lock()
 	defer _sinkMutex.Unlock()
@@ -114,29 +179,49 @@ func newSink(rawURL string) (Sink, error) {
 }
 
 func newFileSink(u *url.URL) (Sink, error) {
+	if err := checkLocalURL(u); err != nil {
+		return nil, err
+	}
+	switch u.Path {
+	case "stdout", "stderr":
+		if u.RawQuery != "" {
+			return nil, fmt.Errorf("query parameters not allowed with %s: got %v", u.Path, u)
+		}
+		if u.Path == "stdout" {
+			return nopCloserSink{os.Stdout}, nil
+		}
+		return nopCloserSink{os.Stderr}, nil
+	}
+
+	opts := defaultFileOptions()
+	for key, vals := range u.Query() {
+		if len(vals) != 1 {
+			return nil, fmt.Errorf("file URL parameter %q must be set exactly once: got %v", key, u)
+		}
+		if err := opts.setOption(key, vals[0]); err != nil {
+			return nil, fmt.Errorf("invalid file URL parameter %q: %v", key, err)
+		}
+	}
+	return openFileSink(u.Path, opts)
+}
+
+// checkLocalURL validates the parts of a URL that must be empty (or
+// "localhost") for sinks that write to the local filesystem.
+func checkLocalURL(u *url.URL) error {
 	if u.User != nil {
-		return nil, fmt.Errorf("user and password not allowed with file URLs: got %v", u)
+		return fmt.Errorf("user and password not allowed with %s URLs: got %v", u.Scheme, u)
 	}
 	if u.Fragment != "" {
-		return nil, fmt.Errorf("fragments not allowed with file URLs: got %v", u)
-	}
-	if u.RawQuery != "" {
-		return nil, fmt.Errorf("query parameters not allowed with file URLs: got %v", u)
+		return fmt.Errorf("fragments not allowed with %s URLs: got %v", u.Scheme, u)
 	}
 	// Error messages are better if we check hostname and port separately.
 	if u.Port() != "" {
-		return nil, fmt.Errorf("ports not allowed with file URLs: got %v", u)
+		return fmt.Errorf("ports not allowed with %s URLs: got %v", u.Scheme, u)
 	}
 	if hn := u.Hostname(); hn != "" && hn != "localhost" {
-		return nil, fmt.Errorf("file URLs must leave host empty or use localhost: got %v", u)
+		return fmt.Errorf("%s URLs must leave host empty or use localhost: got %v", u.Scheme, u)
 	}
-	switch u.Path {
-	case "stdout":
-		return nopCloserSink{os.Stdout}, nil
-	case "stderr":
-		return nopCloserSink{os.Stderr}, nil
-	}
-	return os.OpenFile(u.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	return nil
 }
 
 func normalizeScheme(s string) (string, error) {
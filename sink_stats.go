@@ -0,0 +1,234 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	_statsMutex sync.RWMutex
+	_statsSinks = make(map[*trackedSink]struct{})
+)
+
+// SinkStats describes the output written to a Sink.
+type SinkStats struct {
+	// URL identifies the sink. Sinks opened by Open and by Config's Build
+	// methods use the URL they were opened with, minus any password and query
+	// parameters.
+	URL string
+
+	Entries      int64 // calls to Write
+	BytesWritten int64
+	WriteErrors  int64
+	SyncErrors   int64
+	Dropped      int64 // entries discarded because the sink fell behind
+
+	LastError     error     // from the most recent failed Write or Sync
+	LastErrorTime time.Time // zero if nothing has failed
+	LastWrite     time.Time // of the most recent successful Write
+	LastSync      time.Time // of the most recent successful Sync
+}
+
+// Healthy reports whether the most recent Write or Sync succeeded.
+func (s SinkStats) Healthy() bool {
+	if s.LastError == nil {
+		return true
+	}
+	return s.LastErrorTime.Before(s.LastWrite) || s.LastErrorTime.Before(s.LastSync)
+}
+
+// A dropError is returned by the Write calls of sinks that discard entries
+// when they fall behind, so that statsSink can count them.
+type dropError struct {
+	entries int
+	reason  string
+}
+
+func (e *dropError) Error() string {
+	if e.entries == 1 {
+		return "dropped log entry: " + e.reason
+	}
+	return fmt.Sprintf("dropped %d log entries: %s", e.entries, e.reason)
+}
+
+// A StatsSink is a Sink that reports statistics about its output. Sinks that
+// write in the background may implement it to report on delivery rather than
+// on calls to Write; Open counts the calls to Write and Sync for all other
+// sinks.
+type StatsSink interface {
+	Sink
+	Stats() SinkStats
+}
+
+// AllSinkStats returns the statistics of every sink opened by Open or by
+// Config's Build methods that hasn't yet been closed, sorted by URL. It's
+// intended for health checks and metrics collection.
+func AllSinkStats() []SinkStats {
+	_statsMutex.RLock()
+	stats := make([]SinkStats, 0, len(_statsSinks))
+	for s := range _statsSinks {
+		st := s.StatsSink.Stats()
+		st.URL = s.url
+		stats = append(stats, st)
+	}
+	_statsMutex.RUnlock()
+
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].URL < stats[j].URL })
+	return stats
+}
+
+// trackSink adds a freshly-opened sink to the registry used by AllSinkStats,
+// wrapping it to count its output if necessary. Closing the returned Sink
+// removes it from the registry.
+func trackSink(rawURL string, sink Sink) Sink {
+	ss, ok := sink.(StatsSink)
+	if !ok {
+		ss = &statsSink{Sink: sink}
+	}
+	t := &trackedSink{StatsSink: ss, url: redactSinkURL(rawURL)}
+
+	_statsMutex.Lock()
+	_statsSinks[t] = struct{}{}
+	_statsMutex.Unlock()
+	return t
+}
+
+// redactSinkURL strips secrets, like passwords and authorization headers,
+// from a sink's URL.
+func redactSinkURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	u.RawQuery = ""
+	u.ForceQuery = false
+	return u.String()
+}
+
+type trackedSink struct {
+	StatsSink
+	url string
+}
+
+func (s *trackedSink) Close() error {
+	return s.CloseContext(context.Background())
+}
+
+func (s *trackedSink) CloseContext(ctx context.Context) error {
+	_statsMutex.Lock()
+	delete(_statsSinks, s)
+	_statsMutex.Unlock()
+	return closeContext(ctx, s.StatsSink)
+}
+
+func (s *trackedSink) SyncContext(ctx context.Context) error {
+	return zapcore.SyncContext(ctx, s.StatsSink)
+}
+
+func (s *trackedSink) setErrorOutput(ws zapcore.WriteSyncer) {
+	if r, ok := s.StatsSink.(errorReporter); ok {
+		r.setErrorOutput(ws)
+	}
+}
+
+func (s *trackedSink) syslogOptions() (zapcore.SyslogOptions, bool) {
+	return sinkSyslogOptions(s.StatsSink)
+}
+
+// statsSink counts the calls to a Sink's Write and Sync methods.
+type statsSink struct {
+	Sink
+
+	mu    sync.Mutex
+	stats SinkStats
+}
+
+func (s *statsSink) Write(bs []byte) (int, error) {
+	n, err := s.Sink.Write(bs)
+	now := time.Now()
+
+	s.mu.Lock()
+	s.stats.Entries++
+	s.stats.BytesWritten += int64(n)
+	if err != nil {
+		s.stats.WriteErrors++
+		s.stats.LastError = err
+		s.stats.LastErrorTime = now
+	} else {
+		s.stats.LastWrite = now
+	}
+	if de, ok := err.(*dropError); ok {
+		s.stats.Dropped += int64(de.entries)
+	}
+	s.mu.Unlock()
+	return n, err
+}
+
+func (s *statsSink) Sync() error {
+	return s.SyncContext(context.Background())
+}
+
+func (s *statsSink) SyncContext(ctx context.Context) error {
+	err := zapcore.SyncContext(ctx, s.Sink)
+	now := time.Now()
+
+	s.mu.Lock()
+	if err != nil {
+		s.stats.SyncErrors++
+		s.stats.LastError = err
+		s.stats.LastErrorTime = now
+	} else {
+		s.stats.LastSync = now
+	}
+	s.mu.Unlock()
+	return err
+}
+
+func (s *statsSink) CloseContext(ctx context.Context) error {
+	return closeContext(ctx, s.Sink)
+}
+
+func (s *statsSink) Stats() SinkStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+func (s *statsSink) setErrorOutput(ws zapcore.WriteSyncer) {
+	if r, ok := s.Sink.(errorReporter); ok {
+		r.setErrorOutput(ws)
+	}
+}
+
+func (s *statsSink) syslogOptions() (zapcore.SyslogOptions, bool) {
+	return sinkSyslogOptions(s.Sink)
+}
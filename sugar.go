@@ -21,6 +21,7 @@
 package zap
 
 import (
+	"context"
 	"fmt"
 
 	"go.uber.org/zap/zapcore"
@@ -215,6 +216,11 @@ func (s *SugaredLogger) Sync() error {
 	return s.base.Sync()
 }
 
+// SyncContext flushes any buffered log entries, giving up once ctx is done.
+func (s *SugaredLogger) SyncContext(ctx context.Context) error {
+	return s.base.SyncContext(ctx)
+}
+
 func (s *SugaredLogger) log(lvl zapcore.Level, template string, fmtArgs []interface{}, context []interface{}) {
 	// If logging at this level is completely disabled, skip the overhead of
 	// string formatting.
@@ -0,0 +1,169 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const schemeSyslog = "syslog"
+
+// Local syslog daemons listen on one of these sockets; see log/syslog.
+var _syslogSocketPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogSink is a Sink that delivers log entries to a syslog daemon. Entries
+// should be encoded with the "syslog" encoder, which Config builds with the
+// sink's options; the sink only removes the trailing line ending, since each
+// datagram or octet-counted frame carries a single message.
+type syslogSink struct {
+	*netSink
+
+	opts zapcore.SyslogOptions
+}
+
+// newSyslogSink builds a syslog sink from URLs like
+//   syslog://                       (the local syslog socket)
+//   syslog:///dev/log?facility=local0&appName=api
+//   syslog://collector:514?network=tcp&format=rfc5424
+//
+// See Open for the supported query parameters.
+func newSyslogSink(u *url.URL) (Sink, error) {
+	if u.User != nil {
+		return nil, fmt.Errorf("user and password not allowed with syslog URLs: got %v", u)
+	}
+	if u.Fragment != "" {
+		return nil, fmt.Errorf("fragments not allowed with syslog URLs: got %v", u)
+	}
+	query := u.Query()
+	for key, vals := range query {
+		if len(vals) != 1 {
+			return nil, fmt.Errorf("syslog URL parameter %q must be set exactly once: got %v", key, u)
+		}
+	}
+
+	network, address, err := syslogAddress(u, query.Get("network"))
+	if err != nil {
+		return nil, err
+	}
+	cfg := defaultNetSinkConfig(network, address)
+	if network == "tcp" {
+		cfg.framing = frameOctet
+	}
+	s := &syslogSink{}
+	if u.Host == "" {
+		s.opts.Format = zapcore.SyslogRFC3164Local
+	}
+	for key, vals := range query {
+		if key == "network" {
+			continue
+		}
+		if err := s.setOption(&cfg, key, vals[0], u.Host == ""); err != nil {
+			return nil, fmt.Errorf("invalid syslog URL parameter %q: %v", key, err)
+		}
+	}
+	s.netSink = startNetSink(cfg, net.DialTimeout)
+	return s, nil
+}
+
+// syslogAddress determines the network and address to dial.
+func syslogAddress(u *url.URL, network string) (string, string, error) {
+	if u.Host == "" {
+		switch network {
+		case "":
+			network = "unixgram"
+		case "unixgram", "unix":
+		default:
+			return "", "", fmt.Errorf(`syslog URLs without a host must use the "unixgram" or "unix" network: got %v`, u)
+		}
+		if u.Path != "" {
+			return network, u.Path, nil
+		}
+		for _, path := range _syslogSocketPaths {
+			if _, err := os.Stat(path); err == nil {
+				return network, path, nil
+			}
+		}
+		return "", "", errors.New("can't find the local syslog socket")
+	}
+
+	switch network {
+	case "":
+		network = "udp"
+	case "udp", "tcp":
+	default:
+		return "", "", fmt.Errorf(`syslog URLs with a host must use the "udp" or "tcp" network: got %v`, u)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return "", "", fmt.Errorf("paths not allowed with syslog URLs that include a host: got %v", u)
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "514")
+	}
+	return network, address, nil
+}
+
+func (s *syslogSink) setOption(cfg *netSinkConfig, key, val string, local bool) error {
+	switch key {
+	case "format":
+		switch val {
+		case "rfc5424":
+			s.opts.Format = zapcore.SyslogRFC5424
+		case "rfc3164":
+			s.opts.Format = zapcore.SyslogRFC3164
+			if local {
+				s.opts.Format = zapcore.SyslogRFC3164Local
+			}
+		default:
+			return fmt.Errorf(`must be "rfc5424" or "rfc3164", got %q`, val)
+		}
+	case "facility":
+		return s.opts.Facility.UnmarshalText([]byte(val))
+	case "hostname":
+		s.opts.Hostname = val
+	case "appName":
+		s.opts.AppName = val
+	case "procID":
+		s.opts.ProcID = val
+	default:
+		return cfg.setOption(key, val)
+	}
+	return nil
+}
+
+// syslogOptions implements syslogConfigurer.
+func (s *syslogSink) syslogOptions() (zapcore.SyslogOptions, bool) {
+	return s.opts, true
+}
+
+func (s *syslogSink) Write(p []byte) (int, error) {
+	if _, err := s.netSink.Write(bytes.TrimRight(p, "\r\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zap
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/internal/ztest"
+	"go.uber.org/zap/zapcore"
+)
+
+func readDatagram(t testing.TB, conn net.PacketConn) string {
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(ztest.Timeout(time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err, "Failed to read datagram.")
+	return string(buf[:n])
+}
+
+const _testSyslogMessage = `<14>1 2018-02-03T04:05:06.000007Z myhost myapp 42 - [zap@32473 foo="bar"] hello` + "\n"
+
+func TestSyslogSinkLocal(t *testing.T) {
+	withTempDir(t, func(dir string) {
+		path := filepath.Join(dir, "log.sock")
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+		require.NoError(t, err, "Failed to listen.")
+		defer conn.Close()
+
+		ws, cleanup, err := Open("syslog://" + path)
+		require.NoError(t, err, "Failed to open syslog sink.")
+		defer cleanup()
+
+		ws.Write([]byte(_testSyslogMessage))
+		assert.Equal(
+			t,
+			strings.TrimSuffix(_testSyslogMessage, "\n"),
+			readDatagram(t, conn),
+			"Expected the message without its line ending.",
+		)
+	})
+}
+
+func TestSyslogSinkRemote(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen.")
+	defer conn.Close()
+
+	ws, cleanup, err := Open("syslog://" + conn.LocalAddr().String())
+	require.NoError(t, err, "Failed to open syslog sink.")
+	defer cleanup()
+
+	ws.Write([]byte(_testSyslogMessage))
+	assert.Equal(t, strings.TrimSuffix(_testSyslogMessage, "\n"), readDatagram(t, conn), "Unexpected message.")
+}
+
+func TestSyslogSinkWithEncoder(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen.")
+	defer conn.Close()
+
+	cfg := NewProductionConfig()
+	cfg.Encoding = "syslog"
+	cfg.Sampling = nil
+	cfg.EncoderConfig.TimeKey = ""
+	cfg.EncoderConfig.CallerKey = ""
+	cfg.OutputPaths = []string{
+		"syslog://" + conn.LocalAddr().String() + "?facility=local0&hostname=web-1&appName=api&procID=7",
+	}
+	logger, err := cfg.Build()
+	require.NoError(t, err, "Failed to build logger.")
+	defer logger.Sync()
+
+	logger.Info("two\nlines", String("k", "a\nb"))
+	assert.Equal(
+		t,
+		`<134>1 - web-1 api 7 - [zap@32473 k="a\nb"] two\nlines`,
+		readDatagram(t, conn),
+		"Expected the sink's header and escaped newlines.",
+	)
+}
+
+func TestSyslogSinksWithDifferentOptions(t *testing.T) {
+	cfg := NewProductionConfig()
+	cfg.Encoding = "syslog"
+	cfg.OutputPaths = []string{
+		"syslog://127.0.0.1:1?facility=local0",
+		"syslog://127.0.0.1:2?facility=local1",
+	}
+	_, err := cfg.Build()
+	assert.Error(t, err, "Expected an error building a logger whose syslog sinks disagree.")
+}
+
+func TestSyslogSinkURLErrors(t *testing.T) {
+	tests := []struct {
+		url string
+		err string
+	}{
+		{"syslog://user@localhost", "user and password not allowed"},
+		{"syslog://localhost#foo", "fragments not allowed"},
+		{"syslog://localhost/path", "paths not allowed"},
+		{"syslog://localhost?network=unix", `must use the "udp" or "tcp" network`},
+		{"syslog:///dev/log?network=tcp", `must use the "unixgram" or "unix" network`},
+		{"syslog://localhost?facility=local8", `invalid syslog URL parameter "facility": unknown syslog facility "local8"`},
+		{"syslog://localhost?facility=24", `unknown syslog facility "24"`},
+		{"syslog://localhost?format=json", `must be "rfc5424" or "rfc3164"`},
+		{"syslog://localhost?framing=octet", "not supported with udp sockets"},
+		{"syslog://localhost?bogus=1", `invalid syslog URL parameter "bogus": unknown parameter`},
+		{"syslog://localhost?queueSize=1&queueSize=2", "must be set exactly once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := newSyslogSink(mustParseURL(t, tt.url))
+			if assert.Error(t, err, "Expected an error opening %q.", tt.url) {
+				assert.Contains(t, err.Error(), tt.err, "Unexpected error opening %q.", tt.url)
+			}
+		})
+	}
+}
+
+func TestSyslogSinkURLOptions(t *testing.T) {
+	sink, err := newSyslogSink(mustParseURL(t, "syslog://collector?network=tcp&queueSize=7"))
+	require.NoError(t, err, "Unexpected error opening syslog sink.")
+	s := sink.(*syslogSink)
+	defer s.Close()
+
+	assert.Equal(t, "tcp", s.cfg.network, "Unexpected network.")
+	assert.Equal(t, "collector:514", s.cfg.address, "Expected the default syslog port.")
+	assert.Equal(t, frameOctet, s.cfg.framing, "Expected octet counting over TCP.")
+	assert.Equal(t, 7, s.cfg.queueSize, "Unexpected queue size.")
+	assert.Equal(t, zapcore.SyslogOptions{}, s.opts, "Expected the default header for remote daemons.")
+}
+
+func TestSyslogSinkHeaderOptions(t *testing.T) {
+	tests := []struct {
+		url  string
+		opts zapcore.SyslogOptions
+	}{
+		{
+			url:  "syslog:///dev/null",
+			opts: zapcore.SyslogOptions{Format: zapcore.SyslogRFC3164Local},
+		},
+		{
+			url:  "syslog:///dev/null?format=rfc3164&facility=daemon",
+			opts: zapcore.SyslogOptions{Facility: "daemon", Format: zapcore.SyslogRFC3164Local},
+		},
+		{
+			url:  "syslog://collector?format=rfc3164&facility=17&appName=api&procID=7&hostname=web",
+			opts: zapcore.SyslogOptions{Facility: "17", Hostname: "web", AppName: "api", ProcID: "7", Format: zapcore.SyslogRFC3164},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			sink, err := newSyslogSink(mustParseURL(t, tt.url))
+			require.NoError(t, err, "Unexpected error opening syslog sink.")
+			defer sink.Close()
+
+			opts, ok := sink.(*syslogSink).syslogOptions()
+			assert.True(t, ok, "Expected syslog sinks to carry encoder options.")
+			assert.Equal(t, tt.opts, opts, "Unexpected options.")
+		})
+	}
+}
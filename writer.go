@@ -21,8 +21,8 @@
 package zap
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"io/ioutil"
 
 	"go.uber.org/zap/zapcore"
@@ -36,12 +36,102 @@ import (
 // any opened files.
 //
 // Passing no URLs returns a no-op WriteSyncer. Zap handles URLs without a
-// scheme and URLs with the "file" scheme. Third-party code may register
-// factories for other schemes using RegisterSink.
+// scheme and URLs with the "file", "rotate", "tcp", "udp", "unix", "syslog",
+// "gelf", "journald", "http", "https", and "memory" schemes. Third-party code
+// may register factories for other schemes using RegisterSink.
 //
 // URLs with the "file" scheme must use absolute paths on the local
-// filesystem. No user, password, port, fragments, or query parameters are
-// allowed, and the hostname must be empty or "localhost".
+// filesystem. No user, password, port, or fragments are allowed, and the
+// hostname must be empty or "localhost". Query parameters configure the file:
+// mode sets the permissions of a newly created file (default 0644), and
+// mkdir=true creates any missing parent directories. The fsync parameter
+// controls when the file is flushed to stable storage: "sync" (the default)
+// flushes whenever the sink is synced, "always" also flushes after every
+// write, "interval" also flushes every fsyncInterval (default 1s), and
+// "never" makes syncing a no-op.
+//
+// File paths may contain placeholders in braces that expand to the current
+// time, as in file:///var/log/app-{date}.log. A placeholder is "date"
+// (2006-01-02), "hour" (15), strftime directives like {%Y%m%d}, or a layout
+// understood by time.Time's Format method after a "time:" prefix, like
+// {time:2006-01-02T15}; braces around anything else, like {shard1}, are part
+// of the path. Placeholders use local time unless utc=true, and the sink
+// switches to a new file as soon as the expanded path changes. Since paths
+// are parsed as URLs, the percent signs in strftime directives must be
+// escaped, as in {%25Y%25m%25d}.
+//
+// URLs with the "rotate" scheme follow the same rules, but write to a file
+// that's rotated according to its query parameters. For example,
+//   rotate:///var/log/app.log?maxSize=100MB&maxBackups=7&interval=24h
+// moves app.log aside whenever it would grow past 100MB and at midnight UTC,
+// keeping the seven newest backups. The maxSize parameter accepts a number of
+// bytes with an optional KB, MB, or GB suffix, interval accepts any duration
+// understood by time.ParseDuration, and a maxBackups of zero (the default)
+// keeps every backup. Adding compress=gzip compresses backups in the
+// background; compression failures are reported to the error output.
+//
+// URLs with the "tcp", "udp", and "unix" schemes send each log entry over a
+// network connection, like tcp://localhost:5170 or unix:///run/agent.sock.
+// Entries are queued and sent by a background goroutine, which reconnects
+// with exponential backoff if the connection drops; entries too large to
+// send are dropped and reported to the error output. By default, the queue
+// holds 1024 entries and writes fail once it's full; the queueSize and
+// onFull=block parameters change this. On stream sockets, entries are
+// separated according to the framing parameter: "newline" (the default)
+// ensures every entry ends in a newline, "octet" uses RFC 6587 octet
+// counting, "length" prefixes each entry with a big-endian uint32, and
+// "none" writes entries as-is. The dialTimeout, writeTimeout, syncTimeout,
+// and maxBackoff parameters accept durations.
+//
+// URLs with the "syslog" scheme send entries to a syslog daemon. Without a
+// host, they use the local daemon's socket: either the given path, as in
+// syslog:///dev/log, or the first of /dev/log, /var/run/syslog, and
+// /var/run/log that exists. With a host, they send to a remote daemon over
+// UDP, or over TCP with network=tcp, on port 514 unless another is given.
+// Entries should be encoded with the "syslog" encoder. When Config builds the
+// logger, the encoder takes its header from the URL: the facility (a name like
+// "local0" or a number), hostname, appName, and procID parameters set the
+// corresponding header fields, and format=rfc3164 selects the older BSD
+// format, which is the default for local sockets. Elsewhere, pass the same
+// settings to zapcore.NewSyslogEncoderWithOptions. Over TCP, messages use
+// octet counting by default. The queue, timeout, and framing parameters of
+// the network schemes also apply.
+//
+// URLs with the "gelf" scheme send entries to Graylog's GELF UDP input, like
+// gelf://graylog:12201 (the default port); entries should be encoded with the
+// "gelf" encoder. With compress=gzip, each message is gzipped. Messages that
+// don't fit in a single datagram of chunkSize bytes (default 1420) are split
+// into at most 128 GELF chunks, and larger messages are rejected. The queue
+// and timeout parameters of the network schemes also apply.
+//
+// URLs with the "journald" scheme send entries to systemd-journald using its
+// native protocol, which preserves each field; entries should be encoded with
+// the "journald" encoder. Use journald:// for the default socket, or include
+// the socket's path. This scheme is only available on Linux.
+//
+// URLs with the "http" and "https" schemes POST batches of entries to an
+// HTTP endpoint. A batch is sent once it holds batchSize entries (default
+// 1000) or maxBatchBytes bytes (default 1MB), and at least every
+// flushInterval (default 1s). Requests use the contentType parameter
+// (default "application/x-ndjson") and any number of header parameters like
+// header=Authorization:%20Bearer%20token; compress=gzip compresses each
+// request body. Failed requests are retried up to maxRetries times (default
+// 3) with exponential backoff capped at maxBackoff, unless the endpoint
+// responds with a client error other than 429. Batches that can't be
+// delivered are reported to the error output. The queueSize parameter
+// (default 16 batches), onFull, requestTimeout, and syncTimeout work like
+// the network schemes' parameters; when a full queue drops a batch, the
+// Write that completed it returns an error. Parameters prefixed with "query." are
+// sent to the endpoint without the prefix, as in query.pipeline=logs; any
+// other parameter is an error.
+//
+// URLs with the "memory" scheme, like memory://recent?size=256KB, keep the
+// most recent output in an in-memory ring buffer of the given size (default
+// 1MB, at most 1GB). Opening the same name again shares the buffer until every sink with
+// that name is closed. See MemorySink.
+//
+// Until they're closed, the opened sinks report their statistics through
+// AllSinkStats.
 //
 // Since it's common to write logs to the local filesystem, URLs without a
 // scheme (e.g., "/var/log/foo.log") are treated as local file paths. Without
@@ -55,16 +145,18 @@ func Open(paths ...string) (zapcore.WriteSyncer, func(), error) {
 	}
 
 	writer := CombineWriteSyncers(writers...)
-	return writer, close, nil
+	return writer, func() { close(context.Background()) }, nil
 }
 
-func open(paths []string) ([]zapcore.WriteSyncer, func(), error) {
+func open(paths []string) ([]zapcore.WriteSyncer, func(context.Context) error, error) {
 	writers := make([]zapcore.WriteSyncer, 0, len(paths))
-	closers := make([]io.Closer, 0, len(paths))
-	close := func() {
+	closers := make([]Sink, 0, len(paths))
+	close := func(ctx context.Context) error {
+		var err error
 		for _, c := range closers {
-			c.Close()
+			err = multierr.Append(err, closeContext(ctx, c))
 		}
+		return err
 	}
 
 	var openErr error
@@ -74,11 +166,12 @@ func open(paths []string) ([]zapcore.WriteSyncer, func(), error) {
 			openErr = multierr.Append(openErr, fmt.Errorf("couldn't open sink %q: %v", path, err))
 			continue
 		}
+		sink = trackSink(path, sink)
 		writers = append(writers, sink)
 		closers = append(closers, sink)
 	}
 	if openErr != nil {
-		close()
+		close(context.Background())
 		return writers, nil, openErr
 	}
 
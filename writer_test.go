@@ -77,7 +77,12 @@ func TestOpen(t *testing.T) {
 		{[]string{"file://host01.test.com" + tempName}, []string{"empty or use localhost"}},
 		{[]string{"file://rms@localhost" + tempName}, []string{"user and password not allowed"}},
 		{[]string{"file://localhost" + tempName + "#foo"}, []string{"fragments not allowed"}},
-		{[]string{"file://localhost" + tempName + "?foo=bar"}, []string{"query parameters not allowed"}},
+		{[]string{"file://localhost" + tempName + "?foo=bar"}, []string{`invalid file URL parameter "foo": unknown parameter`}},
+		{[]string{"file://localhost" + tempName + "?mode=0999"}, []string{`invalid file URL parameter "mode"`}},
+		{[]string{"file://localhost" + tempName + "?fsync=sometimes"}, []string{`must be "sync", "always", "interval", or "never"`}},
+		{[]string{"file://localhost" + tempName + "?mkdir=yes"}, []string{`invalid file URL parameter "mkdir"`}},
+		{[]string{"file://localhost" + tempName + "?mkdir=true&mkdir=false"}, []string{"must be set exactly once"}},
+		{[]string{"stdout?mode=0600"}, []string{"query parameters not allowed with stdout"}},
 		{[]string{"file://localhost:8080" + tempName}, []string{"ports not allowed"}},
 	}
 
@@ -0,0 +1,177 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+const (
+	_defaultBufferSize    = 256 * 1024
+	_defaultFlushInterval = 30 * time.Second
+)
+
+// CloseFunc flushes any buffered data and releases the resources held by a
+// WriteSyncer wrapper.
+type CloseFunc func() error
+
+type bufferedWriteSyncer struct {
+	sync.Mutex
+
+	ws   WriteSyncer
+	size int
+	buf  []byte
+	err  error // from a flush that no caller saw, reported by the next Sync
+
+	ticker  *time.Ticker
+	stop    chan struct{}
+	done    chan struct{}
+	stopped bool
+	once    sync.Once
+}
+
+// Buffer wraps a WriteSyncer in an in-memory buffer, so that many log entries
+// are written to the underlying WriteSyncer in a single call. The buffer is
+// flushed when the next write wouldn't fit in bufferSize bytes, every
+// flushInterval, and whenever Sync is called. Non-positive sizes and intervals
+// default to 256kB and 30 seconds.
+//
+// Because the Core returned by NewCore syncs its output after writing
+// entries above ErrorLevel, buffered entries are always flushed before the
+// logger panics or exits.
+//
+// Buffer starts a background goroutine to flush on the interval; callers
+// should use the returned CloseFunc to flush and stop it before exiting.
+// Writes after closing go straight to the wrapped WriteSyncer.
+func Buffer(ws WriteSyncer, bufferSize int, flushInterval time.Duration) (WriteSyncer, CloseFunc) {
+	if bufferSize <= 0 {
+		bufferSize = _defaultBufferSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = _defaultFlushInterval
+	}
+
+	s := &bufferedWriteSyncer{
+		ws:     ws,
+		size:   bufferSize,
+		buf:    make([]byte, 0, bufferSize),
+		ticker: time.NewTicker(flushInterval),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.flushLoop()
+	return s, s.close
+}
+
+// Write buffers bs. If making room for it requires a flush that fails, bs is
+// still buffered, and the error is reported by the next call to Sync.
+func (s *bufferedWriteSyncer) Write(bs []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.stopped {
+		return s.ws.Write(bs)
+	}
+	if len(s.buf)+len(bs) > s.size && len(s.buf) > 0 {
+		s.setError(s.flush())
+	}
+	if len(bs) >= s.size {
+		// Buffering an oversized write only adds a copy.
+		return s.ws.Write(bs)
+	}
+	s.buf = append(s.buf, bs...)
+	return len(bs), nil
+}
+
+func (s *bufferedWriteSyncer) Sync() error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.sync()
+}
+
+// Callers must hold the lock.
+func (s *bufferedWriteSyncer) sync() error {
+	stale := s.takeError()
+	if err := s.flush(); err != nil {
+		return multierr.Append(stale, err)
+	}
+	return multierr.Append(stale, s.ws.Sync())
+}
+
+// flush writes out the buffer. The buffered data is discarded even if the
+// write fails, so that a broken destination can't grow memory without bound.
+// Callers must hold the lock.
+func (s *bufferedWriteSyncer) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	_, err := s.ws.Write(s.buf)
+	s.buf = s.buf[:0]
+	return err
+}
+
+// Callers must hold the lock.
+func (s *bufferedWriteSyncer) setError(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Callers must hold the lock.
+func (s *bufferedWriteSyncer) takeError() error {
+	err := s.err
+	s.err = nil
+	return err
+}
+
+func (s *bufferedWriteSyncer) flushLoop() {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.ticker.C:
+			s.Lock()
+			s.setError(s.flush())
+			s.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *bufferedWriteSyncer) close() error {
+	s.once.Do(func() {
+		s.ticker.Stop()
+		close(s.stop)
+		<-s.done
+	})
+
+	// Stop buffering and flush under the same lock, so that no write can be
+	// left in the buffer once the ticker is gone.
+	s.Lock()
+	defer s.Unlock()
+
+	s.stopped = true
+	return s.sync()
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/internal/ztest"
+)
+
+// lockedBuffer is a WriteSyncer spy that's safe to inspect while a background
+// goroutine writes to it.
+type lockedBuffer struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	writes int
+	syncs  int
+	err    error
+}
+
+func (b *lockedBuffer) Write(bs []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writes++
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.buf.Write(bs)
+}
+
+func (b *lockedBuffer) Sync() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.syncs++
+	return nil
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *lockedBuffer) Writes() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.writes
+}
+
+func (b *lockedBuffer) SetError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err = err
+}
+
+func TestBufferBatchesWrites(t *testing.T) {
+	out := &lockedBuffer{}
+	ws, close := Buffer(out, 10, time.Hour)
+	defer close()
+
+	requireWriteWorks(t, ws)
+	requireWriteWorks(t, ws)
+	assert.Equal(t, 0, out.Writes(), "Expected writes that fit in the buffer to be held.")
+
+	requireWriteWorks(t, ws)
+	requireWriteWorks(t, ws)
+	assert.Equal(t, "foofoofoo", out.String(), "Expected a full buffer to be flushed before the next write.")
+	assert.Equal(t, 1, out.Writes(), "Expected buffered writes to be batched.")
+
+	require.NoError(t, ws.Sync(), "Unexpected error syncing.")
+	assert.Equal(t, "foofoofoofoo", out.String(), "Expected Sync to flush the buffer.")
+	assert.Equal(t, 1, out.syncs, "Expected Sync to sync the wrapped WriteSyncer.")
+}
+
+func TestBufferOversizedWrite(t *testing.T) {
+	out := &lockedBuffer{}
+	ws, close := Buffer(out, 4, time.Hour)
+	defer close()
+
+	ws.Write([]byte("ab"))
+	ws.Write([]byte("longer than the buffer"))
+	assert.Equal(t, "ablonger than the buffer", out.String(), "Expected oversized writes to bypass the buffer in order.")
+	assert.Equal(t, 2, out.Writes(), "Unexpected number of writes.")
+}
+
+func TestBufferFlushesOnInterval(t *testing.T) {
+	out := &lockedBuffer{}
+	ws, close := Buffer(out, 1024, time.Millisecond)
+	defer close()
+
+	requireWriteWorks(t, ws)
+	deadline := time.Now().Add(ztest.Timeout(time.Second))
+	for out.String() == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, "foo", out.String(), "Expected the buffer to be flushed by the timer.")
+}
+
+func TestBufferClose(t *testing.T) {
+	out := &lockedBuffer{}
+	ws, close := Buffer(out, 1024, time.Hour)
+
+	requireWriteWorks(t, ws)
+	require.NoError(t, close(), "Unexpected error closing buffer.")
+	assert.Equal(t, "foo", out.String(), "Expected close to flush the buffer.")
+	assert.NoError(t, close(), "Expected closing twice to succeed.")
+
+	requireWriteWorks(t, ws)
+	assert.Equal(t, "foofoo", out.String(), "Expected writes after close to go straight through.")
+}
+
+func TestBufferErrors(t *testing.T) {
+	out := &lockedBuffer{}
+	ws, close := Buffer(out, 1024, time.Millisecond)
+	defer close()
+
+	out.SetError(errors.New("fail"))
+	ws.Write([]byte("lost"))
+	deadline := time.Now().Add(ztest.Timeout(time.Second))
+	for out.Writes() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	out.SetError(nil)
+
+	n, err := ws.Write([]byte("foo"))
+	assert.NoError(t, err, "Expected a background flush error not to fail the next write.")
+	assert.Equal(t, 3, n, "Expected the next write to be buffered despite the earlier error.")
+	assert.Error(t, ws.Sync(), "Expected a background flush error to be reported by the next sync.")
+	requireWriteWorks(t, ws)
+	require.NoError(t, ws.Sync(), "Expected errors to be reported only once.")
+	assert.Equal(t, "foofoo", out.String(), "Expected writing to resume after an error.")
+}
+
+func TestBufferKeepsWritesAfterFlushErrors(t *testing.T) {
+	out := &lockedBuffer{}
+	ws, close := Buffer(out, 4, time.Hour)
+	defer close()
+
+	ws.Write([]byte("foo"))
+	out.SetError(errors.New("fail"))
+	n, err := ws.Write([]byte("bar"))
+	assert.NoError(t, err, "Expected a failed flush not to fail the write that caused it.")
+	assert.Equal(t, 3, n, "Expected the write to be buffered.")
+
+	out.SetError(nil)
+	assert.Error(t, ws.Sync(), "Expected the flush error to be reported by the next sync.")
+	assert.Equal(t, "bar", out.String(), "Expected the write that caused the failed flush to be kept.")
+}
+
+func TestBufferDefaults(t *testing.T) {
+	ws, close := Buffer(&lockedBuffer{}, 0, 0)
+	defer close()
+
+	s := ws.(*bufferedWriteSyncer)
+	assert.Equal(t, _defaultBufferSize, s.size, "Unexpected default buffer size.")
+}
+
+func TestBufferFlushesBeforeTerminalLevels(t *testing.T) {
+	for _, lvl := range []Level{DPanicLevel, PanicLevel, FatalLevel} {
+		out := &lockedBuffer{}
+		ws, close := Buffer(out, 1024, time.Hour)
+		core := NewCore(NewJSONEncoder(EncoderConfig{MessageKey: "msg"}), ws, DebugLevel)
+
+		require.NoError(t, core.Write(Entry{Level: InfoLevel, Message: "buffered"}, nil), "Unexpected error writing entry.")
+		assert.Empty(t, out.String(), "Expected info-level entries to stay buffered.")
+		require.NoError(t, core.Write(Entry{Level: lvl, Message: "terminal"}, nil), "Unexpected error writing entry.")
+		assert.Contains(t, out.String(), `"msg":"terminal"`, "Expected %v entries to flush the buffer.", lvl)
+		close()
+	}
+}
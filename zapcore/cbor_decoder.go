@@ -0,0 +1,483 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"time"
+)
+
+// _cborMaxDepth limits the nesting of arrays, maps, and tags in CBORToJSON's
+// input.
+const _cborMaxDepth = 1000
+
+// CBORToJSON converts a CBOR sequence, like the output of the CBOR encoder,
+// to JSON. Each top-level item is written on its own line.
+//
+// The conversion handles any well-formed CBOR, not just the encoder's output.
+// Byte strings become base64-encoded strings, and map keys that aren't
+// strings are converted to JSON and used as strings. Epoch-based date/time
+// values (tag 1) become RFC 3339 strings in UTC, complex numbers (tag 43000)
+// and special floating-point values become strings as they do in the JSON
+// encoder, embedded JSON (tag 262) is copied as-is, and bignums (tags 2 and
+// 3) become numbers. Other tags are ignored, and undefined and unassigned
+// simple values become null.
+//
+// If the input ends in the middle of an item, CBORToJSON returns
+// io.ErrUnexpectedEOF.
+func CBORToJSON(w io.Writer, r io.Reader) error {
+	d := &cborDecoder{r: bufio.NewReader(r)}
+	enc := newJSONEncoder(EncoderConfig{}, false)
+	defer enc.buf.Free()
+
+	for {
+		if _, err := d.r.Peek(1); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		enc.buf.Reset()
+		if err := d.decode(enc); err != nil {
+			return err
+		}
+		enc.buf.AppendByte('\n')
+		if _, err := w.Write(enc.buf.Bytes()); err != nil {
+			return err
+		}
+	}
+}
+
+type cborDecoder struct {
+	r     *bufio.Reader
+	off   int64 // bytes consumed so far
+	depth int
+	str   bytes.Buffer // contents of the last string read
+}
+
+// decode converts the next item to JSON.
+func (d *cborDecoder) decode(enc *jsonEncoder) error {
+	start := d.off
+	initial, err := d.readByte()
+	if err != nil {
+		return err
+	}
+	major, info := initial&0xe0, initial&0x1f
+
+	switch major {
+	case _cborUnsigned:
+		n, err := d.readArg(info)
+		if err != nil {
+			return err
+		}
+		enc.AppendUint64(n)
+	case _cborNegative:
+		n, err := d.readArg(info)
+		if err != nil {
+			return err
+		}
+		if n <= math.MaxInt64 {
+			enc.AppendInt64(-1 - int64(n))
+			return nil
+		}
+		v := new(big.Int).SetUint64(n)
+		appendBigInt(enc, v.Neg(v.Add(v, big.NewInt(1))))
+	case _cborBytes:
+		b, err := d.readString(major, info)
+		if err != nil {
+			return err
+		}
+		enc.AppendString(base64.StdEncoding.EncodeToString(b))
+	case _cborText:
+		b, err := d.readString(major, info)
+		if err != nil {
+			return err
+		}
+		enc.AppendByteString(b)
+	case _cborArray:
+		return d.nest(start, func() error {
+			return enc.AppendArray(ArrayMarshalerFunc(func(ArrayEncoder) error {
+				return d.forEach(info, func() error { return d.decode(enc) })
+			}))
+		})
+	case _cborMap:
+		return d.nest(start, func() error {
+			return enc.AppendObject(ObjectMarshalerFunc(func(ObjectEncoder) error {
+				return d.forEach(info, func() error {
+					key, err := d.decodeKey()
+					if err != nil {
+						return err
+					}
+					enc.addKey(key)
+					return d.decode(enc)
+				})
+			}))
+		})
+	case _cborTag:
+		tag, err := d.readArg(info)
+		if err != nil {
+			return err
+		}
+		return d.nest(start, func() error { return d.decodeTagged(enc, tag) })
+	default:
+		return d.decodeSimple(enc, start, info)
+	}
+	return nil
+}
+
+func (d *cborDecoder) decodeTagged(enc *jsonEncoder, tag uint64) error {
+	start := d.off
+	switch tag {
+	case _cborTagEpochTime:
+		f, i, isInt, err := d.readNumber()
+		if err != nil {
+			return err
+		}
+		t := time.Unix(i, 0)
+		if !isInt {
+			sec, frac := math.Modf(f)
+			t = time.Unix(int64(sec), int64(frac*float64(time.Second)))
+		}
+		enc.AppendString(t.UTC().Format(time.RFC3339Nano))
+	case _cborTagComplex:
+		initial, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		if initial != _cborArray|2 {
+			return d.errorf(start, "tag %d must wrap a pair of numbers", tag)
+		}
+		r, _, _, err := d.readNumber()
+		if err != nil {
+			return err
+		}
+		i, _, _, err := d.readNumber()
+		if err != nil {
+			return err
+		}
+		enc.AppendComplex128(complex(r, i))
+	case _cborTagEmbeddedJSON:
+		b, err := d.readAnyString(tag)
+		if err != nil {
+			return err
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, b); err != nil {
+			// Not valid JSON, so keep it as a string.
+			enc.AppendByteString(b)
+			return nil
+		}
+		enc.addElementSeparator()
+		enc.buf.Write(compact.Bytes())
+	case _cborTagBignum, _cborTagNegBignum:
+		b, err := d.readAnyString(tag)
+		if err != nil {
+			return err
+		}
+		v := new(big.Int).SetBytes(b)
+		if tag == _cborTagNegBignum {
+			v.Neg(v.Add(v, big.NewInt(1)))
+		}
+		appendBigInt(enc, v)
+	default:
+		return d.decode(enc)
+	}
+	return nil
+}
+
+func (d *cborDecoder) decodeSimple(enc *jsonEncoder, start int64, info byte) error {
+	switch info {
+	case _cborFalse & 0x1f:
+		enc.AppendBool(false)
+	case _cborTrue & 0x1f:
+		enc.AppendBool(true)
+	case _cborFloat16 & 0x1f:
+		n, err := d.readArg(info)
+		if err != nil {
+			return err
+		}
+		enc.AppendFloat32(float32(float16ToFloat64(uint16(n))))
+	case _cborFloat32 & 0x1f:
+		n, err := d.readArg(info)
+		if err != nil {
+			return err
+		}
+		enc.AppendFloat32(math.Float32frombits(uint32(n)))
+	case _cborFloat64 & 0x1f:
+		n, err := d.readArg(info)
+		if err != nil {
+			return err
+		}
+		enc.AppendFloat64(math.Float64frombits(n))
+	case _cborBreak & 0x1f:
+		return d.errorf(start, "unexpected break")
+	default:
+		// Null, undefined, and unassigned simple values.
+		if _, err := d.readArg(info); err != nil {
+			return err
+		}
+		enc.addElementSeparator()
+		enc.buf.AppendString("null")
+	}
+	return nil
+}
+
+// decodeKey reads a map key. Keys that aren't strings are converted to JSON
+// text.
+func (d *cborDecoder) decodeKey() (string, error) {
+	initial, err := d.peekByte()
+	if err != nil {
+		return "", err
+	}
+	if initial&0xe0 == _cborText {
+		d.readByte()
+		b, err := d.readString(_cborText, initial&0x1f)
+		return string(b), err
+	}
+
+	enc := newJSONEncoder(EncoderConfig{}, false)
+	defer enc.buf.Free()
+	if err := d.decode(enc); err != nil {
+		return "", err
+	}
+	var key string
+	if json.Unmarshal(enc.buf.Bytes(), &key) != nil {
+		// Not a string, so use the JSON itself.
+		key = enc.buf.String()
+	}
+	return key, nil
+}
+
+// nest runs f one level deeper into the input, enforcing _cborMaxDepth.
+func (d *cborDecoder) nest(start int64, f func() error) error {
+	if d.depth >= _cborMaxDepth {
+		return d.errorf(start, "nested too deeply")
+	}
+	d.depth++
+	err := f()
+	d.depth--
+	return err
+}
+
+// forEach calls f once for each element of an array or each pair in a map,
+// given the additional information from the container's initial byte.
+func (d *cborDecoder) forEach(info byte, f func() error) error {
+	if info == _cborIndefinite {
+		for {
+			b, err := d.peekByte()
+			if err != nil {
+				return err
+			}
+			if b == _cborBreak {
+				d.readByte()
+				return nil
+			}
+			if err := f(); err != nil {
+				return err
+			}
+		}
+	}
+	n, err := d.readArg(info)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < n; i++ {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readNumber reads an integer or floating-point item. Integers are also
+// returned exactly.
+func (d *cborDecoder) readNumber() (float64, int64, bool, error) {
+	start := d.off
+	initial, err := d.readByte()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	major, info := initial&0xe0, initial&0x1f
+	if major != _cborUnsigned && major != _cborNegative && (major != _cborSimple || info < 25 || info > 27) {
+		return 0, 0, false, d.errorf(start, "expected a number")
+	}
+	n, err := d.readArg(info)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	switch {
+	case major != _cborSimple && n > math.MaxInt64:
+		return 0, 0, false, d.errorf(start, "integer out of range")
+	case major == _cborUnsigned:
+		return float64(n), int64(n), true, nil
+	case major == _cborNegative:
+		return float64(-1 - int64(n)), -1 - int64(n), true, nil
+	case info == _cborFloat16&0x1f:
+		return float16ToFloat64(uint16(n)), 0, false, nil
+	case info == _cborFloat32&0x1f:
+		return float64(math.Float32frombits(uint32(n))), 0, false, nil
+	default:
+		return math.Float64frombits(n), 0, false, nil
+	}
+}
+
+// readAnyString reads the byte or text string wrapped by a tag.
+func (d *cborDecoder) readAnyString(tag uint64) ([]byte, error) {
+	start := d.off
+	initial, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	major := initial & 0xe0
+	if major != _cborBytes && major != _cborText {
+		return nil, d.errorf(start, "tag %d must wrap a string", tag)
+	}
+	return d.readString(major, initial&0x1f)
+}
+
+// readString reads the contents of a definite-length or indefinite-length
+// string. The returned slice is only valid until the next string is read.
+func (d *cborDecoder) readString(major, info byte) ([]byte, error) {
+	d.str.Reset()
+	if info != _cborIndefinite {
+		err := d.readChunk(info)
+		return d.str.Bytes(), err
+	}
+	for {
+		start := d.off
+		initial, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if initial == _cborBreak {
+			return d.str.Bytes(), nil
+		}
+		if initial&0xe0 != major || initial&0x1f == _cborIndefinite {
+			return nil, d.errorf(start, "invalid chunk in indefinite-length string")
+		}
+		if err := d.readChunk(initial & 0x1f); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readChunk reads a definite-length string, just after its initial byte.
+func (d *cborDecoder) readChunk(info byte) error {
+	start := d.off - 1
+	n, err := d.readArg(info)
+	if err != nil {
+		return err
+	}
+	if n > math.MaxInt64 {
+		return d.errorf(start, "string too long")
+	}
+	// Copy rather than allocating n bytes up front, since n may be bogus.
+	copied, err := io.CopyN(&d.str, d.r, int64(n))
+	d.off += copied
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readArg reads the argument of an item, just after its initial byte.
+func (d *cborDecoder) readArg(info byte) (uint64, error) {
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info <= 27:
+		size = 1 << (info - 24)
+	default:
+		return 0, d.errorf(d.off-1, "invalid additional information %d", info)
+	}
+
+	var n uint64
+	for i := 0; i < size; i++ {
+		b, err := d.readByte()
+		if err != nil {
+			return 0, err
+		}
+		n = n<<8 | uint64(b)
+	}
+	return n, nil
+}
+
+func (d *cborDecoder) readByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		d.off++
+	}
+	return b, err
+}
+
+func (d *cborDecoder) peekByte() (byte, error) {
+	b, err := d.r.Peek(1)
+	if err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *cborDecoder) errorf(offset int64, format string, args ...interface{}) error {
+	return fmt.Errorf("invalid CBOR at offset %d: %s", offset, fmt.Sprintf(format, args...))
+}
+
+func appendBigInt(enc *jsonEncoder, v *big.Int) {
+	enc.addElementSeparator()
+	enc.buf.AppendString(v.String())
+}
+
+// float16ToFloat64 converts an IEEE 754 half-precision value.
+func float16ToFloat64(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
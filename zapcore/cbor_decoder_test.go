@@ -0,0 +1,161 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/internal/ztest"
+)
+
+func cborToJSONString(in []byte) (string, error) {
+	var out bytes.Buffer
+	err := CBORToJSON(&out, bytes.NewReader(in))
+	return out.String(), err
+}
+
+func TestCBORToJSON(t *testing.T) {
+	// Most examples are from Appendix A of RFC 8949.
+	tests := []struct {
+		hex      string
+		expected string
+	}{
+		{"00", `0`},
+		{"17", `23`},
+		{"1903e8", `1000`},
+		{"1bffffffffffffffff", `18446744073709551615`},
+		{"20", `-1`},
+		{"3903e7", `-1000`},
+		{"3bffffffffffffffff", `-18446744073709551616`},
+		{"c249010000000000000000", `18446744073709551616`},
+		{"c349010000000000000000", `-18446744073709551617`},
+		{"f93c00", `1`},
+		{"f97bff", `65504`},
+		{"f9c400", `-4`},
+		{"f97c00", `"+Inf"`},
+		{"f97e00", `"NaN"`},
+		{"fa47c35000", `100000`},
+		{"fb3ff199999999999a", `1.1`},
+		{"fbfff0000000000000", `"-Inf"`},
+		{"f4", `false`},
+		{"f5", `true`},
+		{"f6", `null`},
+		{"f7", `null`},
+		{"f0", `null`},
+		{"f8ff", `null`},
+		{"c074323031332d30332d32315432303a30343a30305a", `"2013-03-21T20:04:00Z"`},
+		{"c11a514b67b0", `"2013-03-21T20:04:00Z"`},
+		{"c1fb41d452d9ec200000", `"2013-03-21T20:04:00.5Z"`},
+		{"d74401020304", `"AQIDBA=="`},
+		{"d82076687474703a2f2f7777772e6578616d706c652e636f6d", `"http://www.example.com"`},
+		{"40", `""`},
+		{"4401020304", `"AQIDBA=="`},
+		{"60", `""`},
+		{"6449455446", `"IETF"`},
+		{"62225c", `"\"\\"`},
+		{"62c3bc", `"ü"`},
+		{"61ff", `"\ufffd"`},
+		{"80", `[]`},
+		{"83010203", `[1,2,3]`},
+		{"8301820203820405", `[1,[2,3],[4,5]]`},
+		{"a0", `{}`},
+		{"a201020304", `{"1":2,"3":4}`},
+		{"a26161016162820203", `{"a":1,"b":[2,3]}`},
+		{"826161a161626163", `["a",{"b":"c"}]`},
+		{"5f42010243030405ff", `"AQIDBAU="`},
+		{"7f657374726561646d696e67ff", `"streaming"`},
+		{"9fff", `[]`},
+		{"9f018202039f0405ffff", `[1,[2,3],[4,5]]`},
+		{"bf61610161629f0203ffff", `{"a":1,"b":[2,3]}`},
+		{"bf6346756ef563416d7421ff", `{"Fun":true,"Amt":-2}`},
+		{"a1c0616101", `{"a":1}`},
+		{"a1f5f4", `{"true":false}`},
+		{"d90106477b2261223a317d", `{"a":1}`},
+		{"d90106497b2261223a2031207d", `{"a":1}`},
+		{"d90106436e6f74", `"not"`},
+		{"d9a7f8820102", `"1+2i"`},
+		{"d9a7f882fb3ff8000000000000fb3ff8000000000000", `"1.5+1.5i"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hex, func(t *testing.T) {
+			in, err := hex.DecodeString(tt.hex)
+			require.NoError(t, err, "Invalid test input.")
+			out, err := cborToJSONString(in)
+			require.NoError(t, err, "Unexpected error converting CBOR.")
+			assert.Equal(t, tt.expected+"\n", out, "Unexpected JSON.")
+		})
+	}
+}
+
+func TestCBORToJSONSequence(t *testing.T) {
+	out, err := cborToJSONString([]byte{0x01, 0x82, 0x02, 0x03, 0x61, 'a'})
+	require.NoError(t, err, "Unexpected error converting a CBOR sequence.")
+	assert.Equal(t, "1\n[2,3]\n\"a\"\n", out, "Expected each item on its own line.")
+
+	out, err = cborToJSONString(nil)
+	assert.NoError(t, err, "Unexpected error converting empty input.")
+	assert.Equal(t, "", out, "Expected no output from empty input.")
+}
+
+func TestCBORToJSONErrors(t *testing.T) {
+	tests := []struct {
+		desc string
+		in   []byte
+		err  string
+	}{
+		{"truncated argument", []byte{0x19, 0x01}, io.ErrUnexpectedEOF.Error()},
+		{"truncated string", []byte{0x5a, 0xff, 0xff, 0xff, 0xff, 0x00}, io.ErrUnexpectedEOF.Error()},
+		{"truncated map", []byte{0xa2, 0x01, 0x02}, io.ErrUnexpectedEOF.Error()},
+		{"unterminated array", []byte{0x9f, 0x01}, io.ErrUnexpectedEOF.Error()},
+		{"stray break", []byte{0x01, 0xff}, "invalid CBOR at offset 1: unexpected break"},
+		{"reserved additional information", []byte{0x1c}, "invalid CBOR at offset 0: invalid additional information 28"},
+		{"nested indefinite chunk", []byte{0x5f, 0x5f, 0xff, 0xff}, "invalid CBOR at offset 1: invalid chunk in indefinite-length string"},
+		{"mismatched chunk", []byte{0x7f, 0x41, 'a', 0xff}, "invalid CBOR at offset 1: invalid chunk in indefinite-length string"},
+		{"oversized string", []byte{0x7b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "invalid CBOR at offset 0: string too long"},
+		{"epoch time without a number", []byte{0xc1, 0x61, 'a'}, "invalid CBOR at offset 1: expected a number"},
+		{"epoch time out of range", []byte{0xc1, 0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "invalid CBOR at offset 1: integer out of range"},
+		{"complex number without a pair", []byte{0xd9, 0xa7, 0xf8, 0x01}, "invalid CBOR at offset 3: tag 43000 must wrap a pair of numbers"},
+		{"bignum without a string", []byte{0xc2, 0x01}, "invalid CBOR at offset 1: tag 2 must wrap a string"},
+		{"too deep", append(bytes.Repeat([]byte{0x81}, _cborMaxDepth+1), 0x00), "invalid CBOR at offset 1000: nested too deeply"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := cborToJSONString(tt.in)
+			if assert.Error(t, err, "Expected an error converting invalid CBOR.") {
+				assert.Equal(t, tt.err, err.Error(), "Unexpected error message.")
+			}
+		})
+	}
+}
+
+func TestCBORToJSONWriteError(t *testing.T) {
+	err := CBORToJSON(&ztest.FailWriter{}, strings.NewReader("\x01"))
+	assert.Error(t, err, "Expected write errors to propagate.")
+}
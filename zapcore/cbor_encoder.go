@@ -0,0 +1,479 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/internal/bufferpool"
+)
+
+// CBOR major types, shifted into the high bits of an item's initial byte.
+const (
+	_cborUnsigned = 0 << 5
+	_cborNegative = 1 << 5
+	_cborBytes    = 2 << 5
+	_cborText     = 3 << 5
+	_cborArray    = 4 << 5
+	_cborMap      = 5 << 5
+	_cborTag      = 6 << 5
+	_cborSimple   = 7 << 5
+)
+
+// Initial bytes with special meanings.
+const (
+	_cborFalse   = _cborSimple | 20
+	_cborTrue    = _cborSimple | 21
+	_cborNull    = _cborSimple | 22
+	_cborFloat16 = _cborSimple | 25
+	_cborFloat32 = _cborSimple | 26
+	_cborFloat64 = _cborSimple | 27
+	_cborBreak   = _cborSimple | 31
+
+	_cborIndefinite = 31
+)
+
+// Tags from the IANA CBOR tags registry.
+const (
+	_cborTagDateTime     = 0     // RFC 3339 string
+	_cborTagEpochTime    = 1     // seconds since the Unix epoch
+	_cborTagBignum       = 2     // unsigned bignum
+	_cborTagNegBignum    = 3     // negative bignum
+	_cborTagEmbeddedJSON = 262   // JSON document in a byte string
+	_cborTagComplex      = 43000 // [real, imaginary]
+)
+
+var _cborPool = sync.Pool{New: func() interface{} {
+	return &cborEncoder{}
+}}
+
+func getCBOREncoder() *cborEncoder {
+	return _cborPool.Get().(*cborEncoder)
+}
+
+func putCBOREncoder(enc *cborEncoder) {
+	enc.EncoderConfig = nil
+	enc.buf = nil
+	enc.openNamespaces = 0
+	_cborPool.Put(enc)
+}
+
+type cborEncoder struct {
+	*EncoderConfig
+	buf            *buffer.Buffer
+	openNamespaces int
+}
+
+// NewCBOREncoder creates an encoder that writes each entry as a CBOR map (RFC
+// 8949), so the output is a CBOR sequence (RFC 8742) of entries. It's more
+// compact and cheaper to produce than JSON; CBORToJSON converts it back to
+// JSON for humans.
+//
+// Maps, arrays, and namespaces use indefinite-length encoding, and values use
+// CBOR's native types wherever possible: binary data is a byte string, times
+// are epoch-based date/time values (tag 1), durations are integer
+// nanoseconds, complex numbers are tagged [real, imaginary] pairs (tag
+// 43000), and reflected values are embedded JSON (tag 262). Since CBOR
+// represents them natively, EncodeTime and EncodeDuration are ignored, as is
+// LineEnding; the other keys and primitive encoders in the EncoderConfig work
+// as they do for the JSON encoder. Invalid UTF-8 in strings is replaced with
+// U+FFFD.
+func NewCBOREncoder(cfg EncoderConfig) Encoder {
+	return newCBOREncoder(cfg)
+}
+
+func newCBOREncoder(cfg EncoderConfig) *cborEncoder {
+	return &cborEncoder{
+		EncoderConfig: &cfg,
+		buf:           bufferpool.Get(),
+	}
+}
+
+func (enc *cborEncoder) AddArray(key string, arr ArrayMarshaler) error {
+	enc.addKey(key)
+	return enc.AppendArray(arr)
+}
+
+func (enc *cborEncoder) AddObject(key string, obj ObjectMarshaler) error {
+	enc.addKey(key)
+	return enc.AppendObject(obj)
+}
+
+func (enc *cborEncoder) AddBinary(key string, val []byte) {
+	enc.addKey(key)
+	enc.appendHead(_cborBytes, uint64(len(val)))
+	enc.buf.Write(val)
+}
+
+func (enc *cborEncoder) AddByteString(key string, val []byte) {
+	enc.addKey(key)
+	enc.AppendByteString(val)
+}
+
+func (enc *cborEncoder) AddBool(key string, val bool) {
+	enc.addKey(key)
+	enc.AppendBool(val)
+}
+
+func (enc *cborEncoder) AddComplex128(key string, val complex128) {
+	enc.addKey(key)
+	enc.AppendComplex128(val)
+}
+
+func (enc *cborEncoder) AddDuration(key string, val time.Duration) {
+	enc.addKey(key)
+	enc.AppendDuration(val)
+}
+
+func (enc *cborEncoder) AddFloat64(key string, val float64) {
+	enc.addKey(key)
+	enc.AppendFloat64(val)
+}
+
+func (enc *cborEncoder) AddFloat32(key string, val float32) {
+	enc.addKey(key)
+	enc.AppendFloat32(val)
+}
+
+func (enc *cborEncoder) AddInt64(key string, val int64) {
+	enc.addKey(key)
+	enc.AppendInt64(val)
+}
+
+func (enc *cborEncoder) AddReflected(key string, obj interface{}) error {
+	marshaled, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	enc.addKey(key)
+	enc.appendEmbeddedJSON(marshaled)
+	return nil
+}
+
+func (enc *cborEncoder) OpenNamespace(key string) {
+	enc.addKey(key)
+	enc.buf.AppendByte(_cborMap | _cborIndefinite)
+	enc.openNamespaces++
+}
+
+func (enc *cborEncoder) AddString(key, val string) {
+	enc.addKey(key)
+	enc.AppendString(val)
+}
+
+func (enc *cborEncoder) AddTime(key string, val time.Time) {
+	enc.addKey(key)
+	enc.AppendTime(val)
+}
+
+func (enc *cborEncoder) AddUint64(key string, val uint64) {
+	enc.addKey(key)
+	enc.AppendUint64(val)
+}
+
+func (enc *cborEncoder) AppendArray(arr ArrayMarshaler) error {
+	enc.buf.AppendByte(_cborArray | _cborIndefinite)
+	err := arr.MarshalLogArray(enc)
+	enc.buf.AppendByte(_cborBreak)
+	return err
+}
+
+func (enc *cborEncoder) AppendObject(obj ObjectMarshaler) error {
+	// Namespaces opened by the object end with it.
+	outer := enc.openNamespaces
+	enc.openNamespaces = 0
+	enc.buf.AppendByte(_cborMap | _cborIndefinite)
+	err := obj.MarshalLogObject(enc)
+	enc.closeOpenNamespaces()
+	enc.buf.AppendByte(_cborBreak)
+	enc.openNamespaces = outer
+	return err
+}
+
+func (enc *cborEncoder) AppendBool(val bool) {
+	if val {
+		enc.buf.AppendByte(_cborTrue)
+	} else {
+		enc.buf.AppendByte(_cborFalse)
+	}
+}
+
+func (enc *cborEncoder) AppendByteString(val []byte) {
+	if utf8.Valid(val) {
+		enc.appendHead(_cborText, uint64(len(val)))
+		enc.buf.Write(val)
+		return
+	}
+	// CBOR text must be valid UTF-8, so replace invalid bytes with U+FFFD.
+	n := len(val)
+	for i := 0; i < len(val); {
+		r, size := utf8.DecodeRune(val[i:])
+		if r == utf8.RuneError && size == 1 {
+			n += utf8.RuneLen(utf8.RuneError) - 1
+		}
+		i += size
+	}
+	enc.appendHead(_cborText, uint64(n))
+	for i := 0; i < len(val); {
+		r, size := utf8.DecodeRune(val[i:])
+		if r == utf8.RuneError && size == 1 {
+			enc.buf.AppendString(string(utf8.RuneError))
+		} else {
+			enc.buf.Write(val[i : i+size])
+		}
+		i += size
+	}
+}
+
+func (enc *cborEncoder) AppendComplex128(val complex128) {
+	enc.appendHead(_cborTag, _cborTagComplex)
+	enc.appendHead(_cborArray, 2)
+	enc.AppendFloat64(real(val))
+	enc.AppendFloat64(imag(val))
+}
+
+func (enc *cborEncoder) AppendDuration(val time.Duration) {
+	enc.AppendInt64(int64(val))
+}
+
+func (enc *cborEncoder) AppendFloat64(val float64) {
+	enc.buf.AppendByte(_cborFloat64)
+	enc.appendUint64(math.Float64bits(val))
+}
+
+func (enc *cborEncoder) AppendFloat32(val float32) {
+	enc.buf.AppendByte(_cborFloat32)
+	bits := math.Float32bits(val)
+	enc.buf.AppendByte(byte(bits >> 24))
+	enc.buf.AppendByte(byte(bits >> 16))
+	enc.buf.AppendByte(byte(bits >> 8))
+	enc.buf.AppendByte(byte(bits))
+}
+
+func (enc *cborEncoder) AppendInt64(val int64) {
+	if val < 0 {
+		enc.appendHead(_cborNegative, uint64(-1-val))
+		return
+	}
+	enc.appendHead(_cborUnsigned, uint64(val))
+}
+
+func (enc *cborEncoder) AppendReflected(val interface{}) error {
+	marshaled, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	enc.appendEmbeddedJSON(marshaled)
+	return nil
+}
+
+func (enc *cborEncoder) AppendString(val string) {
+	if utf8.ValidString(val) {
+		enc.appendHead(_cborText, uint64(len(val)))
+		enc.buf.AppendString(val)
+		return
+	}
+	// CBOR text must be valid UTF-8, so replace invalid bytes with U+FFFD.
+	n := len(val)
+	for i := 0; i < len(val); {
+		r, size := utf8.DecodeRuneInString(val[i:])
+		if r == utf8.RuneError && size == 1 {
+			n += utf8.RuneLen(utf8.RuneError) - 1
+		}
+		i += size
+	}
+	enc.appendHead(_cborText, uint64(n))
+	for i := 0; i < len(val); {
+		r, size := utf8.DecodeRuneInString(val[i:])
+		if r == utf8.RuneError && size == 1 {
+			enc.buf.AppendString(string(utf8.RuneError))
+		} else {
+			enc.buf.AppendString(val[i : i+size])
+		}
+		i += size
+	}
+}
+
+func (enc *cborEncoder) AppendTime(val time.Time) {
+	enc.appendHead(_cborTag, _cborTagEpochTime)
+	if val.Nanosecond() == 0 {
+		enc.AppendInt64(val.Unix())
+		return
+	}
+	enc.AppendFloat64(float64(val.Unix()) + float64(val.Nanosecond())/float64(time.Second))
+}
+
+func (enc *cborEncoder) AppendUint64(val uint64) {
+	enc.appendHead(_cborUnsigned, val)
+}
+
+func (enc *cborEncoder) AddComplex64(k string, v complex64) { enc.AddComplex128(k, complex128(v)) }
+func (enc *cborEncoder) AddInt(k string, v int)             { enc.AddInt64(k, int64(v)) }
+func (enc *cborEncoder) AddInt32(k string, v int32)         { enc.AddInt64(k, int64(v)) }
+func (enc *cborEncoder) AddInt16(k string, v int16)         { enc.AddInt64(k, int64(v)) }
+func (enc *cborEncoder) AddInt8(k string, v int8)           { enc.AddInt64(k, int64(v)) }
+func (enc *cborEncoder) AddUint(k string, v uint)           { enc.AddUint64(k, uint64(v)) }
+func (enc *cborEncoder) AddUint32(k string, v uint32)       { enc.AddUint64(k, uint64(v)) }
+func (enc *cborEncoder) AddUint16(k string, v uint16)       { enc.AddUint64(k, uint64(v)) }
+func (enc *cborEncoder) AddUint8(k string, v uint8)         { enc.AddUint64(k, uint64(v)) }
+func (enc *cborEncoder) AddUintptr(k string, v uintptr)     { enc.AddUint64(k, uint64(v)) }
+func (enc *cborEncoder) AppendComplex64(v complex64)        { enc.AppendComplex128(complex128(v)) }
+func (enc *cborEncoder) AppendInt(v int)                    { enc.AppendInt64(int64(v)) }
+func (enc *cborEncoder) AppendInt32(v int32)                { enc.AppendInt64(int64(v)) }
+func (enc *cborEncoder) AppendInt16(v int16)                { enc.AppendInt64(int64(v)) }
+func (enc *cborEncoder) AppendInt8(v int8)                  { enc.AppendInt64(int64(v)) }
+func (enc *cborEncoder) AppendUint(v uint)                  { enc.AppendUint64(uint64(v)) }
+func (enc *cborEncoder) AppendUint32(v uint32)              { enc.AppendUint64(uint64(v)) }
+func (enc *cborEncoder) AppendUint16(v uint16)              { enc.AppendUint64(uint64(v)) }
+func (enc *cborEncoder) AppendUint8(v uint8)                { enc.AppendUint64(uint64(v)) }
+func (enc *cborEncoder) AppendUintptr(v uintptr)            { enc.AppendUint64(uint64(v)) }
+
+func (enc *cborEncoder) Clone() Encoder {
+	clone := enc.clone()
+	clone.buf.Write(enc.buf.Bytes())
+	return clone
+}
+
+func (enc *cborEncoder) clone() *cborEncoder {
+	clone := getCBOREncoder()
+	clone.EncoderConfig = enc.EncoderConfig
+	clone.openNamespaces = enc.openNamespaces
+	clone.buf = bufferpool.Get()
+	return clone
+}
+
+func (enc *cborEncoder) EncodeEntry(ent Entry, fields []Field) (*buffer.Buffer, error) {
+	final := enc.clone()
+	final.buf.AppendByte(_cborMap | _cborIndefinite)
+
+	if final.LevelKey != "" {
+		final.addKey(final.LevelKey)
+		cur := final.buf.Len()
+		final.EncodeLevel(ent.Level, final)
+		if cur == final.buf.Len() {
+			// User-supplied EncodeLevel was a no-op. Fall back to strings to keep
+			// output well-formed.
+			final.AppendString(ent.Level.String())
+		}
+	}
+	if final.TimeKey != "" {
+		final.AddTime(final.TimeKey, ent.Time)
+	}
+	if ent.LoggerName != "" && final.NameKey != "" {
+		final.addKey(final.NameKey)
+		cur := final.buf.Len()
+		nameEncoder := final.EncodeName
+
+		// if no name encoder provided, fall back to FullNameEncoder for
+		// backwards compatibility
+		if nameEncoder == nil {
+			nameEncoder = FullNameEncoder
+		}
+
+		nameEncoder(ent.LoggerName, final)
+		if cur == final.buf.Len() {
+			// User-supplied EncodeName was a no-op. Fall back to strings to
+			// keep output well-formed.
+			final.AppendString(ent.LoggerName)
+		}
+	}
+	if ent.Caller.Defined && final.CallerKey != "" {
+		final.addKey(final.CallerKey)
+		cur := final.buf.Len()
+		final.EncodeCaller(ent.Caller, final)
+		if cur == final.buf.Len() {
+			// User-supplied EncodeCaller was a no-op. Fall back to strings to
+			// keep output well-formed.
+			final.AppendString(ent.Caller.String())
+		}
+	}
+	if final.MessageKey != "" {
+		final.AddString(enc.MessageKey, ent.Message)
+	}
+	final.buf.Write(enc.buf.Bytes())
+	addFields(final, fields)
+	final.closeOpenNamespaces()
+	if ent.Stack != "" && final.StacktraceKey != "" {
+		final.AddString(final.StacktraceKey, ent.Stack)
+	}
+	final.buf.AppendByte(_cborBreak)
+
+	ret := final.buf
+	putCBOREncoder(final)
+	return ret, nil
+}
+
+func (enc *cborEncoder) closeOpenNamespaces() {
+	for i := 0; i < enc.openNamespaces; i++ {
+		enc.buf.AppendByte(_cborBreak)
+	}
+	enc.openNamespaces = 0
+}
+
+// appendHead writes the initial byte of an item with the given major type,
+// followed by its argument in the shortest form.
+func (enc *cborEncoder) appendHead(major byte, n uint64) {
+	switch {
+	case n < 24:
+		enc.buf.AppendByte(major | byte(n))
+	case n <= math.MaxUint8:
+		enc.buf.AppendByte(major | 24)
+		enc.buf.AppendByte(byte(n))
+	case n <= math.MaxUint16:
+		enc.buf.AppendByte(major | 25)
+		enc.buf.AppendByte(byte(n >> 8))
+		enc.buf.AppendByte(byte(n))
+	case n <= math.MaxUint32:
+		enc.buf.AppendByte(major | 26)
+		enc.buf.AppendByte(byte(n >> 24))
+		enc.buf.AppendByte(byte(n >> 16))
+		enc.buf.AppendByte(byte(n >> 8))
+		enc.buf.AppendByte(byte(n))
+	default:
+		enc.buf.AppendByte(major | 27)
+		enc.appendUint64(n)
+	}
+}
+
+// appendUint64 writes n as eight big-endian bytes.
+func (enc *cborEncoder) appendUint64(n uint64) {
+	for shift := uint(56); ; shift -= 8 {
+		enc.buf.AppendByte(byte(n >> shift))
+		if shift == 0 {
+			return
+		}
+	}
+}
+
+func (enc *cborEncoder) addKey(key string) {
+	enc.AppendString(key)
+}
+
+func (enc *cborEncoder) appendEmbeddedJSON(marshaled []byte) {
+	enc.appendHead(_cborTag, _cborTagEmbeddedJSON)
+	enc.appendHead(_cborBytes, uint64(len(marshaled)))
+	enc.buf.Write(marshaled)
+}
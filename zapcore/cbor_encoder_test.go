@@ -0,0 +1,207 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cborEncoderConfig() EncoderConfig {
+	return EncoderConfig{
+		MessageKey:    "msg",
+		LevelKey:      "level",
+		TimeKey:       "ts",
+		NameKey:       "logger",
+		CallerKey:     "caller",
+		StacktraceKey: "stacktrace",
+		EncodeLevel:   LowercaseLevelEncoder,
+		EncodeCaller:  ShortCallerEncoder,
+	}
+}
+
+func TestCBOREncoderPrimitives(t *testing.T) {
+	// Most examples are from Appendix A of RFC 8949.
+	tests := []struct {
+		desc     string
+		f        func(ArrayEncoder)
+		expected string
+	}{
+		{"small uint", func(e ArrayEncoder) { e.AppendUint(23) }, "17"},
+		{"one-byte uint", func(e ArrayEncoder) { e.AppendUint8(24) }, "1818"},
+		{"two-byte uint", func(e ArrayEncoder) { e.AppendUint16(1000) }, "1903e8"},
+		{"four-byte uint", func(e ArrayEncoder) { e.AppendUint32(1000000) }, "1a000f4240"},
+		{"eight-byte uint", func(e ArrayEncoder) { e.AppendUint64(math.MaxUint64) }, "1bffffffffffffffff"},
+		{"positive int", func(e ArrayEncoder) { e.AppendInt(100) }, "1864"},
+		{"negative int", func(e ArrayEncoder) { e.AppendInt16(-1000) }, "3903e7"},
+		{"min int", func(e ArrayEncoder) { e.AppendInt64(math.MinInt64) }, "3b7fffffffffffffff"},
+		{"bools", func(e ArrayEncoder) {
+			e.AppendBool(false)
+			e.AppendBool(true)
+		}, "f4f5"},
+		{"float64", func(e ArrayEncoder) { e.AppendFloat64(1.1) }, "fb3ff199999999999a"},
+		{"float32", func(e ArrayEncoder) { e.AppendFloat32(100000) }, "fa47c35000"},
+		{"NaN", func(e ArrayEncoder) { e.AppendFloat64(math.NaN()) }, "fb7ff8000000000001"},
+		{"complex", func(e ArrayEncoder) { e.AppendComplex64(1 + 2i) }, "d9a7f882fb3ff0000000000000fb4000000000000000"},
+		{"duration", func(e ArrayEncoder) { e.AppendDuration(time.Microsecond) }, "1903e8"},
+		{"time", func(e ArrayEncoder) { e.AppendTime(time.Unix(1363896240, 0)) }, "c11a514b67b0"},
+		{"fractional time", func(e ArrayEncoder) { e.AppendTime(time.Unix(1363896240, 5e8)) }, "c1fb41d452d9ec200000"},
+		{"string", func(e ArrayEncoder) { e.AppendString("IETF") }, "6449455446"},
+		{"invalid UTF-8", func(e ArrayEncoder) { e.AppendString("a\xffb") }, "6561efbfbd62"},
+		{"byte string", func(e ArrayEncoder) { e.AppendByteString([]byte("ü")) }, "62c3bc"},
+		{"invalid UTF-8 byte string", func(e ArrayEncoder) { e.AppendByteString([]byte{0xff}) }, "63efbfbd"},
+		{"reflected", func(e ArrayEncoder) { e.AppendReflected(map[string]int{"a": 1}) }, "d90106477b2261223a317d"},
+		{"array", func(e ArrayEncoder) {
+			e.AppendArray(ArrayMarshalerFunc(func(arr ArrayEncoder) error {
+				arr.AppendInt(1)
+				return arr.AppendArray(ArrayMarshalerFunc(func(ArrayEncoder) error { return nil }))
+			}))
+		}, "9f019fffff"},
+		{"object", func(e ArrayEncoder) { e.AppendObject(loggable{true}) }, "bf686c6f676761626c6563796573ff"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			enc := newCBOREncoder(cborEncoderConfig())
+			tt.f(enc)
+			assert.Equal(t, tt.expected, hex.EncodeToString(enc.buf.Bytes()), "Unexpected CBOR.")
+		})
+	}
+}
+
+func TestCBOREncodeEntry(t *testing.T) {
+	ts := time.Unix(1533567845, 0)
+	caller := EntryCaller{Defined: true, File: "/src/app/main.go", Line: 42}
+
+	tests := []struct {
+		desc     string
+		cfg      func(*EncoderConfig)
+		ent      Entry
+		fields   []Field
+		expected string
+	}{
+		{
+			desc: "metadata and fields",
+			ent: Entry{
+				Level:      ErrorLevel,
+				Time:       ts,
+				LoggerName: "main.db",
+				Message:    "query failed",
+				Caller:     caller,
+				Stack:      "goroutine 1",
+			},
+			fields: []Field{
+				{Key: "table", Type: StringType, String: "users"},
+				{Key: "elapsed", Type: DurationType, Integer: int64(time.Millisecond)},
+				{Key: "raw", Type: BinaryType, Interface: []byte("foo")},
+			},
+			expected: `{"level":"error","ts":"2018-08-06T15:04:05Z","logger":"main.db","caller":"app/main.go:42",` +
+				`"msg":"query failed","table":"users","elapsed":1000000,"raw":"Zm9v","stacktrace":"goroutine 1"}`,
+		},
+		{
+			desc: "omitted keys",
+			cfg: func(cfg *EncoderConfig) {
+				cfg.LevelKey = ""
+				cfg.TimeKey = ""
+				cfg.CallerKey = ""
+				cfg.StacktraceKey = ""
+			},
+			ent:      Entry{Message: "hi", Caller: caller, Stack: "s"},
+			expected: `{"msg":"hi"}`,
+		},
+		{
+			desc: "no-op encoders",
+			cfg: func(cfg *EncoderConfig) {
+				cfg.TimeKey = ""
+				cfg.EncodeLevel = func(Level, PrimitiveArrayEncoder) {}
+				cfg.EncodeName = func(string, PrimitiveArrayEncoder) {}
+				cfg.EncodeCaller = func(EntryCaller, PrimitiveArrayEncoder) {}
+			},
+			ent:      Entry{Level: WarnLevel, LoggerName: "svc", Caller: caller},
+			expected: `{"level":"warn","logger":"svc","caller":"/src/app/main.go:42","msg":""}`,
+		},
+		{
+			desc: "namespaces",
+			cfg:  func(cfg *EncoderConfig) { cfg.TimeKey = "" },
+			ent:  Entry{Level: InfoLevel, Message: "m", Stack: "s"},
+			fields: []Field{
+				{Key: "outer", Type: NamespaceType},
+				{Key: "obj", Type: ObjectMarshalerType, Interface: ObjectMarshalerFunc(func(enc ObjectEncoder) error {
+					enc.OpenNamespace("inner")
+					enc.AddInt("a", 1)
+					return nil
+				})},
+				{Key: "b", Type: BoolType, Integer: 1},
+			},
+			expected: `{"level":"info","msg":"m","outer":{"obj":{"inner":{"a":1}},"b":true},"stacktrace":"s"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg := cborEncoderConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			buf, err := NewCBOREncoder(cfg).EncodeEntry(tt.ent, tt.fields)
+			require.NoError(t, err, "Unexpected CBOR encoding error.")
+			out, err := cborToJSONString(buf.Bytes())
+			require.NoError(t, err, "Couldn't convert CBOR to JSON.")
+			assert.Equal(t, tt.expected+"\n", out, "Unexpected entry.")
+			buf.Free()
+		})
+	}
+}
+
+func TestCBOREncoderClone(t *testing.T) {
+	cfg := EncoderConfig{MessageKey: "msg"}
+	parent := NewCBOREncoder(cfg)
+	parent.OpenNamespace("ns")
+	parent.AddString("parent", "yes")
+	clone := parent.Clone()
+	clone.AddString("child", "yes")
+
+	ent := Entry{Message: "m"}
+	var out bytes.Buffer
+	for _, enc := range []Encoder{parent, clone} {
+		buf, err := enc.EncodeEntry(ent, []Field{{Key: "entry", Type: StringType, String: "yes"}})
+		require.NoError(t, err, "Unexpected error encoding entry.")
+		out.Write(buf.Bytes())
+	}
+
+	json, err := cborToJSONString(out.Bytes())
+	require.NoError(t, err, "Couldn't convert CBOR to JSON.")
+	assert.Equal(t, `{"msg":"m","ns":{"parent":"yes","entry":"yes"}}`+"\n"+
+		`{"msg":"m","ns":{"parent":"yes","child":"yes","entry":"yes"}}`+"\n", json, "Expected the clone to inherit context and namespaces.")
+}
+
+func TestCBOREncoderErrors(t *testing.T) {
+	enc := NewCBOREncoder(cborEncoderConfig())
+	assert.Error(t, enc.AddObject("k", loggable{false}), "Expected object marshaling errors to propagate.")
+	assert.Error(t, enc.AddArray("k", loggable{false}), "Expected array marshaling errors to propagate.")
+	assert.Error(t, enc.AddReflected("k", func() {}), "Expected reflection errors to propagate.")
+}
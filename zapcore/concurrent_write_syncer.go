@@ -0,0 +1,287 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// _maxBatchBytes caps how much queued output a destination's goroutine
+// combines into a single write.
+const _maxBatchBytes = 64 * 1024
+
+type concurrentMultiWriteSyncer struct {
+	mu      sync.RWMutex // held for writing only while closing
+	closed  bool
+	timeout time.Duration
+	dests   []*destination
+}
+
+// A destination owns one of a concurrentMultiWriteSyncer's WriteSyncers and
+// the goroutine that writes to it.
+type destination struct {
+	index int
+	ws    WriteSyncer
+	queue chan destinationOp
+	done  chan struct{}
+
+	// Owned by the goroutine.
+	buf []byte
+	err error // from a background write, reported by the next Sync
+}
+
+// A destinationOp is either a write or, if sync isn't nil, a request to sync
+// after every preceding write.
+type destinationOp struct {
+	bs   []byte
+	sync chan error
+}
+
+// NewConcurrentMultiWriteSyncer creates a WriteSyncer that duplicates its
+// writes and sync calls, like NewMultiWriteSyncer, but writes to each
+// destination from its own goroutine. A slow destination then only delays
+// its own output, and an error from one destination never affects the
+// others.
+//
+// Each destination has a queue that holds up to queueSize writes; a
+// non-positive size defaults to 1024. Whenever a destination's goroutine
+// falls behind, it combines the queued writes into as few calls to the
+// underlying WriteSyncer as possible. If a destination's queue is full,
+// Write waits up to timeout for room before dropping the write for that
+// destination and returning an error; a non-positive timeout waits as long as
+// necessary. Errors from the underlying writes are reported by the next call
+// to Sync.
+//
+// Sync waits until each destination has written everything queued before
+// the call, then syncs it. Destinations that don't finish within timeout are
+// reported as errors, but they aren't interrupted.
+//
+// Callers should use the returned CloseFunc to drain the queues and stop the
+// background goroutines before exiting. Writes after closing go straight to
+// the destinations, in sequence.
+func NewConcurrentMultiWriteSyncer(queueSize int, timeout time.Duration, ws ...WriteSyncer) (WriteSyncer, CloseFunc) {
+	if queueSize <= 0 {
+		queueSize = _defaultQueueSize
+	}
+
+	s := &concurrentMultiWriteSyncer{
+		timeout: timeout,
+		dests:   make([]*destination, len(ws)),
+	}
+	for i, w := range ws {
+		d := &destination{
+			index: i,
+			ws:    w,
+			queue: make(chan destinationOp, queueSize),
+			done:  make(chan struct{}),
+		}
+		s.dests[i] = d
+		go d.run()
+	}
+	return s, s.close
+}
+
+func (s *concurrentMultiWriteSyncer) Write(bs []byte) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return s.syncers().Write(bs)
+	}
+
+	// The caller may reuse bs as soon as we return, but the destinations
+	// only read their writes, so they can share a single copy.
+	op := destinationOp{bs: append([]byte(nil), bs...)}
+	var (
+		err     error
+		expired <-chan struct{}
+	)
+	for _, d := range s.dests {
+		select {
+		case d.queue <- op:
+			continue
+		default:
+		}
+
+		// Share one deadline across the destinations, so that a write waits
+		// at most timeout in total.
+		if expired == nil && s.timeout > 0 {
+			var stop func() bool
+			expired, stop = closeAfter(s.timeout)
+			defer stop()
+		}
+		select {
+		case d.queue <- op:
+		case <-expired:
+			err = multierr.Append(err, fmt.Errorf("destination %d: queue full, dropped write", d.index))
+		}
+	}
+	return len(bs), err
+}
+
+func (s *concurrentMultiWriteSyncer) Sync() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return s.syncers().Sync()
+	}
+
+	var expired <-chan struct{}
+	if s.timeout > 0 {
+		var stop func() bool
+		expired, stop = closeAfter(s.timeout)
+		defer stop()
+	}
+
+	// Queue a request on every destination with room before waiting on any
+	// of them, so that the destinations sync concurrently.
+	replies := make([]chan error, len(s.dests))
+	for i, d := range s.dests {
+		reply := make(chan error, 1)
+		select {
+		case d.queue <- destinationOp{sync: reply}:
+			replies[i] = reply
+		default:
+		}
+	}
+	var err error
+	for i, d := range s.dests {
+		if replies[i] != nil {
+			continue
+		}
+		reply := make(chan error, 1)
+		select {
+		case d.queue <- destinationOp{sync: reply}:
+			replies[i] = reply
+		case <-expired:
+			err = multierr.Append(err, fmt.Errorf("destination %d: timed out queueing sync", d.index))
+		}
+	}
+	for i, reply := range replies {
+		if reply == nil {
+			continue
+		}
+		var syncErr error
+		select {
+		case syncErr = <-reply:
+		case <-expired:
+			// The deadline may have passed while we waited on another
+			// destination, so only give up on replies that haven't arrived.
+			select {
+			case syncErr = <-reply:
+			default:
+				syncErr = errors.New("timed out syncing")
+			}
+		}
+		if syncErr != nil {
+			err = multierr.Append(err, fmt.Errorf("destination %d: %v", i, syncErr))
+		}
+	}
+	return err
+}
+
+// closeAfter returns a channel that's closed once d elapses, unlike a timer's
+// channel, which only wakes a single receiver. The returned function stops
+// the timer.
+func closeAfter(d time.Duration) (<-chan struct{}, func() bool) {
+	expired := make(chan struct{})
+	t := time.AfterFunc(d, func() { close(expired) })
+	return expired, t.Stop
+}
+
+func (s *concurrentMultiWriteSyncer) syncers() multiWriteSyncer {
+	ws := make(multiWriteSyncer, len(s.dests))
+	for i, d := range s.dests {
+		ws[i] = d.ws
+	}
+	return ws
+}
+
+func (s *concurrentMultiWriteSyncer) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var err error
+	for _, d := range s.dests {
+		close(d.queue)
+	}
+	for _, d := range s.dests {
+		<-d.done
+		if d.err != nil {
+			err = multierr.Append(err, fmt.Errorf("destination %d: %v", d.index, d.err))
+		}
+		if syncErr := d.ws.Sync(); syncErr != nil {
+			err = multierr.Append(err, fmt.Errorf("destination %d: %v", d.index, syncErr))
+		}
+	}
+	return err
+}
+
+func (d *destination) run() {
+	defer close(d.done)
+
+	for op := range d.queue {
+		for op.sync == nil {
+			d.buf = append(d.buf, op.bs...)
+			if len(d.buf) >= _maxBatchBytes {
+				break
+			}
+			var ok bool
+			select {
+			case op, ok = <-d.queue:
+			default:
+			}
+			if !ok {
+				break
+			}
+		}
+		d.flush()
+		if op.sync != nil {
+			err := d.err
+			d.err = nil
+			if syncErr := d.ws.Sync(); err == nil {
+				err = syncErr
+			}
+			op.sync <- err
+		}
+	}
+}
+
+func (d *destination) flush() {
+	if len(d.buf) == 0 {
+		return
+	}
+	if _, err := d.ws.Write(d.buf); err != nil && d.err == nil {
+		d.err = err
+	}
+	d.buf = d.buf[:0]
+}
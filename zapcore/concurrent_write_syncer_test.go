@@ -0,0 +1,162 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/internal/ztest"
+)
+
+// blockDestinations writes to ws until the goroutines for the given
+// destinations are blocked on their gated WriteSyncers.
+func blockDestinations(t testing.TB, ws WriteSyncer, is ...int) {
+	ws.Write([]byte("1\n"))
+	deadline := time.Now().Add(ztest.Timeout(time.Second))
+	for _, i := range is {
+		d := ws.(*concurrentMultiWriteSyncer).dests[i]
+		for len(d.queue) > 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		require.Equal(t, 0, len(d.queue), "Expected the first write to be dequeued.")
+	}
+}
+
+func TestConcurrentMultiWriteSyncerWritesAll(t *testing.T) {
+	first, second := &lockedBuffer{}, &lockedBuffer{}
+	ws, stop := NewConcurrentMultiWriteSyncer(0, time.Second, first, second)
+	defer stop()
+
+	for _, s := range []string{"foo\n", "bar\n"} {
+		n, err := ws.Write([]byte(s))
+		require.NoError(t, err, "Unexpected error writing.")
+		assert.Equal(t, len(s), n, "Unexpected number of bytes written.")
+	}
+	require.NoError(t, ws.Sync(), "Unexpected error syncing.")
+
+	for _, buf := range []*lockedBuffer{first, second} {
+		assert.Equal(t, "foo\nbar\n", buf.String(), "Unexpected output.")
+		assert.Equal(t, 1, buf.syncs, "Expected Sync to sync every destination.")
+	}
+}
+
+func TestConcurrentMultiWriteSyncerBatchesWrites(t *testing.T) {
+	buf := &gatedBuffer{gate: make(chan struct{})}
+	ws, stop := NewConcurrentMultiWriteSyncer(0, 0, buf)
+	defer stop()
+
+	blockDestinations(t, ws, 0)
+	for _, s := range []string{"2\n", "3\n", "4\n"} {
+		ws.Write([]byte(s))
+	}
+	close(buf.gate)
+	require.NoError(t, ws.Sync(), "Unexpected error syncing.")
+
+	assert.Equal(t, "1\n2\n3\n4\n", buf.String(), "Unexpected output.")
+	assert.Equal(t, 2, buf.Writes(), "Expected queued writes to be combined.")
+}
+
+func TestConcurrentMultiWriteSyncerIsolatesSlowDestinations(t *testing.T) {
+	slow, fast := &gatedBuffer{gate: make(chan struct{})}, &lockedBuffer{}
+	ws, stop := NewConcurrentMultiWriteSyncer(1, 10*time.Millisecond, slow, fast)
+	defer stop()
+	defer close(slow.gate)
+
+	blockDestinations(t, ws, 0)
+	_, err := ws.Write([]byte("2\n"))
+	assert.NoError(t, err, "Unexpected error queueing a write.")
+	_, err = ws.Write([]byte("3\n"))
+	assert.EqualError(t, err, "destination 0: queue full, dropped write", "Expected an error from the full destination.")
+
+	err = ws.Sync()
+	assert.EqualError(t, err, "destination 0: timed out queueing sync", "Expected Sync to time out on the slow destination.")
+	assert.Equal(t, "1\n2\n3\n", fast.String(), "Expected the fast destination to get every write.")
+	assert.Equal(t, 1, fast.syncs, "Expected the fast destination to be synced.")
+}
+
+func TestConcurrentMultiWriteSyncerTimesOutEveryDestination(t *testing.T) {
+	first, second := &gatedBuffer{gate: make(chan struct{})}, &gatedBuffer{gate: make(chan struct{})}
+	ws, stop := NewConcurrentMultiWriteSyncer(1, 10*time.Millisecond, first, second)
+	defer stop()
+	defer close(second.gate)
+	defer close(first.gate)
+
+	blockDestinations(t, ws, 0, 1)
+	ws.Write([]byte("2\n"))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := ws.Write([]byte("3\n"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.EqualError(t, err, "destination 0: queue full, dropped write; destination 1: queue full, dropped write", "Expected both destinations to drop the write.")
+	case <-time.After(ztest.Timeout(time.Second)):
+		t.Fatal("Write didn't time out on every hung destination.")
+	}
+
+	go func() { done <- ws.Sync() }()
+	select {
+	case err := <-done:
+		assert.EqualError(t, err, "destination 0: timed out queueing sync; destination 1: timed out queueing sync", "Expected Sync to time out on both destinations.")
+	case <-time.After(ztest.Timeout(time.Second)):
+		t.Fatal("Sync didn't time out on every hung destination.")
+	}
+}
+
+func TestConcurrentMultiWriteSyncerIsolatesErrors(t *testing.T) {
+	failing, ok := &lockedBuffer{}, &lockedBuffer{}
+	failing.SetError(errors.New("fail"))
+	ws, stop := NewConcurrentMultiWriteSyncer(0, time.Second, failing, ok)
+	defer stop()
+
+	_, err := ws.Write([]byte("foo\n"))
+	assert.NoError(t, err, "Expected write errors to be reported by Sync.")
+	assert.EqualError(t, ws.Sync(), "destination 0: fail", "Expected Sync to report the write error.")
+	assert.Equal(t, "foo\n", ok.String(), "Expected the other destination to be written.")
+
+	assert.NoError(t, ws.Sync(), "Expected each write error to be reported once.")
+}
+
+func TestConcurrentMultiWriteSyncerClose(t *testing.T) {
+	first, second := &lockedBuffer{}, &lockedBuffer{}
+	first.SetError(errors.New("fail"))
+	ws, stop := NewConcurrentMultiWriteSyncer(0, time.Second, first, second)
+
+	ws.Write([]byte("foo\n"))
+	assert.EqualError(t, stop(), "destination 0: fail", "Expected close to report the write error.")
+	assert.Equal(t, "foo\n", second.String(), "Expected close to drain the queue.")
+	assert.Equal(t, 1, second.syncs, "Expected close to sync.")
+	assert.NoError(t, stop(), "Expected closing twice to succeed.")
+
+	first.SetError(nil)
+	_, err := ws.Write([]byte("bar\n"))
+	assert.NoError(t, err, "Unexpected error writing after close.")
+	assert.NoError(t, ws.Sync(), "Unexpected error syncing after close.")
+	assert.Equal(t, "bar\n", first.String(), "Expected writes after close to pass through.")
+	assert.Equal(t, "foo\nbar\n", second.String(), "Expected writes after close to pass through.")
+}
@@ -20,6 +20,8 @@
 
 package zapcore
 
+import "context"
+
 // Core is a minimal, fast logger interface. It's designed for library authors
 // to wrap in a more user-friendly API.
 type Core interface {
@@ -104,6 +106,10 @@ func (c *ioCore) Sync() error {
 	return c.out.Sync()
 }
 
+func (c *ioCore) SyncContext(ctx context.Context) error {
+	return syncContext(ctx, c.out)
+}
+
 func (c *ioCore) clone() *ioCore {
 	return &ioCore{
 		LevelEnabler: c.LevelEnabler,
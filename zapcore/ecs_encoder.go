@@ -0,0 +1,258 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"runtime"
+	"sync"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/internal/bufferpool"
+)
+
+// ECSVersion is the version of the Elastic Common Schema that the ECS
+// encoder follows.
+const ECSVersion = "1.6.0"
+
+var _ecsPool = sync.Pool{New: func() interface{} {
+	return &ecsEncoder{}
+}}
+
+func getECSEncoder() *ecsEncoder {
+	return _ecsPool.Get().(*ecsEncoder)
+}
+
+func putECSEncoder(enc *ecsEncoder) {
+	if enc.errCauses != nil {
+		enc.errCauses.Free()
+	}
+	putJSONEncoder(enc.jsonEncoder)
+	enc.jsonEncoder = nil
+	enc.hasError = false
+	enc.errMessage = ""
+	enc.errVerbose = ""
+	enc.errCauses = nil
+	_ecsPool.Put(enc)
+}
+
+type ecsEncoder struct {
+	*jsonEncoder
+
+	// The most recent error added outside any namespace, which is written
+	// as the ECS error object rather than as ordinary fields.
+	hasError   bool
+	errMessage string
+	errVerbose string
+	errCauses  *buffer.Buffer // a JSON array, or nil
+}
+
+// NewECSEncoder creates an encoder that writes each entry as a JSON document
+// following the Elastic Common Schema, as used by Elasticsearch and Kibana.
+// For example:
+//   {"@timestamp":"2018-08-06T15:04:05.123Z","log.level":"error",
+//    "message":"query failed","ecs.version":"1.6.0",
+//    "log":{"logger":"main.db","origin":{"file":{"name":"/src/app/db.go",
+//    "line":42},"function":"main.query"}},"table":"users",
+//    "error":{"message":"timeout","stack_trace":"..."}}
+//
+// As the ECS logging specification requires, the timestamp, level, message,
+// and ECS version are written first, under dotted keys. The logger name and
+// caller are written in the nested log object, and the entry's fields follow.
+// The encoder always uses the ECS names, so the keys in its EncoderConfig
+// only control whether each part of the entry is written; EncodeTime,
+// EncodeLevel, EncodeName, and EncodeDuration are honored, but EncodeCaller
+// is ignored. NewECSEncoderConfig in the zap package returns a suitable
+// configuration.
+//
+// Errors are moved into the ECS error object: the "error", "errorVerbose",
+// and "errorCauses" fields that zap.Error produces, when they're added
+// outside any namespace, become error.message, error.stack_trace, and
+// error.causes. If the error has no verbose form and StacktraceKey is set,
+// the entry's stacktrace is used as error.stack_trace instead. When several
+// errors are added, the last one wins.
+func NewECSEncoder(cfg EncoderConfig) Encoder {
+	return &ecsEncoder{jsonEncoder: newJSONEncoder(cfg, false)}
+}
+
+func (enc *ecsEncoder) AddArray(key string, arr ArrayMarshaler) error {
+	if key != "errorCauses" || enc.openNamespaces > 0 {
+		return enc.jsonEncoder.AddArray(key, arr)
+	}
+	causes := getJSONEncoder()
+	causes.EncoderConfig = enc.EncoderConfig
+	causes.buf = bufferpool.Get()
+	err := causes.AppendArray(arr)
+	if enc.errCauses != nil {
+		enc.errCauses.Free()
+	}
+	enc.errCauses = causes.buf
+	putJSONEncoder(causes)
+	return err
+}
+
+func (enc *ecsEncoder) AddString(key, val string) {
+	if enc.openNamespaces == 0 {
+		switch key {
+		case "error":
+			// A new error replaces any earlier one, including its verbose
+			// form and causes.
+			enc.hasError = true
+			enc.errMessage = val
+			enc.errVerbose = ""
+			if enc.errCauses != nil {
+				enc.errCauses.Free()
+				enc.errCauses = nil
+			}
+			return
+		case "errorVerbose":
+			enc.errVerbose = val
+			return
+		}
+	}
+	enc.jsonEncoder.AddString(key, val)
+}
+
+func (enc *ecsEncoder) Clone() Encoder {
+	clone := enc.clone()
+	clone.buf.Write(enc.buf.Bytes())
+	return clone
+}
+
+func (enc *ecsEncoder) clone() *ecsEncoder {
+	clone := getECSEncoder()
+	clone.jsonEncoder = enc.jsonEncoder.clone()
+	clone.hasError = enc.hasError
+	clone.errMessage = enc.errMessage
+	clone.errVerbose = enc.errVerbose
+	if enc.errCauses != nil {
+		clone.errCauses = bufferpool.Get()
+		clone.errCauses.Write(enc.errCauses.Bytes())
+	}
+	return clone
+}
+
+func (enc *ecsEncoder) EncodeEntry(ent Entry, fields []Field) (*buffer.Buffer, error) {
+	// Encode the fields first, so that any errors among them are known
+	// before the ECS error object is written.
+	final := enc.clone()
+	final.buf.Write(enc.buf.Bytes())
+	addFields(final, fields)
+	final.closeOpenNamespaces()
+
+	line := bufferpool.Get()
+	meta := getJSONEncoder()
+	meta.EncoderConfig = final.EncoderConfig
+	meta.buf = line
+	line.AppendByte('{')
+
+	if final.TimeKey != "" {
+		meta.AddTime("@timestamp", ent.Time)
+	}
+	if final.LevelKey != "" {
+		meta.addKey("log.level")
+		cur := line.Len()
+		final.EncodeLevel(ent.Level, meta)
+		if cur == line.Len() {
+			// User-supplied EncodeLevel was a no-op. Fall back to strings to keep
+			// output JSON valid.
+			meta.AppendString(ent.Level.String())
+		}
+	}
+	if final.MessageKey != "" {
+		meta.AddString("message", ent.Message)
+	}
+	meta.AddString("ecs.version", ECSVersion)
+
+	hasName := ent.LoggerName != "" && final.NameKey != ""
+	hasCaller := ent.Caller.Defined && final.CallerKey != ""
+	if hasName || hasCaller {
+		meta.addKey("log")
+		line.AppendByte('{')
+		if hasName {
+			meta.addKey("logger")
+			cur := line.Len()
+			nameEncoder := final.EncodeName
+
+			// if no name encoder provided, fall back to FullNameEncoder for
+			// backwards compatibility
+			if nameEncoder == nil {
+				nameEncoder = FullNameEncoder
+			}
+
+			nameEncoder(ent.LoggerName, meta)
+			if cur == line.Len() {
+				// User-supplied EncodeName was a no-op. Fall back to strings to
+				// keep output JSON valid.
+				meta.AppendString(ent.LoggerName)
+			}
+		}
+		if hasCaller {
+			meta.addKey("origin")
+			line.AppendString(`{"file":{"name":`)
+			meta.AppendString(ent.Caller.File)
+			line.AppendString(`,"line":`)
+			line.AppendInt(int64(ent.Caller.Line))
+			line.AppendByte('}')
+			if fn := runtime.FuncForPC(ent.Caller.PC); fn != nil {
+				meta.AddString("function", fn.Name())
+			}
+			line.AppendByte('}')
+		}
+		line.AppendByte('}')
+	}
+
+	if final.buf.Len() > 0 {
+		meta.addElementSeparator()
+		line.Write(final.buf.Bytes())
+	}
+
+	stack := final.errVerbose
+	if stack == "" && final.StacktraceKey != "" {
+		stack = ent.Stack
+	}
+	if final.hasError || stack != "" || final.errCauses != nil {
+		meta.addKey("error")
+		line.AppendByte('{')
+		if final.hasError {
+			meta.AddString("message", final.errMessage)
+		}
+		if stack != "" {
+			meta.AddString("stack_trace", stack)
+		}
+		if final.errCauses != nil {
+			meta.addKey("causes")
+			line.Write(final.errCauses.Bytes())
+		}
+		line.AppendByte('}')
+	}
+
+	line.AppendByte('}')
+	if final.LineEnding != "" {
+		line.AppendString(final.LineEnding)
+	} else {
+		line.AppendString(DefaultLineEnding)
+	}
+
+	final.buf.Free()
+	putECSEncoder(final)
+	putJSONEncoder(meta)
+	return line, nil
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/multierr"
+)
+
+// verboseError has a verbose form, like the errors from github.com/pkg/errors.
+type verboseError string
+
+func (e verboseError) Error() string { return string(e) }
+
+func (e verboseError) Format(s fmt.State, verb rune) {
+	io.WriteString(s, string(e))
+	if verb == 'v' && s.Flag('+') {
+		io.WriteString(s, "\nmain.query\n\t/src/app/db.go:17")
+	}
+}
+
+func ecsEncoderConfig() EncoderConfig {
+	return EncoderConfig{
+		TimeKey:        "@timestamp",
+		LevelKey:       "log.level",
+		NameKey:        "log.logger",
+		CallerKey:      "log.origin",
+		MessageKey:     "message",
+		StacktraceKey:  "error.stack_trace",
+		EncodeLevel:    LowercaseLevelEncoder,
+		EncodeTime:     ISO8601TimeEncoder,
+		EncodeDuration: NanosDurationEncoder,
+	}
+}
+
+func TestECSEncodeEntry(t *testing.T) {
+	ts := time.Date(2018, 8, 6, 15, 4, 5, 123456789, time.UTC)
+	caller := EntryCaller{Defined: true, File: "/src/app/db.go", Line: 42}
+
+	tests := []struct {
+		desc     string
+		cfg      func(*EncoderConfig)
+		ent      Entry
+		fields   []Field
+		expected string
+	}{
+		{
+			desc: "metadata and fields",
+			ent: Entry{
+				Level:      ErrorLevel,
+				Time:       ts,
+				LoggerName: "main.db",
+				Message:    "query failed",
+				Caller:     caller,
+				Stack:      "goroutine 1\nmain.main()",
+			},
+			fields: []Field{
+				{Key: "table", Type: StringType, String: "users"},
+				{Key: "elapsed", Type: DurationType, Integer: int64(time.Second)},
+			},
+			expected: `{"@timestamp":"2018-08-06T15:04:05.123Z","log.level":"error","message":"query failed",` +
+				`"ecs.version":"1.6.0","log":{"logger":"main.db","origin":{"file":{"name":"/src/app/db.go","line":42}}},` +
+				`"table":"users","elapsed":1000000000,"error":{"stack_trace":"goroutine 1\nmain.main()"}}` + "\n",
+		},
+		{
+			desc: "omitted keys",
+			cfg: func(cfg *EncoderConfig) {
+				*cfg = EncoderConfig{LineEnding: "\r\n"}
+			},
+			ent:      Entry{Level: DebugLevel, Time: ts, LoggerName: "main", Message: "hi", Caller: caller, Stack: "s"},
+			expected: `{"ecs.version":"1.6.0"}` + "\r\n",
+		},
+		{
+			desc: "no-op encoders",
+			cfg: func(cfg *EncoderConfig) {
+				cfg.TimeKey = ""
+				cfg.EncodeLevel = func(Level, PrimitiveArrayEncoder) {}
+				cfg.EncodeName = func(string, PrimitiveArrayEncoder) {}
+			},
+			ent:      Entry{Level: InfoLevel, LoggerName: "svc", Message: "m"},
+			expected: `{"log.level":"info","message":"m","ecs.version":"1.6.0","log":{"logger":"svc"}}` + "\n",
+		},
+		{
+			desc: "errors",
+			cfg:  func(cfg *EncoderConfig) { cfg.TimeKey = "" },
+			ent:  Entry{Level: ErrorLevel, Message: "m", Stack: "ignored"},
+			fields: []Field{
+				{Key: "error", Type: ErrorType, Interface: verboseError("timeout")},
+				{Key: "k", Type: StringType, String: "v"},
+			},
+			expected: `{"log.level":"error","message":"m","ecs.version":"1.6.0","k":"v",` +
+				`"error":{"message":"timeout","stack_trace":"timeout\nmain.query\n\t/src/app/db.go:17"}}` + "\n",
+		},
+		{
+			desc: "error causes and entry stacktrace",
+			cfg:  func(cfg *EncoderConfig) { cfg.TimeKey = "" },
+			ent:  Entry{Level: ErrorLevel, Message: "m", Stack: "goroutine 1"},
+			fields: []Field{
+				{Key: "error", Type: ErrorType, Interface: multierr.Append(errors.New("foo"), errors.New("bar"))},
+			},
+			expected: `{"log.level":"error","message":"m","ecs.version":"1.6.0",` +
+				`"error":{"message":"foo; bar","stack_trace":"goroutine 1","causes":[{"error":"foo"},{"error":"bar"}]}}` + "\n",
+		},
+		{
+			desc: "the last error wins",
+			cfg: func(cfg *EncoderConfig) {
+				cfg.TimeKey = ""
+				cfg.StacktraceKey = ""
+			},
+			ent: Entry{Level: ErrorLevel, Message: "m", Stack: "goroutine 1"},
+			fields: []Field{
+				{Key: "error", Type: ErrorType, Interface: verboseError("first")},
+				{Key: "error", Type: ErrorType, Interface: errors.New("second")},
+			},
+			expected: `{"log.level":"error","message":"m","ecs.version":"1.6.0","error":{"message":"second"}}` + "\n",
+		},
+		{
+			desc: "other keys and namespaces aren't moved",
+			cfg:  func(cfg *EncoderConfig) { cfg.TimeKey = "" },
+			ent:  Entry{Level: WarnLevel, Message: "m"},
+			fields: []Field{
+				{Key: "cause", Type: ErrorType, Interface: verboseError("nested")},
+				{Key: "http", Type: NamespaceType},
+				{Key: "error", Type: StringType, String: "404"},
+			},
+			expected: `{"log.level":"warn","message":"m","ecs.version":"1.6.0",` +
+				`"cause":"nested","causeVerbose":"nested\nmain.query\n\t/src/app/db.go:17","http":{"error":"404"}}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg := ecsEncoderConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			buf, err := NewECSEncoder(cfg).EncodeEntry(tt.ent, tt.fields)
+			require.NoError(t, err, "Unexpected error encoding entry.")
+			defer buf.Free()
+			assert.Equal(t, tt.expected, buf.String(), "Unexpected ECS output.")
+
+			var doc map[string]interface{}
+			assert.NoError(t, json.Unmarshal(buf.Bytes(), &doc), "Expected valid JSON.")
+		})
+	}
+}
+
+func TestECSEncoderCallerFunction(t *testing.T) {
+	pc, file, line, ok := runtime.Caller(0)
+	require.True(t, ok, "Couldn't find caller.")
+	cfg := ecsEncoderConfig()
+	cfg.TimeKey = ""
+	cfg.LevelKey = ""
+	cfg.MessageKey = ""
+
+	buf, err := NewECSEncoder(cfg).EncodeEntry(Entry{Caller: NewEntryCaller(pc, file, line, ok)}, nil)
+	require.NoError(t, err, "Unexpected error encoding entry.")
+	defer buf.Free()
+	assert.Equal(t,
+		`{"ecs.version":"1.6.0","log":{"origin":{"file":{"name":"`+file+`","line":`+fmt.Sprint(line)+`},`+
+			`"function":"go.uber.org/zap/zapcore.TestECSEncoderCallerFunction"}}}`+"\n",
+		buf.String(),
+		"Unexpected caller.",
+	)
+}
+
+func TestECSEncoderClone(t *testing.T) {
+	cfg := ecsEncoderConfig()
+	cfg.TimeKey = ""
+	cfg.LevelKey = ""
+	cfg.MessageKey = ""
+
+	parent := NewECSEncoder(cfg)
+	parent.AddString("service", "api")
+	Field{Key: "error", Type: ErrorType, Interface: multierr.Append(errors.New("foo"), errors.New("bar"))}.AddTo(parent)
+
+	child := parent.Clone()
+	child.OpenNamespace("req")
+	child.AddInt("id", 7)
+	parent.AddString("other", "x")
+
+	buf, err := child.EncodeEntry(Entry{}, []Field{{Key: "k", Type: StringType, String: "v"}})
+	require.NoError(t, err, "Unexpected error encoding entry.")
+	defer buf.Free()
+	assert.Equal(t,
+		`{"ecs.version":"1.6.0","service":"api","req":{"id":7,"k":"v"},`+
+			`"error":{"message":"foo; bar","causes":[{"error":"foo"},{"error":"bar"}]}}`+"\n",
+		buf.String(),
+		"Expected errors added to the parent to be written in the ECS error object.",
+	)
+
+	buf2, err := parent.EncodeEntry(Entry{}, []Field{{Key: "error", Type: StringType, String: "replaced"}})
+	require.NoError(t, err, "Unexpected error encoding entry.")
+	defer buf2.Free()
+	assert.Equal(t,
+		`{"ecs.version":"1.6.0","service":"api","other":"x","error":{"message":"replaced"}}`+"\n",
+		buf2.String(),
+		"Expected the entry's error to replace the parent's.",
+	)
+}
+
+func BenchmarkECSEncodeEntry(b *testing.B) {
+	enc := NewECSEncoder(ecsEncoderConfig())
+	ent := Entry{
+		Level:      ErrorLevel,
+		Time:       time.Unix(1533567845, 0),
+		LoggerName: "main.db",
+		Message:    "query failed",
+		Caller:     EntryCaller{Defined: true, File: "/src/app/db.go", Line: 42},
+	}
+	fields := []Field{
+		{Key: "table", Type: StringType, String: "users"},
+		{Key: "error", Type: ErrorType, Interface: errors.New("timeout")},
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, _ := enc.EncodeEntry(ent, fields)
+		buf.Free()
+	}
+}
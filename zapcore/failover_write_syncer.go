@@ -0,0 +1,128 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+const _defaultProbeInterval = 30 * time.Second
+
+type failoverWriteSyncer struct {
+	sync.Mutex
+
+	ws            []WriteSyncer
+	errorOutput   WriteSyncer
+	probeInterval time.Duration
+	now           func() time.Time
+
+	active    int       // index of the destination in use
+	nextProbe time.Time // when to next try the destinations before active
+}
+
+// Failover creates a WriteSyncer that writes to the first of the given
+// destinations that works. When a write to the active destination fails, the
+// same bytes are written to each of the following destinations in turn, and
+// the first to succeed becomes the active destination. Writes only fail if
+// every remaining destination fails.
+//
+// While a fallback is active, the first write after every probeInterval is
+// attempted on the preferred destinations first, so that Failover switches
+// back once they recover. A non-positive interval defaults to 30 seconds.
+//
+// Each switch is reported to errorOutput, if it's not nil. Sync only syncs the
+// active destination. Without any destinations, Failover discards all writes.
+func Failover(errorOutput WriteSyncer, probeInterval time.Duration, ws ...WriteSyncer) WriteSyncer {
+	switch len(ws) {
+	case 0:
+		return NewMultiWriteSyncer()
+	case 1:
+		return ws[0]
+	}
+	if probeInterval <= 0 {
+		probeInterval = _defaultProbeInterval
+	}
+	return &failoverWriteSyncer{
+		// Copy to protect against https://github.com/golang/go/issues/7809
+		ws:            append([]WriteSyncer(nil), ws...),
+		errorOutput:   errorOutput,
+		probeInterval: probeInterval,
+		now:           time.Now,
+	}
+}
+
+func (s *failoverWriteSyncer) Write(bs []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	start := s.active
+	if s.active > 0 && !s.now().Before(s.nextProbe) {
+		start = 0
+		s.nextProbe = s.now().Add(s.probeInterval)
+	}
+
+	var errs, activeErr error
+	for i := start; i < len(s.ws); i++ {
+		n, err := s.ws[i].Write(bs)
+		if err == nil {
+			s.switchTo(i, activeErr)
+			return n, nil
+		}
+		if i == s.active {
+			activeErr = err
+		}
+		errs = multierr.Append(errs, err)
+	}
+	return 0, errs
+}
+
+func (s *failoverWriteSyncer) Sync() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.ws[s.active].Sync()
+}
+
+// switchTo makes the destination at index i active. The caller must hold the
+// lock.
+func (s *failoverWriteSyncer) switchTo(i int, cause error) {
+	if i == s.active {
+		return
+	}
+	if i > s.active {
+		s.report("switched from destination %d to %d: %v", s.active, i, cause)
+		s.nextProbe = s.now().Add(s.probeInterval)
+	} else {
+		s.report("switched back from destination %d to %d", s.active, i)
+	}
+	s.active = i
+}
+
+func (s *failoverWriteSyncer) report(format string, args ...interface{}) {
+	if s.errorOutput == nil {
+		return
+	}
+	fmt.Fprintf(s.errorOutput, "%v failover: %s\n", time.Now(), fmt.Sprintf(format, args...))
+	s.errorOutput.Sync()
+}
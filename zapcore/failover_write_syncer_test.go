@@ -0,0 +1,104 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailoverSingleDestination(t *testing.T) {
+	buf := &lockedBuffer{}
+	assert.Equal(t, buf, Failover(nil, 0, buf), "Expected a single destination to be returned as-is.")
+}
+
+func TestFailoverNoDestinations(t *testing.T) {
+	ws := Failover(nil, 0)
+	_, err := ws.Write([]byte("foo"))
+	assert.NoError(t, err, "Unexpected error writing without destinations.")
+	assert.NoError(t, ws.Sync(), "Unexpected error syncing without destinations.")
+}
+
+func TestFailover(t *testing.T) {
+	primary, secondary, tertiary := &lockedBuffer{}, &lockedBuffer{}, &lockedBuffer{}
+	errOut := &bytes.Buffer{}
+	ws := Failover(AddSync(errOut), time.Minute, primary, secondary, tertiary)
+	now := time.Unix(0, 0)
+	ws.(*failoverWriteSyncer).now = func() time.Time { return now }
+
+	_, err := ws.Write([]byte("a"))
+	require.NoError(t, err, "Unexpected error writing to a healthy primary.")
+
+	primary.SetError(errors.New("primary down"))
+	_, err = ws.Write([]byte("b"))
+	require.NoError(t, err, "Expected the write to fail over.")
+	assert.Contains(t, errOut.String(), "failover: switched from destination 0 to 1: primary down", "Expected the switch to be reported.")
+
+	// Until the probe interval elapses, the primary isn't retried.
+	_, err = ws.Write([]byte("c"))
+	require.NoError(t, err, "Unexpected error writing to the secondary.")
+	assert.Equal(t, 2, primary.Writes(), "Expected the primary to be skipped.")
+
+	// Probing a primary that's still down doesn't report anything.
+	now = now.Add(time.Minute)
+	errOut.Reset()
+	_, err = ws.Write([]byte("d"))
+	require.NoError(t, err, "Unexpected error writing to the secondary.")
+	assert.Equal(t, 3, primary.Writes(), "Expected the primary to be probed.")
+	assert.Empty(t, errOut.String(), "Expected a failed probe not to be reported.")
+
+	secondary.SetError(errors.New("secondary down"))
+	_, err = ws.Write([]byte("e"))
+	require.NoError(t, err, "Expected the write to fail over again.")
+	assert.Contains(t, errOut.String(), "switched from destination 1 to 2: secondary down", "Expected the second switch to be reported.")
+
+	primary.SetError(nil)
+	now = now.Add(time.Minute)
+	_, err = ws.Write([]byte("f"))
+	require.NoError(t, err, "Unexpected error writing to the recovered primary.")
+	assert.Contains(t, errOut.String(), "switched back from destination 2 to 0", "Expected failing back to be reported.")
+
+	assert.Equal(t, "af", primary.String(), "Unexpected writes to the primary.")
+	assert.Equal(t, "bcd", secondary.String(), "Unexpected writes to the secondary.")
+	assert.Equal(t, "e", tertiary.String(), "Unexpected writes to the tertiary.")
+
+	require.NoError(t, ws.Sync(), "Unexpected error syncing.")
+	assert.Equal(t, 1, primary.syncs, "Expected the active destination to be synced.")
+	assert.Equal(t, 0, secondary.syncs+tertiary.syncs, "Expected inactive destinations not to be synced.")
+}
+
+func TestFailoverAllDestinationsFail(t *testing.T) {
+	primary, secondary := &lockedBuffer{}, &lockedBuffer{}
+	primary.SetError(errors.New("primary down"))
+	secondary.SetError(errors.New("secondary down"))
+	ws := Failover(nil, 0, primary, secondary)
+
+	_, err := ws.Write([]byte("lost"))
+	require.Error(t, err, "Expected an error when every destination fails.")
+	assert.True(t, strings.Contains(err.Error(), "primary down") && strings.Contains(err.Error(), "secondary down"), "Expected both errors, got %v.", err)
+	assert.Equal(t, 0, ws.(*failoverWriteSyncer).active, "Expected the active destination not to change.")
+}
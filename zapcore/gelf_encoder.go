@@ -0,0 +1,466 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/internal/bufferpool"
+)
+
+// GELFVersion is the version of the Graylog Extended Log Format that the
+// GELF encoder writes.
+const GELFVersion = "1.1"
+
+var _gelfPool = sync.Pool{New: func() interface{} {
+	return &gelfEncoder{}
+}}
+
+func getGELFEncoder() *gelfEncoder {
+	return _gelfPool.Get().(*gelfEncoder)
+}
+
+func putGELFEncoder(enc *gelfEncoder) {
+	enc.EncoderConfig = nil
+	enc.buf = nil
+	enc.json.buf = nil
+	enc.host = ""
+	enc.path = enc.path[:0]
+	enc.key = ""
+	enc.index = -1
+	_gelfPool.Put(enc)
+}
+
+type gelfEncoder struct {
+	*EncoderConfig
+	buf  *buffer.Buffer // additional fields, each preceded by a comma
+	json jsonEncoder    // formats values into buf
+	host string
+
+	// The name of the next additional field is the path (from namespaces,
+	// nested objects, and arrays, like "a.b.") followed by either key or,
+	// inside an array, the index of the element.
+	path  []byte
+	key   string
+	index int // -1 outside arrays
+}
+
+// NewGELFEncoder creates an encoder that writes each entry as a GELF 1.1
+// message, the JSON format that Graylog ingests. For example:
+//   {"version":"1.1","host":"web-1","short_message":"hello",
+//    "timestamp":1533567845.123,"level":6,"_logger":"main","_user.id":42}
+//
+// The short_message is the entry's message, or "-" if it's empty, since
+// GELF requires one. Levels are mapped to syslog severities with
+// SyslogSeverity, and the host is the local hostname. If TimeKey is set,
+// the entry's time is written as the timestamp, in seconds since the epoch;
+// if StacktraceKey is set, the stacktrace is written as the full_message.
+// The logger name and caller, if NameKey and CallerKey are set, and the
+// entry's fields are additional fields, whose names are prefixed with an
+// underscore. MessageKey and LevelKey are ignored.
+//
+// Since GELF's additional fields must be strings or numbers, nested objects
+// and namespaces are flattened into dotted names like _parent.child, each
+// element of an array is written with its index, like _array.0, and
+// booleans and reflected values are written as strings. Characters that
+// GELF doesn't allow in field names are replaced with underscores, and a
+// field named "id", which GELF reserves, is written as "__id".
+//
+// Lines end with LineEnding, so setting it to "\x00" produces the
+// null-delimited messages expected by Graylog's GELF TCP input. The "gelf"
+// sink in the zap package sends messages over UDP.
+func NewGELFEncoder(cfg EncoderConfig) Encoder {
+	return newGELFEncoder(cfg)
+}
+
+func newGELFEncoder(cfg EncoderConfig) *gelfEncoder {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	enc := &gelfEncoder{
+		EncoderConfig: &cfg,
+		buf:           bufferpool.Get(),
+		host:          host,
+		index:         -1,
+	}
+	enc.json.buf = enc.buf
+	return enc
+}
+
+func (enc *gelfEncoder) AddArray(key string, arr ArrayMarshaler) error {
+	enc.key = key
+	return enc.AppendArray(arr)
+}
+
+func (enc *gelfEncoder) AddObject(key string, obj ObjectMarshaler) error {
+	enc.key = key
+	return enc.AppendObject(obj)
+}
+
+func (enc *gelfEncoder) AddBinary(key string, val []byte) {
+	enc.AddString(key, base64.StdEncoding.EncodeToString(val))
+}
+
+func (enc *gelfEncoder) AddByteString(key string, val []byte) {
+	enc.key = key
+	enc.AppendByteString(val)
+}
+
+func (enc *gelfEncoder) AddBool(key string, val bool) {
+	enc.key = key
+	enc.AppendBool(val)
+}
+
+func (enc *gelfEncoder) AddComplex128(key string, val complex128) {
+	enc.key = key
+	enc.AppendComplex128(val)
+}
+
+func (enc *gelfEncoder) AddDuration(key string, val time.Duration) {
+	enc.key = key
+	enc.AppendDuration(val)
+}
+
+func (enc *gelfEncoder) AddFloat64(key string, val float64) {
+	enc.key = key
+	enc.AppendFloat64(val)
+}
+
+func (enc *gelfEncoder) AddFloat32(key string, val float32) {
+	enc.key = key
+	enc.AppendFloat32(val)
+}
+
+func (enc *gelfEncoder) AddInt64(key string, val int64) {
+	enc.key = key
+	enc.AppendInt64(val)
+}
+
+func (enc *gelfEncoder) AddReflected(key string, obj interface{}) error {
+	enc.key = key
+	return enc.AppendReflected(obj)
+}
+
+func (enc *gelfEncoder) OpenNamespace(key string) {
+	enc.key = key
+	enc.pushKey()
+}
+
+func (enc *gelfEncoder) AddString(key, val string) {
+	enc.key = key
+	enc.AppendString(val)
+}
+
+func (enc *gelfEncoder) AddTime(key string, val time.Time) {
+	enc.key = key
+	enc.AppendTime(val)
+}
+
+func (enc *gelfEncoder) AddUint64(key string, val uint64) {
+	enc.key = key
+	enc.AppendUint64(val)
+}
+
+func (enc *gelfEncoder) AppendArray(arr ArrayMarshaler) error {
+	path, key, index := len(enc.path), enc.key, enc.index
+	enc.pushKey()
+	enc.index = 0
+	err := arr.MarshalLogArray(enc)
+	enc.path, enc.key = enc.path[:path], key
+	if enc.index = index; index >= 0 {
+		enc.index++
+	}
+	return err
+}
+
+func (enc *gelfEncoder) AppendObject(obj ObjectMarshaler) error {
+	path, key, index := len(enc.path), enc.key, enc.index
+	enc.pushKey()
+	enc.index = -1
+	err := obj.MarshalLogObject(enc)
+	enc.path, enc.key = enc.path[:path], key
+	if enc.index = index; index >= 0 {
+		enc.index++
+	}
+	return err
+}
+
+func (enc *gelfEncoder) AppendBool(val bool) {
+	enc.addKey()
+	if val {
+		enc.buf.AppendString(`"true"`)
+	} else {
+		enc.buf.AppendString(`"false"`)
+	}
+}
+
+func (enc *gelfEncoder) AppendByteString(val []byte) {
+	enc.addKey()
+	enc.json.AppendByteString(val)
+}
+
+func (enc *gelfEncoder) AppendComplex128(val complex128) {
+	enc.addKey()
+	enc.json.AppendComplex128(val)
+}
+
+func (enc *gelfEncoder) AppendDuration(val time.Duration) {
+	cur := enc.buf.Len()
+	if enc.EncodeDuration != nil {
+		enc.EncodeDuration(val, enc)
+	}
+	if cur == enc.buf.Len() {
+		// User-supplied EncodeDuration is missing or a no-op. Fall back to
+		// nanoseconds.
+		enc.AppendInt64(int64(val))
+	}
+}
+
+func (enc *gelfEncoder) AppendInt64(val int64) {
+	enc.addKey()
+	enc.json.AppendInt64(val)
+}
+
+func (enc *gelfEncoder) AppendReflected(val interface{}) error {
+	marshaled, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	enc.AppendByteString(marshaled)
+	return nil
+}
+
+func (enc *gelfEncoder) AppendString(val string) {
+	enc.addKey()
+	enc.json.AppendString(val)
+}
+
+func (enc *gelfEncoder) AppendTime(val time.Time) {
+	cur := enc.buf.Len()
+	if enc.EncodeTime != nil {
+		enc.EncodeTime(val, enc)
+	}
+	if cur == enc.buf.Len() {
+		// User-supplied EncodeTime is missing or a no-op. Fall back to nanos
+		// since epoch.
+		enc.AppendInt64(val.UnixNano())
+	}
+}
+
+func (enc *gelfEncoder) AppendUint64(val uint64) {
+	enc.addKey()
+	enc.json.AppendUint64(val)
+}
+
+func (enc *gelfEncoder) AppendFloat64(val float64) {
+	enc.addKey()
+	enc.json.AppendFloat64(val)
+}
+
+func (enc *gelfEncoder) AppendFloat32(val float32) {
+	enc.addKey()
+	enc.json.AppendFloat32(val)
+}
+
+func (enc *gelfEncoder) AddComplex64(k string, v complex64) { enc.AddComplex128(k, complex128(v)) }
+func (enc *gelfEncoder) AddInt(k string, v int)             { enc.AddInt64(k, int64(v)) }
+func (enc *gelfEncoder) AddInt32(k string, v int32)         { enc.AddInt64(k, int64(v)) }
+func (enc *gelfEncoder) AddInt16(k string, v int16)         { enc.AddInt64(k, int64(v)) }
+func (enc *gelfEncoder) AddInt8(k string, v int8)           { enc.AddInt64(k, int64(v)) }
+func (enc *gelfEncoder) AddUint(k string, v uint)           { enc.AddUint64(k, uint64(v)) }
+func (enc *gelfEncoder) AddUint32(k string, v uint32)       { enc.AddUint64(k, uint64(v)) }
+func (enc *gelfEncoder) AddUint16(k string, v uint16)       { enc.AddUint64(k, uint64(v)) }
+func (enc *gelfEncoder) AddUint8(k string, v uint8)         { enc.AddUint64(k, uint64(v)) }
+func (enc *gelfEncoder) AddUintptr(k string, v uintptr)     { enc.AddUint64(k, uint64(v)) }
+func (enc *gelfEncoder) AppendComplex64(v complex64)        { enc.AppendComplex128(complex128(v)) }
+func (enc *gelfEncoder) AppendInt(v int)                    { enc.AppendInt64(int64(v)) }
+func (enc *gelfEncoder) AppendInt32(v int32)                { enc.AppendInt64(int64(v)) }
+func (enc *gelfEncoder) AppendInt16(v int16)                { enc.AppendInt64(int64(v)) }
+func (enc *gelfEncoder) AppendInt8(v int8)                  { enc.AppendInt64(int64(v)) }
+func (enc *gelfEncoder) AppendUint(v uint)                  { enc.AppendUint64(uint64(v)) }
+func (enc *gelfEncoder) AppendUint32(v uint32)              { enc.AppendUint64(uint64(v)) }
+func (enc *gelfEncoder) AppendUint16(v uint16)              { enc.AppendUint64(uint64(v)) }
+func (enc *gelfEncoder) AppendUint8(v uint8)                { enc.AppendUint64(uint64(v)) }
+func (enc *gelfEncoder) AppendUintptr(v uintptr)            { enc.AppendUint64(uint64(v)) }
+
+func (enc *gelfEncoder) Clone() Encoder {
+	clone := enc.clone()
+	clone.buf.Write(enc.buf.Bytes())
+	return clone
+}
+
+func (enc *gelfEncoder) clone() *gelfEncoder {
+	clone := getGELFEncoder()
+	clone.EncoderConfig = enc.EncoderConfig
+	clone.buf = bufferpool.Get()
+	clone.json.buf = clone.buf
+	clone.host = enc.host
+	clone.path = append(clone.path[:0], enc.path...)
+	clone.index = -1
+	return clone
+}
+
+func (enc *gelfEncoder) EncodeEntry(ent Entry, fields []Field) (*buffer.Buffer, error) {
+	final := enc.clone()
+	final.buf.Write(enc.buf.Bytes())
+	addFields(final, fields)
+
+	// The logger name and caller go outside any open namespaces.
+	final.path = final.path[:0]
+	if ent.LoggerName != "" && final.NameKey != "" {
+		final.key = final.NameKey
+		cur := final.buf.Len()
+		nameEncoder := final.EncodeName
+
+		// if no name encoder provided, fall back to FullNameEncoder for
+		// backwards compatibility
+		if nameEncoder == nil {
+			nameEncoder = FullNameEncoder
+		}
+
+		nameEncoder(ent.LoggerName, final)
+		if cur == final.buf.Len() {
+			// User-supplied EncodeName was a no-op. Fall back to strings to
+			// keep output JSON valid.
+			final.AppendString(ent.LoggerName)
+		}
+	}
+	if ent.Caller.Defined && final.CallerKey != "" {
+		final.key = final.CallerKey
+		cur := final.buf.Len()
+		final.EncodeCaller(ent.Caller, final)
+		if cur == final.buf.Len() {
+			// User-supplied EncodeCaller was a no-op. Fall back to strings to
+			// keep output JSON valid.
+			final.AppendString(ent.Caller.String())
+		}
+	}
+
+	line := bufferpool.Get()
+	header := jsonEncoder{buf: line}
+	line.AppendString(`{"version":"` + GELFVersion + `","host":`)
+	header.AppendString(final.host)
+	line.AppendString(`,"short_message":`)
+	if ent.Message == "" {
+		header.AppendString("-")
+	} else {
+		header.AppendString(ent.Message)
+	}
+	if ent.Stack != "" && final.StacktraceKey != "" {
+		line.AppendString(`,"full_message":`)
+		header.AppendString(ent.Stack)
+	}
+	if final.TimeKey != "" {
+		line.AppendString(`,"timestamp":`)
+		appendGELFTimestamp(line, ent.Time)
+	}
+	line.AppendString(`,"level":`)
+	line.AppendInt(int64(SyslogSeverity(ent.Level)))
+	line.Write(final.buf.Bytes())
+	line.AppendByte('}')
+	if final.LineEnding != "" {
+		line.AppendString(final.LineEnding)
+	} else {
+		line.AppendString(DefaultLineEnding)
+	}
+
+	final.buf.Free()
+	putGELFEncoder(final)
+	return line, nil
+}
+
+// appendGELFTimestamp writes seconds since the epoch with millisecond
+// precision, as GELF recommends.
+func appendGELFTimestamp(buf *buffer.Buffer, t time.Time) {
+	ms := t.UnixNano() / int64(time.Millisecond)
+	sec, frac := ms/1000, ms%1000
+	if frac < 0 {
+		sec, frac = sec-1, frac+1000
+	}
+	buf.AppendInt(sec)
+	buf.AppendByte('.')
+	buf.AppendByte(byte('0' + frac/100))
+	buf.AppendByte(byte('0' + frac/10%10))
+	buf.AppendByte(byte('0' + frac%10))
+}
+
+// pushKey appends the name of the next value to the path, as the parent of
+// the values that follow.
+func (enc *gelfEncoder) pushKey() {
+	if enc.index >= 0 {
+		enc.path = appendLogfmtIndex(enc.path, enc.index)
+	} else {
+		enc.path = appendGELFFieldName(enc.path, enc.key)
+	}
+	enc.path = append(enc.path, '.')
+}
+
+// addKey writes the name of the next additional field.
+func (enc *gelfEncoder) addKey() {
+	enc.buf.AppendString(`,"_`)
+	start := enc.buf.Len()
+	enc.buf.Write(enc.path)
+	if enc.index >= 0 {
+		enc.buf.AppendInt(int64(enc.index))
+		enc.index++
+	} else {
+		for i := 0; i < len(enc.key); i++ {
+			enc.buf.AppendByte(gelfFieldNameByte(enc.key[i]))
+		}
+		if enc.key == "" {
+			enc.buf.AppendByte('_')
+		}
+	}
+	if name := enc.buf.Bytes()[start:]; string(name) == "id" {
+		// GELF reserves _id, so write __id instead.
+		name[0], name[1] = '_', 'i'
+		enc.buf.AppendByte('d')
+	}
+	enc.buf.AppendString(`":`)
+}
+
+func appendGELFFieldName(b []byte, name string) []byte {
+	if name == "" {
+		return append(b, '_')
+	}
+	for i := 0; i < len(name); i++ {
+		b = append(b, gelfFieldNameByte(name[i]))
+	}
+	return b
+}
+
+// gelfFieldNameByte replaces characters that GELF doesn't allow in field
+// names with underscores.
+func gelfFieldNameByte(c byte) byte {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return c
+	case c == '_', c == '.', c == '-':
+		return c
+	}
+	return '_'
+}
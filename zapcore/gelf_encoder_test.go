@@ -0,0 +1,227 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gelfEncoderConfig() EncoderConfig {
+	return EncoderConfig{
+		MessageKey:     "msg",
+		LevelKey:       "level",
+		TimeKey:        "ts",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		StacktraceKey:  "stacktrace",
+		EncodeTime:     ISO8601TimeEncoder,
+		EncodeDuration: StringDurationEncoder,
+		EncodeCaller:   ShortCallerEncoder,
+	}
+}
+
+func newTestGELFEncoder(cfg EncoderConfig) *gelfEncoder {
+	enc := newGELFEncoder(cfg)
+	enc.host = "web-1"
+	return enc
+}
+
+func TestGELFEncodeEntry(t *testing.T) {
+	ts := time.Unix(1533567845, 123456789)
+	caller := EntryCaller{Defined: true, File: "/src/app/main.go", Line: 42}
+
+	tests := []struct {
+		desc     string
+		cfg      func(*EncoderConfig)
+		ent      Entry
+		fields   []Field
+		expected string
+	}{
+		{
+			desc: "metadata and fields",
+			ent: Entry{
+				Level:      ErrorLevel,
+				Time:       ts,
+				LoggerName: "main.db",
+				Message:    "query failed",
+				Caller:     caller,
+				Stack:      "goroutine 1\nmain.main()",
+			},
+			fields: []Field{
+				{Key: "table", Type: StringType, String: "users"},
+				{Key: "rows", Type: Int64Type, Integer: 3},
+			},
+			expected: `{"version":"1.1","host":"web-1","short_message":"query failed",` +
+				`"full_message":"goroutine 1\nmain.main()","timestamp":1533567845.123,"level":3,` +
+				`"_table":"users","_rows":3,"_logger":"main.db","_caller":"app/main.go:42"}` + "\n",
+		},
+		{
+			desc: "omitted keys",
+			cfg: func(cfg *EncoderConfig) {
+				cfg.TimeKey = ""
+				cfg.NameKey = ""
+				cfg.CallerKey = ""
+				cfg.StacktraceKey = ""
+				cfg.MessageKey = ""
+				cfg.LevelKey = ""
+			},
+			ent:      Entry{Level: DebugLevel, Time: ts, LoggerName: "main", Message: "hi", Caller: caller, Stack: "s"},
+			expected: `{"version":"1.1","host":"web-1","short_message":"hi","level":7}` + "\n",
+		},
+		{
+			desc:     "empty message and custom line ending",
+			cfg:      func(cfg *EncoderConfig) { cfg.LineEnding = "\x00" },
+			ent:      Entry{Level: WarnLevel, Time: time.Unix(-1, 0)},
+			expected: `{"version":"1.1","host":"web-1","short_message":"-","timestamp":-1.000,"level":4}` + "\x00",
+		},
+		{
+			desc: "no-op encoders",
+			cfg: func(cfg *EncoderConfig) {
+				cfg.TimeKey = ""
+				cfg.EncodeName = func(string, PrimitiveArrayEncoder) {}
+				cfg.EncodeCaller = func(EntryCaller, PrimitiveArrayEncoder) {}
+			},
+			ent:      Entry{Level: InfoLevel, LoggerName: "svc", Message: "m", Caller: caller},
+			expected: `{"version":"1.1","host":"web-1","short_message":"m","level":6,"_logger":"svc","_caller":"/src/app/main.go:42"}` + "\n",
+		},
+		{
+			desc: "namespaces apply to fields, not metadata",
+			cfg:  func(cfg *EncoderConfig) { cfg.TimeKey = "" },
+			ent:  Entry{Level: InfoLevel, LoggerName: "svc", Message: "m"},
+			fields: []Field{
+				{Key: "outer", Type: NamespaceType},
+				{Key: "inner", Type: NamespaceType},
+				{Key: "k", Type: StringType, String: "v"},
+			},
+			expected: `{"version":"1.1","host":"web-1","short_message":"m","level":6,"_outer.inner.k":"v","_logger":"svc"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg := gelfEncoderConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			buf, err := newTestGELFEncoder(cfg).EncodeEntry(tt.ent, tt.fields)
+			require.NoError(t, err, "Unexpected GELF encoding error.")
+			assert.Equal(t, tt.expected, buf.String(), "Unexpected GELF message.")
+			buf.Free()
+		})
+	}
+}
+
+func TestGELFEncoderClone(t *testing.T) {
+	cfg := EncoderConfig{}
+	parent := newTestGELFEncoder(cfg)
+	parent.OpenNamespace("ns")
+	parent.AddString("parent", "yes")
+	clone := parent.Clone()
+	clone.AddString("child", "yes")
+
+	ent := Entry{Message: "m"}
+	buf, err := parent.EncodeEntry(ent, nil)
+	require.NoError(t, err, "Unexpected error encoding entry.")
+	assert.Equal(t, `{"version":"1.1","host":"web-1","short_message":"m","level":6,"_ns.parent":"yes"}`+"\n", buf.String(), "Expected the parent to be unaffected by its clone.")
+
+	buf, err = clone.EncodeEntry(ent, []Field{{Key: "entry", Type: StringType, String: "yes"}})
+	require.NoError(t, err, "Unexpected error encoding entry.")
+	assert.Equal(t, `{"version":"1.1","host":"web-1","short_message":"m","level":6,"_ns.parent":"yes","_ns.child":"yes","_ns.entry":"yes"}`+"\n", buf.String(), "Expected the clone to inherit context and namespaces.")
+}
+
+func TestGELFEncoderFields(t *testing.T) {
+	tests := []struct {
+		desc     string
+		expected string
+		f        func(Encoder)
+	}{
+		{"binary", `"_k":"Zm9v"`, func(e Encoder) { e.AddBinary("k", []byte("foo")) }},
+		{"byte string", `"_k":"a\"b"`, func(e Encoder) { e.AddByteString("k", []byte(`a"b`)) }},
+		{"bools", `"_t":"true","_f":"false"`, func(e Encoder) {
+			e.AddBool("t", true)
+			e.AddBool("f", false)
+		}},
+		{"complex", `"_k":"1+2i"`, func(e Encoder) { e.AddComplex64("k", 1+2i) }},
+		{"duration", `"_k":"1s"`, func(e Encoder) { e.AddDuration("k", time.Second) }},
+		{"floats", `"_k":1.5,"_n":"NaN","_f":0.25`, func(e Encoder) {
+			e.AddFloat64("k", 1.5)
+			e.AddFloat64("n", math.NaN())
+			e.AddFloat32("f", 0.25)
+		}},
+		{"ints and uints", `"_a":-1,"_b":2`, func(e Encoder) {
+			e.AddInt8("a", -1)
+			e.AddUintptr("b", 2)
+		}},
+		{"time", `"_k":"1970-01-01T00:00:00.000Z"`, func(e Encoder) { e.AddTime("k", time.Unix(0, 0).UTC()) }},
+		{"reflected", `"_k":"{\"a\":1}"`, func(e Encoder) { e.AddReflected("k", map[string]int{"a": 1}) }},
+		{"object", `"_k.loggable":"yes"`, func(e Encoder) { e.AddObject("k", loggable{true}) }},
+		{"nested arrays and objects", `"_k.0.0":"a","_k.0.1":"b","_k.1.loggable":"yes","_k.2":"c"`, func(e Encoder) {
+			e.AddArray("k", ArrayMarshalerFunc(func(arr ArrayEncoder) error {
+				arr.AppendArray(ArrayMarshalerFunc(func(inner ArrayEncoder) error {
+					inner.AppendString("a")
+					inner.AppendString("b")
+					return nil
+				}))
+				arr.AppendObject(loggable{true})
+				arr.AppendString("c")
+				return nil
+			}))
+		}},
+		{"field names", `"_a_b":1,"__":2,"__id":3,"_ns.id":4,"_x-y.z_":5`, func(e Encoder) {
+			e.AddInt("a b", 1)
+			e.AddInt("", 2)
+			e.AddInt("id", 3)
+			e.AddObject("ns", ObjectMarshalerFunc(func(enc ObjectEncoder) error {
+				enc.AddInt("id", 4)
+				return nil
+			}))
+			e.AddInt("x-y.z!", 5)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg := gelfEncoderConfig()
+			cfg.TimeKey = ""
+			enc := newTestGELFEncoder(cfg)
+			tt.f(enc)
+			buf, err := enc.EncodeEntry(Entry{Message: "m"}, nil)
+			require.NoError(t, err, "Unexpected error encoding entry.")
+			assert.Equal(t, `{"version":"1.1","host":"web-1","short_message":"m","level":6,`+tt.expected+"}\n", buf.String(), "Unexpected fields.")
+
+			var parsed map[string]interface{}
+			assert.NoError(t, json.Unmarshal(buf.Bytes(), &parsed), "Expected valid JSON.")
+		})
+	}
+}
+
+func TestGELFEncoderErrors(t *testing.T) {
+	enc := NewGELFEncoder(gelfEncoderConfig())
+	assert.Error(t, enc.AddObject("k", loggable{false}), "Expected object marshaling errors to propagate.")
+	assert.Error(t, enc.AddArray("k", loggable{false}), "Expected array marshaling errors to propagate.")
+	assert.Error(t, enc.AddReflected("k", func() {}), "Expected reflection errors to propagate.")
+}
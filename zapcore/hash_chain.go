@@ -0,0 +1,220 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+)
+
+const (
+	_chainJSONKey   = `"chain":"`
+	_chainTextKey   = " chain="
+	_chainHexLength = 2 * sha256.Size
+)
+
+type hashChainWriteSyncer struct {
+	sync.Mutex
+
+	ws   WriteSyncer
+	hash hash.Hash
+	prev []byte
+	next []byte // chain value of the pending write
+	buf  []byte
+}
+
+// HashChain wraps a WriteSyncer to make its output tamper-evident. Each line
+// written is suffixed with a chain value: the SHA-256 hash of the previous
+// line's chain value and the line itself, or an HMAC-SHA256 keyed with key,
+// if it's not empty. Editing, inserting, reordering, or removing a line then
+// breaks the chain from that line on, which VerifyHashChain detects. Without
+// a key, anyone who can edit the log can also recompute the chain, so the
+// HMAC form is the one to use as evidence.
+//
+// The chain value is written as a final "chain" field in lines that hold a
+// JSON object, and as " chain=<hex>" after any other line. Every line written
+// ends in a newline.
+//
+// A new chain starts from a zero value. To continue an existing log, pass
+// the chain value of its last line (as returned by VerifyHashChain) as prev.
+//
+// Buffering wrappers, like the one returned by Buffer, should wrap the
+// WriteSyncer returned by HashChain, not the other way around.
+func HashChain(ws WriteSyncer, key, prev []byte) WriteSyncer {
+	s := &hashChainWriteSyncer{
+		ws:   ws,
+		hash: newChainHash(key),
+		prev: make([]byte, sha256.Size),
+	}
+	copy(s.prev, prev)
+	return s
+}
+
+func newChainHash(key []byte) hash.Hash {
+	if len(key) == 0 {
+		return sha256.New()
+	}
+	return hmac.New(sha256.New, key)
+}
+
+func (s *hashChainWriteSyncer) Write(bs []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// Only advance the chain once the lines are written, so that a failed
+	// write doesn't leave a gap in it.
+	s.next = append(s.next[:0], s.prev...)
+	s.buf = s.buf[:0]
+	for rest := bs; len(rest) > 0; {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line, rest = rest[:i], rest[i+1:]
+		} else {
+			rest = nil
+		}
+		s.next = chainValue(s.hash, s.next, line)
+		s.buf = appendChainValue(s.buf, line, s.next)
+	}
+	if _, err := s.ws.Write(s.buf); err != nil {
+		return 0, err
+	}
+	s.prev, s.next = s.next, s.prev
+	return len(bs), nil
+}
+
+func (s *hashChainWriteSyncer) Sync() error {
+	return s.ws.Sync()
+}
+
+func chainValue(h hash.Hash, prev, line []byte) []byte {
+	h.Reset()
+	h.Write(prev)
+	h.Write(line)
+	return h.Sum(prev[:0])
+}
+
+func appendChainValue(dst, line, chain []byte) []byte {
+	var encoded [_chainHexLength]byte
+	hex.Encode(encoded[:], chain)
+
+	if !isJSONObject(line) {
+		dst = append(dst, line...)
+		dst = append(dst, _chainTextKey...)
+		dst = append(dst, encoded[:]...)
+		return append(dst, '\n')
+	}
+	dst = append(dst, line[:len(line)-1]...)
+	if len(line) > 2 {
+		dst = append(dst, ',')
+	}
+	dst = append(dst, _chainJSONKey...)
+	dst = append(dst, encoded[:]...)
+	return append(dst, '"', '}', '\n')
+}
+
+func isJSONObject(line []byte) bool {
+	return len(line) >= 2 && line[0] == '{' && line[len(line)-1] == '}'
+}
+
+// splitChainValue separates a line written by HashChain into the original
+// line and its chain value.
+func splitChainValue(line []byte) (orig, chain []byte, ok bool) {
+	if isJSONObject(line) {
+		start := len(line) - len(`"}`) - _chainHexLength - len(_chainJSONKey)
+		if start < 1 || !bytes.HasSuffix(line, []byte(`"}`)) || !bytes.Equal(line[start:start+len(_chainJSONKey)], []byte(_chainJSONKey)) {
+			return nil, nil, false
+		}
+		chain = line[start+len(_chainJSONKey) : len(line)-len(`"}`)]
+		switch line[start-1] {
+		case '{':
+			orig = []byte("{}")
+		case ',':
+			orig = append(line[:start-1:start-1], '}')
+		default:
+			return nil, nil, false
+		}
+	} else {
+		start := len(line) - _chainHexLength - len(_chainTextKey)
+		if start < 0 || !bytes.Equal(line[start:start+len(_chainTextKey)], []byte(_chainTextKey)) {
+			return nil, nil, false
+		}
+		orig, chain = line[:start], line[start+len(_chainTextKey):]
+	}
+
+	decoded := make([]byte, sha256.Size)
+	if _, err := hex.Decode(decoded, chain); err != nil {
+		return nil, nil, false
+	}
+	return orig, decoded, true
+}
+
+// A HashChainError reports the first line of a log that doesn't continue its
+// hash chain.
+type HashChainError struct {
+	Line   int // 1-based
+	Reason string
+}
+
+func (e *HashChainError) Error() string {
+	return fmt.Sprintf("hash chain broken at line %d: %s", e.Line, e.Reason)
+}
+
+// VerifyHashChain reads a log written through HashChain with the same key and
+// checks that every line continues the chain that starts at prev (nil for a
+// new log). If a line doesn't, it returns a *HashChainError describing the
+// first broken link; other errors come from reading r.
+//
+// On success, it returns the chain value of the last line. Since removing
+// lines from the end of a log leaves a valid, shorter chain, callers that
+// need to detect truncation should compare this value against one recorded
+// elsewhere.
+func VerifyHashChain(r io.Reader, key, prev []byte) ([]byte, error) {
+	h := newChainHash(key)
+	chain := make([]byte, sha256.Size)
+	copy(chain, prev)
+
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) == 0 && err == io.EOF {
+			return chain, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		orig, got, ok := splitChainValue(bytes.TrimSuffix(line, []byte{'\n'}))
+		if !ok {
+			return nil, &HashChainError{Line: n, Reason: "missing chain value"}
+		}
+		chain = chainValue(h, chain, orig)
+		if !hmac.Equal(chain, got) {
+			return nil, &HashChainError{Line: n, Reason: "chain value doesn't match"}
+		}
+	}
+}
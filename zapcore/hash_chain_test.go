@@ -0,0 +1,155 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/internal/ztest"
+)
+
+func writeChained(t testing.TB, key, prev []byte, lines ...string) (string, []byte) {
+	buf := &bytes.Buffer{}
+	ws := HashChain(AddSync(buf), key, prev)
+	for _, l := range lines {
+		n, err := ws.Write([]byte(l))
+		require.NoError(t, err, "Unexpected error writing.")
+		require.Equal(t, len(l), n, "Unexpected number of bytes written.")
+	}
+	last, err := VerifyHashChain(strings.NewReader(buf.String()), key, prev)
+	require.NoError(t, err, "Expected a freshly-written chain to verify.")
+	return buf.String(), last
+}
+
+func TestHashChainFormat(t *testing.T) {
+	out, _ := writeChained(t, nil, nil, `{"msg":"foo"}`+"\n", "{}\n", "plain\ntwo lines")
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	require.Equal(t, 4, len(lines), "Expected every line to be chained.")
+
+	assert.Regexp(t, `^\{"msg":"foo","chain":"[0-9a-f]{64}"\}$`, lines[0], "Unexpected JSON line.")
+	assert.Regexp(t, `^\{"chain":"[0-9a-f]{64}"\}$`, lines[1], "Unexpected empty JSON line.")
+	assert.Regexp(t, `^plain chain=[0-9a-f]{64}$`, lines[2], "Unexpected text line.")
+	assert.Regexp(t, `^two lines chain=[0-9a-f]{64}$`, lines[3], "Unexpected unterminated line.")
+	for _, l := range lines[:2] {
+		assert.True(t, json.Valid([]byte(l)), "Expected JSON lines to stay valid JSON: %s", l)
+	}
+}
+
+func TestHashChainContinues(t *testing.T) {
+	key := []byte("secret")
+	first, last := writeChained(t, key, nil, "one\n", "two\n")
+	second, _ := writeChained(t, key, last, "three\n")
+
+	_, err := VerifyHashChain(strings.NewReader(first+second), key, nil)
+	assert.NoError(t, err, "Expected a continued chain to verify.")
+	_, err = VerifyHashChain(strings.NewReader(second), key, nil)
+	assert.Equal(t, &HashChainError{Line: 1, Reason: "chain value doesn't match"}, err, "Expected the continued chain to depend on prev.")
+}
+
+func TestHashChainDetectsTampering(t *testing.T) {
+	key := []byte("secret")
+	out, _ := writeChained(t, key, nil, `{"msg":"one"}`+"\n", `{"msg":"two"}`+"\n", "three\n", "four\n")
+	lines := strings.SplitAfter(out, "\n")
+
+	tests := []struct {
+		desc string
+		log  string
+		key  []byte
+		want *HashChainError
+	}{
+		{
+			desc: "edited line",
+			log:  lines[0] + strings.Replace(lines[1], "two", "TWO", 1) + lines[2] + lines[3],
+			key:  key,
+			want: &HashChainError{Line: 2, Reason: "chain value doesn't match"},
+		},
+		{
+			desc: "removed line",
+			log:  lines[0] + lines[1] + lines[3],
+			key:  key,
+			want: &HashChainError{Line: 3, Reason: "chain value doesn't match"},
+		},
+		{
+			desc: "reordered lines",
+			log:  lines[1] + lines[0] + lines[2] + lines[3],
+			key:  key,
+			want: &HashChainError{Line: 1, Reason: "chain value doesn't match"},
+		},
+		{
+			desc: "inserted line",
+			log:  lines[0] + lines[1] + "forged\n" + lines[2] + lines[3],
+			key:  key,
+			want: &HashChainError{Line: 3, Reason: "missing chain value"},
+		},
+		{
+			desc: "wrong key",
+			log:  out,
+			key:  []byte("guess"),
+			want: &HashChainError{Line: 1, Reason: "chain value doesn't match"},
+		},
+		{
+			desc: "no key",
+			log:  out,
+			want: &HashChainError{Line: 1, Reason: "chain value doesn't match"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := VerifyHashChain(strings.NewReader(tt.log), tt.key, nil)
+			assert.Equal(t, tt.want, err, "Unexpected verification result.")
+		})
+	}
+}
+
+func TestHashChainWriteErrors(t *testing.T) {
+	ws := HashChain(AddSync(&ztest.FailWriter{}), nil, nil)
+	_, err := ws.Write([]byte("foo\n"))
+	assert.Error(t, err, "Expected write errors to propagate.")
+
+	sink := &ztest.Buffer{}
+	sink.SetError(errors.New("fail"))
+	assert.Error(t, HashChain(sink, nil, nil).Sync(), "Expected sync errors to propagate.")
+}
+
+func TestHashChainSkipsFailedWrites(t *testing.T) {
+	buf := &lockedBuffer{}
+	ws := HashChain(buf, nil, nil)
+
+	_, err := ws.Write([]byte("one\n"))
+	require.NoError(t, err, "Unexpected error writing.")
+	buf.SetError(errors.New("fail"))
+	_, err = ws.Write([]byte("two\n"))
+	require.Error(t, err, "Expected write errors to propagate.")
+	buf.SetError(nil)
+	_, err = ws.Write([]byte("three\n"))
+	require.NoError(t, err, "Unexpected error writing.")
+
+	_, err = VerifyHashChain(strings.NewReader(buf.String()), nil, nil)
+	assert.NoError(t, err, "Expected a failed write to leave the chain intact.")
+}
@@ -20,7 +20,11 @@
 
 package zapcore
 
-import "go.uber.org/multierr"
+import (
+	"context"
+
+	"go.uber.org/multierr"
+)
 
 type hooked struct {
 	Core
@@ -57,6 +61,10 @@ func (h *hooked) With(fields []Field) Core {
 	}
 }
 
+func (h *hooked) SyncContext(ctx context.Context) error {
+	return syncContext(ctx, h.Core)
+}
+
 func (h *hooked) Write(ent Entry, _ []Field) error {
 	// Since our downstream had a chance to register itself directly with the
 	// CheckedMessage, we don't need to call it here.
@@ -0,0 +1,446 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/internal/bufferpool"
+)
+
+const _maxJournaldFieldName = 64
+
+var _journaldPool = sync.Pool{New: func() interface{} {
+	return &journaldEncoder{}
+}}
+
+func getJournaldEncoder() *journaldEncoder {
+	return _journaldPool.Get().(*journaldEncoder)
+}
+
+func putJournaldEncoder(enc *journaldEncoder) {
+	enc.EncoderConfig = nil
+	enc.buf = nil
+	enc.val = nil
+	enc.prefix = ""
+	enc.key = ""
+	_journaldPool.Put(enc)
+}
+
+type journaldEncoder struct {
+	*EncoderConfig
+	buf *buffer.Buffer // serialized journal fields
+	val *buffer.Buffer // the value of the field being written
+
+	prefix string // from namespaces and nested objects, like "a_b_"
+	key    string // the key for Append* calls
+}
+
+// NewJournaldEncoder creates an encoder that serializes each entry using the
+// systemd journal's native protocol. It's meant to be paired with a sink that
+// sends each encoded entry to journald as a single datagram (see the
+// "journald" sink in the zap package).
+//
+// Every entry has a MESSAGE field and a PRIORITY field, which holds the
+// syslog severity of the entry's level (see SyslogSeverity). If CallerKey
+// isn't empty, the caller is written to the CODE_FILE, CODE_LINE, and
+// CODE_FUNC fields. Since journald timestamps entries itself, the entry's
+// time isn't written.
+//
+// Other field names are upper-cased, characters other than letters, digits,
+// and underscores are replaced with underscores, and leading underscores
+// (reserved for trusted fields) are dropped. Fields whose names would clash
+// with MESSAGE, PRIORITY, or the CODE_ fields are prefixed with FIELD_, as in
+// FIELD_MESSAGE. Nested objects and namespaces are flattened into names like
+// PARENT_CHILD, and each element of an array is written as a separate field
+// with the array's name.
+func NewJournaldEncoder(cfg EncoderConfig) Encoder {
+	return &journaldEncoder{
+		EncoderConfig: &cfg,
+		buf:           bufferpool.Get(),
+		val:           bufferpool.Get(),
+	}
+}
+
+func (enc *journaldEncoder) AddArray(key string, arr ArrayMarshaler) error {
+	enc.key = key
+	return arr.MarshalLogArray(enc)
+}
+
+func (enc *journaldEncoder) AddObject(key string, obj ObjectMarshaler) error {
+	enc.key = key
+	return enc.AppendObject(obj)
+}
+
+func (enc *journaldEncoder) AddBinary(key string, val []byte) {
+	enc.AddString(key, base64.StdEncoding.EncodeToString(val))
+}
+
+func (enc *journaldEncoder) AddByteString(key string, val []byte) {
+	enc.key = key
+	enc.AppendByteString(val)
+}
+
+func (enc *journaldEncoder) AddBool(key string, val bool) {
+	enc.key = key
+	enc.AppendBool(val)
+}
+
+func (enc *journaldEncoder) AddComplex128(key string, val complex128) {
+	enc.key = key
+	enc.AppendComplex128(val)
+}
+
+func (enc *journaldEncoder) AddDuration(key string, val time.Duration) {
+	enc.key = key
+	enc.AppendDuration(val)
+}
+
+func (enc *journaldEncoder) AddFloat64(key string, val float64) {
+	enc.key = key
+	enc.AppendFloat64(val)
+}
+
+func (enc *journaldEncoder) AddInt64(key string, val int64) {
+	enc.key = key
+	enc.AppendInt64(val)
+}
+
+func (enc *journaldEncoder) AddReflected(key string, obj interface{}) error {
+	enc.key = key
+	return enc.AppendReflected(obj)
+}
+
+func (enc *journaldEncoder) OpenNamespace(key string) {
+	enc.prefix += key + "_"
+}
+
+func (enc *journaldEncoder) AddString(key, val string) {
+	enc.key = key
+	enc.AppendString(val)
+}
+
+func (enc *journaldEncoder) AddTime(key string, val time.Time) {
+	enc.key = key
+	enc.AppendTime(val)
+}
+
+func (enc *journaldEncoder) AddUint64(key string, val uint64) {
+	enc.key = key
+	enc.AppendUint64(val)
+}
+
+func (enc *journaldEncoder) AppendArray(arr ArrayMarshaler) error {
+	// Nested arrays are flattened into repeated fields.
+	return arr.MarshalLogArray(enc)
+}
+
+func (enc *journaldEncoder) AppendObject(obj ObjectMarshaler) error {
+	prefix, key := enc.prefix, enc.key
+	enc.prefix = prefix + key + "_"
+	err := obj.MarshalLogObject(enc)
+	enc.prefix, enc.key = prefix, key
+	return err
+}
+
+func (enc *journaldEncoder) AppendBool(val bool) {
+	enc.val.Reset()
+	enc.val.AppendBool(val)
+	enc.endField()
+}
+
+func (enc *journaldEncoder) AppendByteString(val []byte) {
+	enc.val.Reset()
+	enc.val.Write(val)
+	enc.endField()
+}
+
+func (enc *journaldEncoder) AppendComplex128(val complex128) {
+	// Cast to a platform-independent, fixed-size type.
+	r, i := float64(real(val)), float64(imag(val))
+	enc.val.Reset()
+	enc.val.AppendFloat(r, 64)
+	enc.val.AppendByte('+')
+	enc.val.AppendFloat(i, 64)
+	enc.val.AppendByte('i')
+	enc.endField()
+}
+
+func (enc *journaldEncoder) AppendDuration(val time.Duration) {
+	cur := enc.buf.Len()
+	if enc.EncodeDuration != nil {
+		enc.EncodeDuration(val, enc)
+	}
+	if cur == enc.buf.Len() {
+		// User-supplied EncodeDuration is missing or a no-op. Fall back to
+		// nanoseconds.
+		enc.AppendInt64(int64(val))
+	}
+}
+
+func (enc *journaldEncoder) AppendInt64(val int64) {
+	enc.val.Reset()
+	enc.val.AppendInt(val)
+	enc.endField()
+}
+
+func (enc *journaldEncoder) AppendReflected(val interface{}) error {
+	marshaled, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	enc.AppendByteString(marshaled)
+	return nil
+}
+
+func (enc *journaldEncoder) AppendString(val string) {
+	enc.val.Reset()
+	enc.val.AppendString(val)
+	enc.endField()
+}
+
+func (enc *journaldEncoder) AppendTime(val time.Time) {
+	cur := enc.buf.Len()
+	if enc.EncodeTime != nil {
+		enc.EncodeTime(val, enc)
+	}
+	if cur == enc.buf.Len() {
+		// User-supplied EncodeTime is missing or a no-op. Fall back to nanos
+		// since epoch.
+		enc.AppendInt64(val.UnixNano())
+	}
+}
+
+func (enc *journaldEncoder) AppendUint64(val uint64) {
+	enc.val.Reset()
+	enc.val.AppendUint(val)
+	enc.endField()
+}
+
+func (enc *journaldEncoder) appendFloat(val float64, bitSize int) {
+	enc.val.Reset()
+	switch {
+	case math.IsNaN(val):
+		enc.val.AppendString("NaN")
+	case math.IsInf(val, 1):
+		enc.val.AppendString("+Inf")
+	case math.IsInf(val, -1):
+		enc.val.AppendString("-Inf")
+	default:
+		enc.val.AppendFloat(val, bitSize)
+	}
+	enc.endField()
+}
+
+func (enc *journaldEncoder) AddComplex64(k string, v complex64) { enc.AddComplex128(k, complex128(v)) }
+func (enc *journaldEncoder) AddFloat32(k string, v float32)     { enc.AddFloat64(k, float64(v)) }
+func (enc *journaldEncoder) AddInt(k string, v int)             { enc.AddInt64(k, int64(v)) }
+func (enc *journaldEncoder) AddInt32(k string, v int32)         { enc.AddInt64(k, int64(v)) }
+func (enc *journaldEncoder) AddInt16(k string, v int16)         { enc.AddInt64(k, int64(v)) }
+func (enc *journaldEncoder) AddInt8(k string, v int8)           { enc.AddInt64(k, int64(v)) }
+func (enc *journaldEncoder) AddUint(k string, v uint)           { enc.AddUint64(k, uint64(v)) }
+func (enc *journaldEncoder) AddUint32(k string, v uint32)       { enc.AddUint64(k, uint64(v)) }
+func (enc *journaldEncoder) AddUint16(k string, v uint16)       { enc.AddUint64(k, uint64(v)) }
+func (enc *journaldEncoder) AddUint8(k string, v uint8)         { enc.AddUint64(k, uint64(v)) }
+func (enc *journaldEncoder) AddUintptr(k string, v uintptr)     { enc.AddUint64(k, uint64(v)) }
+func (enc *journaldEncoder) AppendComplex64(v complex64)        { enc.AppendComplex128(complex128(v)) }
+func (enc *journaldEncoder) AppendFloat64(v float64)            { enc.appendFloat(v, 64) }
+func (enc *journaldEncoder) AppendFloat32(v float32)            { enc.appendFloat(float64(v), 32) }
+func (enc *journaldEncoder) AppendInt(v int)                    { enc.AppendInt64(int64(v)) }
+func (enc *journaldEncoder) AppendInt32(v int32)                { enc.AppendInt64(int64(v)) }
+func (enc *journaldEncoder) AppendInt16(v int16)                { enc.AppendInt64(int64(v)) }
+func (enc *journaldEncoder) AppendInt8(v int8)                  { enc.AppendInt64(int64(v)) }
+func (enc *journaldEncoder) AppendUint(v uint)                  { enc.AppendUint64(uint64(v)) }
+func (enc *journaldEncoder) AppendUint32(v uint32)              { enc.AppendUint64(uint64(v)) }
+func (enc *journaldEncoder) AppendUint16(v uint16)              { enc.AppendUint64(uint64(v)) }
+func (enc *journaldEncoder) AppendUint8(v uint8)                { enc.AppendUint64(uint64(v)) }
+func (enc *journaldEncoder) AppendUintptr(v uintptr)            { enc.AppendUint64(uint64(v)) }
+
+func (enc *journaldEncoder) Clone() Encoder {
+	clone := enc.clone()
+	clone.buf.Write(enc.buf.Bytes())
+	return clone
+}
+
+func (enc *journaldEncoder) clone() *journaldEncoder {
+	clone := getJournaldEncoder()
+	clone.EncoderConfig = enc.EncoderConfig
+	clone.prefix = enc.prefix
+	clone.buf = bufferpool.Get()
+	clone.val = bufferpool.Get()
+	return clone
+}
+
+func (enc *journaldEncoder) EncodeEntry(ent Entry, fields []Field) (*buffer.Buffer, error) {
+	final := enc.clone()
+	final.buf.Write(enc.buf.Bytes())
+	addFields(final, fields)
+
+	// Entry metadata goes outside any open namespaces.
+	final.prefix = ""
+	if ent.LoggerName != "" && final.NameKey != "" {
+		final.key = final.NameKey
+		cur := final.buf.Len()
+		nameEncoder := final.EncodeName
+		if nameEncoder == nil {
+			nameEncoder = FullNameEncoder
+		}
+		nameEncoder(ent.LoggerName, final)
+		if cur == final.buf.Len() {
+			final.AppendString(ent.LoggerName)
+		}
+	}
+	if ent.Stack != "" && final.StacktraceKey != "" {
+		final.AddString(final.StacktraceKey, ent.Stack)
+	}
+
+	line := bufferpool.Get()
+	appendJournaldField(line, "MESSAGE", ent.Message)
+	line.AppendString("PRIORITY=")
+	line.AppendInt(int64(SyslogSeverity(ent.Level)))
+	line.AppendByte('\n')
+	if ent.Caller.Defined && final.CallerKey != "" {
+		appendJournaldField(line, "CODE_FILE", ent.Caller.File)
+		line.AppendString("CODE_LINE=")
+		line.AppendInt(int64(ent.Caller.Line))
+		line.AppendByte('\n')
+		if fn := runtime.FuncForPC(ent.Caller.PC); fn != nil {
+			appendJournaldField(line, "CODE_FUNC", fn.Name())
+		}
+	}
+	line.Write(final.buf.Bytes())
+
+	final.buf.Free()
+	final.val.Free()
+	putJournaldEncoder(final)
+	return line, nil
+}
+
+// endField writes the current key and value to the internal buffer.
+func (enc *journaldEncoder) endField() {
+	start := enc.buf.Len()
+	enc.addFieldName(enc.prefix)
+	enc.addFieldName(enc.key)
+	switch n := enc.buf.Len() - start; {
+	case n == 0:
+		enc.buf.AppendString("FIELD")
+	case n > _maxJournaldFieldName:
+		// Trim in place; all the bytes we wrote are ASCII.
+		b := enc.buf.Bytes()[:start+_maxJournaldFieldName]
+		enc.buf.Reset()
+		enc.buf.Write(b)
+	}
+	if name := enc.buf.Bytes()[start:]; isReservedJournaldField(name) {
+		// Keep user fields from clashing with the fields the encoder writes
+		// for the entry itself.
+		reserved := string(name)
+		b := enc.buf.Bytes()[:start]
+		enc.buf.Reset()
+		enc.buf.Write(b)
+		enc.buf.AppendString("FIELD_")
+		enc.buf.AppendString(reserved)
+	}
+	appendJournaldValue(enc.buf, enc.val.Bytes())
+}
+
+// isReservedJournaldField reports whether name is one of the fields the
+// encoder writes for every entry.
+func isReservedJournaldField(name []byte) bool {
+	switch string(name) {
+	case "MESSAGE", "PRIORITY", "CODE_FILE", "CODE_LINE", "CODE_FUNC":
+		return true
+	}
+	return false
+}
+
+// addFieldName appends s to the current field name, upper-casing letters and
+// replacing other characters that journald doesn't allow with underscores.
+// Journald reserves names that start with an underscore, and doesn't allow
+// names that start with a digit.
+func (enc *journaldEncoder) addFieldName(s string) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z':
+			c -= 'a' - 'A'
+		case 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9':
+			if isJournaldFieldStart(enc.buf.Bytes()) {
+				enc.buf.AppendString("FIELD_")
+			}
+		default:
+			c = '_'
+		}
+		if c == '_' && isJournaldFieldStart(enc.buf.Bytes()) {
+			continue
+		}
+		enc.buf.AppendByte(c)
+	}
+}
+
+// isJournaldFieldStart reports whether the next byte appended to b starts a
+// new field name.
+func isJournaldFieldStart(b []byte) bool {
+	return len(b) == 0 || b[len(b)-1] == '\n'
+}
+
+func appendJournaldField(buf *buffer.Buffer, name, val string) {
+	buf.AppendString(name)
+	if strings.IndexByte(val, '\n') < 0 {
+		buf.AppendByte('=')
+		buf.AppendString(val)
+		buf.AppendByte('\n')
+		return
+	}
+	appendJournaldBinary(buf, uint64(len(val)))
+	buf.AppendString(val)
+	buf.AppendByte('\n')
+}
+
+func appendJournaldValue(buf *buffer.Buffer, val []byte) {
+	if bytes.IndexByte(val, '\n') < 0 {
+		buf.AppendByte('=')
+		buf.Write(val)
+		buf.AppendByte('\n')
+		return
+	}
+	appendJournaldBinary(buf, uint64(len(val)))
+	buf.Write(val)
+	buf.AppendByte('\n')
+}
+
+// appendJournaldBinary starts a value that may contain newlines: the name is
+// followed by a newline and the value's length as a little-endian uint64.
+func appendJournaldBinary(buf *buffer.Buffer, n uint64) {
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], n)
+	buf.AppendByte('\n')
+	buf.Write(size[:])
+}
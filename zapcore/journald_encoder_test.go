@@ -0,0 +1,201 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"math"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func journaldEncoderConfig() EncoderConfig {
+	return EncoderConfig{
+		MessageKey:     "msg",
+		LevelKey:       "level",
+		TimeKey:        "ts",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		StacktraceKey:  "stacktrace",
+		EncodeTime:     ISO8601TimeEncoder,
+		EncodeDuration: StringDurationEncoder,
+	}
+}
+
+func TestJournaldEncodeEntry(t *testing.T) {
+	pc, file, line, _ := runtime.Caller(0)
+	caller := NewEntryCaller(pc, file, line, true)
+	ts := time.Date(2018, 8, 6, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		desc     string
+		cfg      func(*EncoderConfig)
+		ent      Entry
+		fields   []Field
+		expected string
+	}{
+		{
+			desc:     "message only",
+			ent:      Entry{Level: InfoLevel, Time: ts, Message: "hello"},
+			expected: "MESSAGE=hello\nPRIORITY=6\n",
+		},
+		{
+			desc: "metadata and fields",
+			ent: Entry{
+				Level:      ErrorLevel,
+				Time:       ts,
+				LoggerName: "main.db",
+				Message:    "query failed",
+				Caller:     caller,
+				Stack:      "goroutine 1",
+			},
+			fields: []Field{
+				{Key: "table", Type: StringType, String: "users"},
+				{Key: "rows", Type: Int64Type, Integer: 3},
+			},
+			expected: "MESSAGE=query failed\nPRIORITY=3\n" +
+				"CODE_FILE=" + file + "\n" +
+				"CODE_LINE=" + strconv.Itoa(line) + "\n" +
+				"CODE_FUNC=go.uber.org/zap/zapcore.TestJournaldEncodeEntry\n" +
+				"TABLE=users\nROWS=3\nLOGGER=main.db\nSTACKTRACE=goroutine 1\n",
+		},
+		{
+			desc:     "caller without a caller key",
+			cfg:      func(cfg *EncoderConfig) { cfg.CallerKey = "" },
+			ent:      Entry{Level: WarnLevel, Message: "hi", Caller: caller},
+			expected: "MESSAGE=hi\nPRIORITY=4\n",
+		},
+		{
+			desc:     "multi-line message",
+			ent:      Entry{Level: DebugLevel, Message: "a\nb"},
+			expected: "MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\nPRIORITY=7\n",
+		},
+		{
+			desc: "namespaces apply to fields, not metadata",
+			ent:  Entry{Level: InfoLevel, LoggerName: "svc"},
+			fields: []Field{
+				{Key: "outer", Type: NamespaceType},
+				{Key: "inner", Type: NamespaceType},
+				{Key: "k", Type: StringType, String: "v"},
+			},
+			expected: "MESSAGE=\nPRIORITY=6\nOUTER_INNER_K=v\nLOGGER=svc\n",
+		},
+		{
+			desc: "reserved field names",
+			ent:  Entry{Level: InfoLevel, Message: "hi"},
+			fields: []Field{
+				{Key: "message", Type: StringType, String: "m"},
+				{Key: "priority", Type: Int64Type, Integer: 1},
+				{Key: "code.file", Type: StringType, String: "f"},
+				{Key: "messages", Type: StringType, String: "ok"},
+			},
+			expected: "MESSAGE=hi\nPRIORITY=6\nFIELD_MESSAGE=m\nFIELD_PRIORITY=1\nFIELD_CODE_FILE=f\nMESSAGES=ok\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg := journaldEncoderConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			buf, err := NewJournaldEncoder(cfg).EncodeEntry(tt.ent, tt.fields)
+			if assert.NoError(t, err, "Unexpected journald encoding error.") {
+				assert.Equal(t, tt.expected, buf.String(), "Unexpected journal entry.")
+			}
+			buf.Free()
+		})
+	}
+}
+
+func TestJournaldEncoderClone(t *testing.T) {
+	parent := NewJournaldEncoder(journaldEncoderConfig())
+	parent.OpenNamespace("ns")
+	parent.AddString("parent", "yes")
+	clone := parent.Clone()
+	clone.AddString("child", "yes")
+
+	ent := Entry{Level: InfoLevel, Message: "m"}
+	buf, err := parent.EncodeEntry(ent, nil)
+	assert.NoError(t, err, "Unexpected error encoding entry.")
+	assert.Equal(t, "MESSAGE=m\nPRIORITY=6\nNS_PARENT=yes\n", buf.String(), "Expected the parent to be unaffected by its clone.")
+
+	buf, err = clone.EncodeEntry(ent, []Field{{Key: "entry", Type: StringType, String: "yes"}})
+	assert.NoError(t, err, "Unexpected error encoding entry.")
+	assert.Equal(t, "MESSAGE=m\nPRIORITY=6\nNS_PARENT=yes\nNS_CHILD=yes\nNS_ENTRY=yes\n", buf.String(), "Expected the clone to inherit context and namespaces.")
+}
+
+func TestJournaldEncoderFields(t *testing.T) {
+	tests := []struct {
+		desc     string
+		expected string
+		f        func(Encoder)
+	}{
+		{"binary", "K=Zm9v\n", func(e Encoder) { e.AddBinary("k", []byte("foo")) }},
+		{"byte string", "K=a=b\n", func(e Encoder) { e.AddByteString("k", []byte("a=b")) }},
+		{"multi-line string", "K\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n", func(e Encoder) { e.AddString("k", "a\nb") }},
+		{"complex", "K=1+2i\n", func(e Encoder) { e.AddComplex64("k", 1+2i) }},
+		{"duration", "K=1s\n", func(e Encoder) { e.AddDuration("k", time.Second) }},
+		{"float", "K=1.5\nN=NaN\n", func(e Encoder) {
+			e.AddFloat64("k", 1.5)
+			e.AddFloat32("n", float32(math.NaN()))
+		}},
+		{"ints and uints", "A=-1\nB=2\n", func(e Encoder) {
+			e.AddInt8("a", -1)
+			e.AddUintptr("b", 2)
+		}},
+		{"time", "K=1970-01-01T00:00:00.000Z\n", func(e Encoder) { e.AddTime("k", time.Unix(0, 0).UTC()) }},
+		{"reflected", "K={\"a\":1}\n", func(e Encoder) { e.AddReflected("k", map[string]int{"a": 1}) }},
+		{"object", "K_LOGGABLE=yes\n", func(e Encoder) { e.AddObject("k", loggable{true}) }},
+		{"array", "K=true\nK=false\n", func(e Encoder) {
+			e.AddArray("k", ArrayMarshalerFunc(func(arr ArrayEncoder) error {
+				arr.AppendBool(true)
+				arr.AppendBool(false)
+				return nil
+			}))
+		}},
+		{"field names", "HTTP_STATUS=1\nTRUSTED=2\nFIELD_3XX=3\nFIELD=4\n", func(e Encoder) {
+			e.AddInt("http.status", 1)
+			e.AddInt("__trusted", 2)
+			e.AddInt("3xx", 3)
+			e.AddInt("", 4)
+		}},
+		{"long field names", "ABCDEFGHIJABCDEFGHIJABCDEFGHIJABCDEFGHIJABCDEFGHIJABCDEFGHIJABCD=v\n", func(e Encoder) {
+			e.AddString("abcdefghijabcdefghijabcdefghijabcdefghijabcdefghijabcdefghijabcdefghij", "v")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg := journaldEncoderConfig()
+			cfg.CallerKey = ""
+			enc := NewJournaldEncoder(cfg)
+			tt.f(enc)
+			buf, err := enc.EncodeEntry(Entry{}, nil)
+			if assert.NoError(t, err, "Unexpected error encoding entry.") {
+				assert.Equal(t, "MESSAGE=\nPRIORITY=6\n"+tt.expected, buf.String(), "Unexpected fields.")
+			}
+		})
+	}
+}
@@ -0,0 +1,556 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/internal/bufferpool"
+)
+
+var _logfmtPool = sync.Pool{New: func() interface{} {
+	return &logfmtEncoder{}
+}}
+
+func getLogfmtEncoder() *logfmtEncoder {
+	return _logfmtPool.Get().(*logfmtEncoder)
+}
+
+func putLogfmtEncoder(enc *logfmtEncoder) {
+	enc.EncoderConfig = nil
+	enc.buf = nil
+	enc.path = enc.path[:0]
+	enc.key = ""
+	enc.index = -1
+	_logfmtPool.Put(enc)
+}
+
+type logfmtEncoder struct {
+	*EncoderConfig
+	buf *buffer.Buffer
+
+	// The key of the next value is the path (from namespaces, nested objects,
+	// and arrays, like "a.b.") followed by either key or, inside an array, the
+	// index of the element.
+	path  []byte
+	key   string
+	index int // -1 outside arrays
+}
+
+// NewLogfmtEncoder creates an encoder whose output is a single line of
+// logfmt-style key=value pairs, as understood by Heroku's log tooling and
+// Grafana Loki. For example:
+//   level=info ts=1.5e+09 msg="hello world" user.id=42 tags.0=a tags.1=b
+//
+// Values that are empty or contain spaces, equals signs, quotes, backslashes,
+// or control characters are quoted, with quotes, backslashes, and control
+// characters escaped as in JSON. Invalid UTF-8 is replaced with U+FFFD. In
+// keys, which can't be quoted, such characters are replaced with
+// underscores.
+//
+// Nested objects and namespaces are flattened into dotted keys like
+// parent.child, and each element of an array is written with its index, like
+// array.0 and array.1. Entry metadata is written first, using the keys and
+// primitive encoders in the EncoderConfig, in the same order as the JSON
+// encoder.
+func NewLogfmtEncoder(cfg EncoderConfig) Encoder {
+	return newLogfmtEncoder(cfg)
+}
+
+func newLogfmtEncoder(cfg EncoderConfig) *logfmtEncoder {
+	return &logfmtEncoder{
+		EncoderConfig: &cfg,
+		buf:           bufferpool.Get(),
+		index:         -1,
+	}
+}
+
+func (enc *logfmtEncoder) AddArray(key string, arr ArrayMarshaler) error {
+	enc.key = key
+	return enc.AppendArray(arr)
+}
+
+func (enc *logfmtEncoder) AddObject(key string, obj ObjectMarshaler) error {
+	enc.key = key
+	return enc.AppendObject(obj)
+}
+
+func (enc *logfmtEncoder) AddBinary(key string, val []byte) {
+	enc.AddString(key, base64.StdEncoding.EncodeToString(val))
+}
+
+func (enc *logfmtEncoder) AddByteString(key string, val []byte) {
+	enc.key = key
+	enc.AppendByteString(val)
+}
+
+func (enc *logfmtEncoder) AddBool(key string, val bool) {
+	enc.key = key
+	enc.AppendBool(val)
+}
+
+func (enc *logfmtEncoder) AddComplex128(key string, val complex128) {
+	enc.key = key
+	enc.AppendComplex128(val)
+}
+
+func (enc *logfmtEncoder) AddDuration(key string, val time.Duration) {
+	enc.key = key
+	enc.AppendDuration(val)
+}
+
+func (enc *logfmtEncoder) AddFloat64(key string, val float64) {
+	enc.key = key
+	enc.AppendFloat64(val)
+}
+
+func (enc *logfmtEncoder) AddInt64(key string, val int64) {
+	enc.key = key
+	enc.AppendInt64(val)
+}
+
+func (enc *logfmtEncoder) AddReflected(key string, obj interface{}) error {
+	enc.key = key
+	return enc.AppendReflected(obj)
+}
+
+func (enc *logfmtEncoder) OpenNamespace(key string) {
+	enc.key = key
+	enc.pushKey()
+}
+
+func (enc *logfmtEncoder) AddString(key, val string) {
+	enc.key = key
+	enc.AppendString(val)
+}
+
+func (enc *logfmtEncoder) AddTime(key string, val time.Time) {
+	enc.key = key
+	enc.AppendTime(val)
+}
+
+func (enc *logfmtEncoder) AddUint64(key string, val uint64) {
+	enc.key = key
+	enc.AppendUint64(val)
+}
+
+func (enc *logfmtEncoder) AppendArray(arr ArrayMarshaler) error {
+	path, key, index := len(enc.path), enc.key, enc.index
+	enc.pushKey()
+	enc.index = 0
+	err := arr.MarshalLogArray(enc)
+	enc.path, enc.key = enc.path[:path], key
+	if enc.index = index; index >= 0 {
+		enc.index++
+	}
+	return err
+}
+
+func (enc *logfmtEncoder) AppendObject(obj ObjectMarshaler) error {
+	path, key, index := len(enc.path), enc.key, enc.index
+	enc.pushKey()
+	enc.index = -1
+	err := obj.MarshalLogObject(enc)
+	enc.path, enc.key = enc.path[:path], key
+	if enc.index = index; index >= 0 {
+		enc.index++
+	}
+	return err
+}
+
+func (enc *logfmtEncoder) AppendBool(val bool) {
+	enc.addKey()
+	enc.buf.AppendBool(val)
+}
+
+func (enc *logfmtEncoder) AppendByteString(val []byte) {
+	enc.addKey()
+	if !needsLogfmtQuotes(val) {
+		enc.buf.Write(val)
+		return
+	}
+	enc.buf.AppendByte('"')
+	for i := 0; i < len(val); {
+		if enc.tryAddRuneSelf(val[i]) {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(val[i:])
+		if enc.tryAddRuneError(r, size) {
+			i++
+			continue
+		}
+		enc.buf.Write(val[i : i+size])
+		i += size
+	}
+	enc.buf.AppendByte('"')
+}
+
+func (enc *logfmtEncoder) AppendComplex128(val complex128) {
+	// Cast to a platform-independent, fixed-size type.
+	r, i := float64(real(val)), float64(imag(val))
+	enc.addKey()
+	enc.buf.AppendFloat(r, 64)
+	enc.buf.AppendByte('+')
+	enc.buf.AppendFloat(i, 64)
+	enc.buf.AppendByte('i')
+}
+
+func (enc *logfmtEncoder) AppendDuration(val time.Duration) {
+	cur := enc.buf.Len()
+	if enc.EncodeDuration != nil {
+		enc.EncodeDuration(val, enc)
+	}
+	if cur == enc.buf.Len() {
+		// User-supplied EncodeDuration is missing or a no-op. Fall back to
+		// nanoseconds.
+		enc.AppendInt64(int64(val))
+	}
+}
+
+func (enc *logfmtEncoder) AppendInt64(val int64) {
+	enc.addKey()
+	enc.buf.AppendInt(val)
+}
+
+func (enc *logfmtEncoder) AppendReflected(val interface{}) error {
+	marshaled, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	enc.AppendByteString(marshaled)
+	return nil
+}
+
+func (enc *logfmtEncoder) AppendString(val string) {
+	enc.addKey()
+	if !needsLogfmtQuotesString(val) {
+		enc.buf.AppendString(val)
+		return
+	}
+	enc.buf.AppendByte('"')
+	for i := 0; i < len(val); {
+		if enc.tryAddRuneSelf(val[i]) {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(val[i:])
+		if enc.tryAddRuneError(r, size) {
+			i++
+			continue
+		}
+		enc.buf.AppendString(val[i : i+size])
+		i += size
+	}
+	enc.buf.AppendByte('"')
+}
+
+func (enc *logfmtEncoder) AppendTime(val time.Time) {
+	cur := enc.buf.Len()
+	if enc.EncodeTime != nil {
+		enc.EncodeTime(val, enc)
+	}
+	if cur == enc.buf.Len() {
+		// User-supplied EncodeTime is missing or a no-op. Fall back to nanos
+		// since epoch.
+		enc.AppendInt64(val.UnixNano())
+	}
+}
+
+func (enc *logfmtEncoder) AppendUint64(val uint64) {
+	enc.addKey()
+	enc.buf.AppendUint(val)
+}
+
+func (enc *logfmtEncoder) appendFloat(val float64, bitSize int) {
+	enc.addKey()
+	switch {
+	case math.IsNaN(val):
+		enc.buf.AppendString("NaN")
+	case math.IsInf(val, 1):
+		enc.buf.AppendString("+Inf")
+	case math.IsInf(val, -1):
+		enc.buf.AppendString("-Inf")
+	default:
+		enc.buf.AppendFloat(val, bitSize)
+	}
+}
+
+func (enc *logfmtEncoder) AddComplex64(k string, v complex64) { enc.AddComplex128(k, complex128(v)) }
+func (enc *logfmtEncoder) AddFloat32(k string, v float32)     { enc.AddFloat64(k, float64(v)) }
+func (enc *logfmtEncoder) AddInt(k string, v int)             { enc.AddInt64(k, int64(v)) }
+func (enc *logfmtEncoder) AddInt32(k string, v int32)         { enc.AddInt64(k, int64(v)) }
+func (enc *logfmtEncoder) AddInt16(k string, v int16)         { enc.AddInt64(k, int64(v)) }
+func (enc *logfmtEncoder) AddInt8(k string, v int8)           { enc.AddInt64(k, int64(v)) }
+func (enc *logfmtEncoder) AddUint(k string, v uint)           { enc.AddUint64(k, uint64(v)) }
+func (enc *logfmtEncoder) AddUint32(k string, v uint32)       { enc.AddUint64(k, uint64(v)) }
+func (enc *logfmtEncoder) AddUint16(k string, v uint16)       { enc.AddUint64(k, uint64(v)) }
+func (enc *logfmtEncoder) AddUint8(k string, v uint8)         { enc.AddUint64(k, uint64(v)) }
+func (enc *logfmtEncoder) AddUintptr(k string, v uintptr)     { enc.AddUint64(k, uint64(v)) }
+func (enc *logfmtEncoder) AppendComplex64(v complex64)        { enc.AppendComplex128(complex128(v)) }
+func (enc *logfmtEncoder) AppendFloat64(v float64)            { enc.appendFloat(v, 64) }
+func (enc *logfmtEncoder) AppendFloat32(v float32)            { enc.appendFloat(float64(v), 32) }
+func (enc *logfmtEncoder) AppendInt(v int)                    { enc.AppendInt64(int64(v)) }
+func (enc *logfmtEncoder) AppendInt32(v int32)                { enc.AppendInt64(int64(v)) }
+func (enc *logfmtEncoder) AppendInt16(v int16)                { enc.AppendInt64(int64(v)) }
+func (enc *logfmtEncoder) AppendInt8(v int8)                  { enc.AppendInt64(int64(v)) }
+func (enc *logfmtEncoder) AppendUint(v uint)                  { enc.AppendUint64(uint64(v)) }
+func (enc *logfmtEncoder) AppendUint32(v uint32)              { enc.AppendUint64(uint64(v)) }
+func (enc *logfmtEncoder) AppendUint16(v uint16)              { enc.AppendUint64(uint64(v)) }
+func (enc *logfmtEncoder) AppendUint8(v uint8)                { enc.AppendUint64(uint64(v)) }
+func (enc *logfmtEncoder) AppendUintptr(v uintptr)            { enc.AppendUint64(uint64(v)) }
+
+func (enc *logfmtEncoder) Clone() Encoder {
+	clone := enc.clone()
+	clone.buf.Write(enc.buf.Bytes())
+	return clone
+}
+
+func (enc *logfmtEncoder) clone() *logfmtEncoder {
+	clone := getLogfmtEncoder()
+	clone.EncoderConfig = enc.EncoderConfig
+	clone.buf = bufferpool.Get()
+	clone.path = append(clone.path[:0], enc.path...)
+	clone.index = -1
+	return clone
+}
+
+func (enc *logfmtEncoder) EncodeEntry(ent Entry, fields []Field) (*buffer.Buffer, error) {
+	// Entry metadata goes outside any open namespaces, so it's written by a
+	// separate encoder without a path.
+	final := getLogfmtEncoder()
+	final.EncoderConfig = enc.EncoderConfig
+	final.buf = bufferpool.Get()
+	final.index = -1
+
+	if final.LevelKey != "" {
+		final.key = final.LevelKey
+		cur := final.buf.Len()
+		final.EncodeLevel(ent.Level, final)
+		if cur == final.buf.Len() {
+			// User-supplied EncodeLevel was a no-op. Fall back to strings to
+			// keep the output parseable.
+			final.AppendString(ent.Level.String())
+		}
+	}
+	if final.TimeKey != "" {
+		final.AddTime(final.TimeKey, ent.Time)
+	}
+	if ent.LoggerName != "" && final.NameKey != "" {
+		final.key = final.NameKey
+		cur := final.buf.Len()
+		nameEncoder := final.EncodeName
+
+		// if no name encoder provided, fall back to FullNameEncoder for
+		// backwards compatibility
+		if nameEncoder == nil {
+			nameEncoder = FullNameEncoder
+		}
+
+		nameEncoder(ent.LoggerName, final)
+		if cur == final.buf.Len() {
+			// User-supplied EncodeName was a no-op. Fall back to strings to
+			// keep the output parseable.
+			final.AppendString(ent.LoggerName)
+		}
+	}
+	if ent.Caller.Defined && final.CallerKey != "" {
+		final.key = final.CallerKey
+		cur := final.buf.Len()
+		final.EncodeCaller(ent.Caller, final)
+		if cur == final.buf.Len() {
+			// User-supplied EncodeCaller was a no-op. Fall back to strings to
+			// keep the output parseable.
+			final.AppendString(ent.Caller.String())
+		}
+	}
+	if final.MessageKey != "" {
+		final.AddString(final.MessageKey, ent.Message)
+	}
+
+	// Fields go inside the open namespaces.
+	if enc.buf.Len() > 0 {
+		if final.buf.Len() > 0 {
+			final.buf.AppendByte(' ')
+		}
+		final.buf.Write(enc.buf.Bytes())
+	}
+	final.path = append(final.path, enc.path...)
+	addFields(final, fields)
+	final.path = final.path[:0]
+
+	if ent.Stack != "" && final.StacktraceKey != "" {
+		final.AddString(final.StacktraceKey, ent.Stack)
+	}
+	if final.LineEnding != "" {
+		final.buf.AppendString(final.LineEnding)
+	} else {
+		final.buf.AppendString(DefaultLineEnding)
+	}
+
+	ret := final.buf
+	putLogfmtEncoder(final)
+	return ret, nil
+}
+
+// pushKey appends the key of the next value to the path, as the parent of
+// the values that follow.
+func (enc *logfmtEncoder) pushKey() {
+	if enc.index >= 0 {
+		enc.path = appendLogfmtIndex(enc.path, enc.index)
+	} else {
+		enc.path = appendLogfmtKey(enc.path, enc.key)
+	}
+	enc.path = append(enc.path, '.')
+}
+
+// addKey writes the key of the next value and the equals sign that follows
+// it.
+func (enc *logfmtEncoder) addKey() {
+	if enc.buf.Len() > 0 {
+		enc.buf.AppendByte(' ')
+	}
+	enc.buf.Write(enc.path)
+	if enc.index >= 0 {
+		enc.buf.AppendInt(int64(enc.index))
+		enc.index++
+	} else {
+		enc.addKeyName(enc.key)
+	}
+	enc.buf.AppendByte('=')
+}
+
+func (enc *logfmtEncoder) addKeyName(key string) {
+	if key == "" {
+		// Keys can't be empty.
+		enc.buf.AppendByte('_')
+		return
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !isLogfmtKeyByte(c) {
+			c = '_'
+		}
+		enc.buf.AppendByte(c)
+	}
+}
+
+func appendLogfmtKey(b []byte, key string) []byte {
+	if key == "" {
+		return append(b, '_')
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !isLogfmtKeyByte(c) {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+func appendLogfmtIndex(b []byte, i int) []byte {
+	if i >= 10 {
+		b = appendLogfmtIndex(b, i/10)
+	}
+	return append(b, byte('0'+i%10))
+}
+
+func isLogfmtKeyByte(c byte) bool {
+	return c > ' ' && c != '=' && c != '"' && c != 0x7f
+}
+
+// needsLogfmtQuotes reports whether a value must be quoted.
+func needsLogfmtQuotes(val []byte) bool {
+	if len(val) == 0 || !utf8.Valid(val) {
+		return true
+	}
+	for _, c := range val {
+		if needsLogfmtQuotesByte(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// needsLogfmtQuotesString is a no-alloc equivalent of
+// needsLogfmtQuotes([]byte(val)).
+func needsLogfmtQuotesString(val string) bool {
+	if len(val) == 0 || !utf8.ValidString(val) {
+		return true
+	}
+	for i := 0; i < len(val); i++ {
+		if needsLogfmtQuotesByte(val[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func needsLogfmtQuotesByte(c byte) bool {
+	return c <= ' ' || c == '=' || c == '"' || c == '\\' || c == 0x7f
+}
+
+// tryAddRuneSelf appends b if it's a valid UTF-8 character represented in a
+// single byte, escaping it if necessary.
+func (enc *logfmtEncoder) tryAddRuneSelf(b byte) bool {
+	if b >= utf8.RuneSelf {
+		return false
+	}
+	if 0x20 <= b && b != '\\' && b != '"' {
+		enc.buf.AppendByte(b)
+		return true
+	}
+	switch b {
+	case '\\', '"':
+		enc.buf.AppendByte('\\')
+		enc.buf.AppendByte(b)
+	case '\n':
+		enc.buf.AppendByte('\\')
+		enc.buf.AppendByte('n')
+	case '\r':
+		enc.buf.AppendByte('\\')
+		enc.buf.AppendByte('r')
+	case '\t':
+		enc.buf.AppendByte('\\')
+		enc.buf.AppendByte('t')
+	default:
+		// Encode bytes < 0x20, except for the escape sequences above.
+		enc.buf.AppendString(`\u00`)
+		enc.buf.AppendByte(_hex[b>>4])
+		enc.buf.AppendByte(_hex[b&0xF])
+	}
+	return true
+}
+
+func (enc *logfmtEncoder) tryAddRuneError(r rune, size int) bool {
+	if r == utf8.RuneError && size == 1 {
+		enc.buf.AppendString(`\ufffd`)
+		return true
+	}
+	return false
+}
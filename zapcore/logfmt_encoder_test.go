@@ -0,0 +1,279 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func logfmtEncoderConfig() EncoderConfig {
+	return EncoderConfig{
+		MessageKey:     "msg",
+		LevelKey:       "level",
+		TimeKey:        "ts",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		StacktraceKey:  "stacktrace",
+		EncodeLevel:    LowercaseLevelEncoder,
+		EncodeTime:     ISO8601TimeEncoder,
+		EncodeDuration: StringDurationEncoder,
+		EncodeCaller:   ShortCallerEncoder,
+	}
+}
+
+func TestLogfmtEncodeEntry(t *testing.T) {
+	_, file, line, _ := runtime.Caller(0)
+	caller := NewEntryCaller(0, file, line, true)
+	ts := time.Date(2018, 8, 6, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		desc     string
+		cfg      func(*EncoderConfig)
+		ent      Entry
+		fields   []Field
+		expected string
+	}{
+		{
+			desc:     "message only",
+			ent:      Entry{Level: InfoLevel, Time: ts, Message: "hello"},
+			expected: "level=info ts=2018-08-06T15:04:05.000Z msg=hello\n",
+		},
+		{
+			desc: "metadata and fields",
+			ent: Entry{
+				Level:      ErrorLevel,
+				Time:       ts,
+				LoggerName: "main.db",
+				Message:    "query failed",
+				Caller:     caller,
+				Stack:      "goroutine 1\nmain.main()",
+			},
+			fields: []Field{
+				{Key: "table", Type: StringType, String: "users"},
+				{Key: "rows", Type: Int64Type, Integer: 3},
+			},
+			expected: "level=error ts=2018-08-06T15:04:05.000Z logger=main.db " +
+				"caller=zapcore/logfmt_encoder_test.go:" + strconv.Itoa(line) + ` msg="query failed" ` +
+				`table=users rows=3 stacktrace="goroutine 1\nmain.main()"` + "\n",
+		},
+		{
+			desc: "omitted keys",
+			cfg: func(cfg *EncoderConfig) {
+				cfg.LevelKey = ""
+				cfg.TimeKey = ""
+				cfg.CallerKey = ""
+				cfg.MessageKey = ""
+			},
+			ent:      Entry{Level: WarnLevel, Message: "hi", Caller: caller},
+			fields:   []Field{{Key: "k", Type: StringType, String: "v"}},
+			expected: "k=v\n",
+		},
+		{
+			desc: "custom encoders and line ending",
+			cfg: func(cfg *EncoderConfig) {
+				cfg.EncodeLevel = CapitalLevelEncoder
+				cfg.EncodeTime = EpochMillisTimeEncoder
+				cfg.EncodeName = func(n string, enc PrimitiveArrayEncoder) { enc.AppendString("<" + n + ">") }
+				cfg.LineEnding = "\r\n"
+			},
+			ent:      Entry{Level: DebugLevel, Time: time.Unix(1, 0), LoggerName: "svc", Message: "m"},
+			expected: "level=DEBUG ts=1000 logger=<svc> msg=m\r\n",
+		},
+		{
+			desc: "no-op encoders",
+			cfg: func(cfg *EncoderConfig) {
+				cfg.EncodeLevel = func(Level, PrimitiveArrayEncoder) {}
+				cfg.EncodeTime = func(time.Time, PrimitiveArrayEncoder) {}
+				cfg.EncodeName = func(string, PrimitiveArrayEncoder) {}
+				cfg.EncodeCaller = func(EntryCaller, PrimitiveArrayEncoder) {}
+			},
+			ent:      Entry{Level: InfoLevel, Time: time.Unix(0, 5), LoggerName: "svc", Caller: EntryCaller{Defined: true, File: "a.go", Line: 1}},
+			expected: "level=info ts=5 logger=svc caller=a.go:1 msg=\"\"\n",
+		},
+		{
+			desc: "namespaces apply to fields, not metadata",
+			ent:  Entry{Level: InfoLevel, Time: ts, Message: "m", Stack: "s"},
+			fields: []Field{
+				{Key: "outer", Type: NamespaceType},
+				{Key: "inner", Type: NamespaceType},
+				{Key: "k", Type: StringType, String: "v"},
+			},
+			expected: "level=info ts=2018-08-06T15:04:05.000Z msg=m outer.inner.k=v stacktrace=s\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg := logfmtEncoderConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			buf, err := NewLogfmtEncoder(cfg).EncodeEntry(tt.ent, tt.fields)
+			if assert.NoError(t, err, "Unexpected logfmt encoding error.") {
+				assert.Equal(t, tt.expected, buf.String(), "Unexpected logfmt line.")
+			}
+			buf.Free()
+		})
+	}
+}
+
+func TestLogfmtEncoderClone(t *testing.T) {
+	parent := NewLogfmtEncoder(EncoderConfig{MessageKey: "msg"})
+	parent.OpenNamespace("ns")
+	parent.AddString("parent", "yes")
+	clone := parent.Clone()
+	clone.AddString("child", "yes")
+
+	ent := Entry{Message: "m"}
+	buf, err := parent.EncodeEntry(ent, nil)
+	assert.NoError(t, err, "Unexpected error encoding entry.")
+	assert.Equal(t, "msg=m ns.parent=yes\n", buf.String(), "Expected the parent to be unaffected by its clone.")
+
+	buf, err = clone.EncodeEntry(ent, []Field{{Key: "entry", Type: StringType, String: "yes"}})
+	assert.NoError(t, err, "Unexpected error encoding entry.")
+	assert.Equal(t, "msg=m ns.parent=yes ns.child=yes ns.entry=yes\n", buf.String(), "Expected the clone to inherit context and namespaces.")
+}
+
+func TestLogfmtEncoderFields(t *testing.T) {
+	tests := []struct {
+		desc     string
+		expected string
+		f        func(Encoder)
+	}{
+		{"binary", "k=Zm9v", func(e Encoder) { e.AddBinary("k", []byte("foo")) }},
+		{"byte string", `k="a=b" n=plain`, func(e Encoder) {
+			e.AddByteString("k", []byte("a=b"))
+			e.AddByteString("n", []byte("plain"))
+		}},
+		{"bool", "k=true", func(e Encoder) { e.AddBool("k", true) }},
+		{"complex", "k=1+2i", func(e Encoder) { e.AddComplex64("k", 1+2i) }},
+		{"duration", "k=1s", func(e Encoder) { e.AddDuration("k", time.Second) }},
+		{"floats", "k=1.5 n=NaN p=+Inf m=-Inf", func(e Encoder) {
+			e.AddFloat64("k", 1.5)
+			e.AddFloat32("n", float32(math.NaN()))
+			e.AddFloat64("p", math.Inf(1))
+			e.AddFloat64("m", math.Inf(-1))
+		}},
+		{"ints and uints", "a=-1 b=2 c=3", func(e Encoder) {
+			e.AddInt8("a", -1)
+			e.AddUintptr("b", 2)
+			e.AddUint64("c", 3)
+		}},
+		{"time", "k=1970-01-01T00:00:00.000Z", func(e Encoder) { e.AddTime("k", time.Unix(0, 0).UTC()) }},
+		{"reflected", `k="{\"a\":1}"`, func(e Encoder) { e.AddReflected("k", map[string]int{"a": 1}) }},
+		{"object", "k.loggable=yes", func(e Encoder) { e.AddObject("k", loggable{true}) }},
+		{"array", "k.0=true k.1=false", func(e Encoder) {
+			e.AddArray("k", ArrayMarshalerFunc(func(arr ArrayEncoder) error {
+				arr.AppendBool(true)
+				arr.AppendBool(false)
+				return nil
+			}))
+		}},
+		{"nested arrays and objects", "k.0.0=a k.0.1=b k.1.loggable=yes k.2=c", func(e Encoder) {
+			e.AddArray("k", ArrayMarshalerFunc(func(arr ArrayEncoder) error {
+				arr.AppendArray(ArrayMarshalerFunc(func(inner ArrayEncoder) error {
+					inner.AppendString("a")
+					inner.AppendString("b")
+					return nil
+				}))
+				arr.AppendObject(loggable{true})
+				arr.AppendString("c")
+				return nil
+			}))
+		}},
+		{"namespace in an object", "k.ns.a=1 b=2", func(e Encoder) {
+			e.AddObject("k", ObjectMarshalerFunc(func(enc ObjectEncoder) error {
+				enc.OpenNamespace("ns")
+				enc.AddInt("a", 1)
+				return nil
+			}))
+			e.AddInt("b", 2)
+		}},
+		{"quoting", `a="" b="x y" c="say \"hi\"" d="back\\slash" e="tab\there" f="\u0001" g=héllo h="\ufffd"`, func(e Encoder) {
+			e.AddString("a", "")
+			e.AddString("b", "x y")
+			e.AddString("c", `say "hi"`)
+			e.AddString("d", `back\slash`)
+			e.AddString("e", "tab\there")
+			e.AddString("f", "\x01")
+			e.AddString("g", "héllo")
+			e.AddString("h", "\xff")
+		}},
+		{"keys", `a_b=1 c_d=2 e_f=3 _=4 ns.日本=5`, func(e Encoder) {
+			e.AddInt("a b", 1)
+			e.AddInt("c=d", 2)
+			e.AddInt(`e"f`, 3)
+			e.AddInt("", 4)
+			e.OpenNamespace("ns")
+			e.AddInt("日本", 5)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg := logfmtEncoderConfig()
+			cfg.MessageKey = ""
+			cfg.LevelKey = ""
+			cfg.TimeKey = ""
+			enc := NewLogfmtEncoder(cfg)
+			tt.f(enc)
+			buf, err := enc.EncodeEntry(Entry{}, nil)
+			if assert.NoError(t, err, "Unexpected error encoding entry.") {
+				assert.Equal(t, tt.expected+"\n", buf.String(), "Unexpected fields.")
+			}
+		})
+	}
+}
+
+func TestLogfmtEncoderErrors(t *testing.T) {
+	enc := NewLogfmtEncoder(logfmtEncoderConfig())
+	assert.Error(t, enc.AddObject("k", loggable{false}), "Expected object marshaling errors to propagate.")
+	assert.Error(t, enc.AddArray("k", loggable{false}), "Expected array marshaling errors to propagate.")
+	assert.Error(t, enc.AddReflected("k", func() {}), "Expected reflection errors to propagate.")
+	assert.Error(t, enc.AddArray("k", ArrayMarshalerFunc(func(arr ArrayEncoder) error {
+		arr.AppendString("a")
+		return errors.New("fail")
+	})), "Expected errors from nested arrays to propagate.")
+}
+
+func BenchmarkLogfmtEncodeEntry(b *testing.B) {
+	enc := NewLogfmtEncoder(logfmtEncoderConfig())
+	enc.AddString("service", "api")
+	ent := Entry{Level: InfoLevel, Time: time.Unix(0, 0), Message: "request served"}
+	fields := []Field{
+		{Key: "path", Type: StringType, String: "/users/42"},
+		{Key: "status", Type: Int64Type, Integer: 200},
+		{Key: "elapsed", Type: DurationType, Integer: int64(time.Millisecond)},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, _ := enc.EncodeEntry(ent, fields)
+		buf.Free()
+	}
+}
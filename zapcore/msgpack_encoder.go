@@ -0,0 +1,622 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/internal/bufferpool"
+)
+
+// MessagePack formats, named as in the specification.
+const (
+	_msgpackNil       = 0xc0
+	_msgpackFalse     = 0xc2
+	_msgpackTrue      = 0xc3
+	_msgpackBin8      = 0xc4
+	_msgpackBin16     = 0xc5
+	_msgpackBin32     = 0xc6
+	_msgpackExt8      = 0xc7
+	_msgpackFloat32   = 0xca
+	_msgpackFloat64   = 0xcb
+	_msgpackUint8     = 0xcc
+	_msgpackUint16    = 0xcd
+	_msgpackUint32    = 0xce
+	_msgpackUint64    = 0xcf
+	_msgpackInt8      = 0xd0
+	_msgpackInt16     = 0xd1
+	_msgpackInt32     = 0xd2
+	_msgpackInt64     = 0xd3
+	_msgpackFixext4   = 0xd6
+	_msgpackFixext8   = 0xd7
+	_msgpackFixstr    = 0xa0
+	_msgpackStr8      = 0xd9
+	_msgpackStr16     = 0xda
+	_msgpackStr32     = 0xdb
+	_msgpackArray32   = 0xdd
+	_msgpackMap32     = 0xdf
+	_msgpackTimestamp = 0xff // extension type -1
+)
+
+var _msgpackPool = sync.Pool{New: func() interface{} {
+	return &msgpackEncoder{}
+}}
+
+func getMsgpackEncoder() *msgpackEncoder {
+	return _msgpackPool.Get().(*msgpackEncoder)
+}
+
+func putMsgpackEncoder(enc *msgpackEncoder) {
+	enc.EncoderConfig = nil
+	enc.buf = nil
+	enc.containers = enc.containers[:0]
+	_msgpackPool.Put(enc)
+}
+
+// A msgpackContainer is an open map or array. Since the encoder doesn't know
+// how many elements it'll hold up front, its header is written with a
+// placeholder length that's filled in when it's closed.
+type msgpackContainer struct {
+	header int // offset of the header, or -1 for the top level of the context
+	n      int // number of elements or key-value pairs
+	array  bool
+}
+
+type msgpackEncoder struct {
+	*EncoderConfig
+	buf *buffer.Buffer
+
+	// Open maps and arrays, innermost last. The first is the top level of the
+	// entry, and the rest are namespaces and any objects and arrays being
+	// marshaled.
+	containers []msgpackContainer
+}
+
+// NewMsgpackEncoder creates an encoder that writes each entry as a
+// MessagePack map, as used by fluentd's forward protocol and other
+// msgpack-based pipelines.
+//
+// Values use MessagePack's native types where possible: binary data is a
+// bin value, times use the timestamp extension type (-1), durations are
+// integer nanoseconds, and reflected values are converted to maps, arrays,
+// and primitives. As in the JSON encoder, complex numbers are strings like
+// "1+2i". Since MessagePack represents them natively, EncodeTime and
+// EncodeDuration are ignored, as is LineEnding; the other keys and primitive
+// encoders in the EncoderConfig work as they do for the JSON encoder.
+// Namespaces are nested maps, and invalid UTF-8 in strings is replaced with
+// U+FFFD.
+//
+// Since each entry is written in a single pass, maps and arrays always use
+// the 32-bit length formats.
+func NewMsgpackEncoder(cfg EncoderConfig) Encoder {
+	return newMsgpackEncoder(cfg)
+}
+
+func newMsgpackEncoder(cfg EncoderConfig) *msgpackEncoder {
+	return &msgpackEncoder{
+		EncoderConfig: &cfg,
+		buf:           bufferpool.Get(),
+		containers:    []msgpackContainer{{header: -1}},
+	}
+}
+
+func (enc *msgpackEncoder) AddArray(key string, arr ArrayMarshaler) error {
+	enc.addKey(key)
+	return enc.AppendArray(arr)
+}
+
+func (enc *msgpackEncoder) AddObject(key string, obj ObjectMarshaler) error {
+	enc.addKey(key)
+	return enc.AppendObject(obj)
+}
+
+func (enc *msgpackEncoder) AddBinary(key string, val []byte) {
+	enc.addKey(key)
+	n := len(val)
+	switch {
+	case n <= math.MaxUint8:
+		enc.buf.AppendByte(_msgpackBin8)
+		enc.buf.AppendByte(byte(n))
+	case n <= math.MaxUint16:
+		enc.buf.AppendByte(_msgpackBin16)
+		enc.appendUint16(uint16(n))
+	default:
+		enc.buf.AppendByte(_msgpackBin32)
+		enc.appendUint32(uint32(n))
+	}
+	enc.buf.Write(val)
+}
+
+func (enc *msgpackEncoder) AddByteString(key string, val []byte) {
+	enc.addKey(key)
+	enc.AppendByteString(val)
+}
+
+func (enc *msgpackEncoder) AddBool(key string, val bool) {
+	enc.addKey(key)
+	enc.AppendBool(val)
+}
+
+func (enc *msgpackEncoder) AddComplex128(key string, val complex128) {
+	enc.addKey(key)
+	enc.AppendComplex128(val)
+}
+
+func (enc *msgpackEncoder) AddDuration(key string, val time.Duration) {
+	enc.addKey(key)
+	enc.AppendDuration(val)
+}
+
+func (enc *msgpackEncoder) AddFloat64(key string, val float64) {
+	enc.addKey(key)
+	enc.AppendFloat64(val)
+}
+
+func (enc *msgpackEncoder) AddFloat32(key string, val float32) {
+	enc.addKey(key)
+	enc.AppendFloat32(val)
+}
+
+func (enc *msgpackEncoder) AddInt64(key string, val int64) {
+	enc.addKey(key)
+	enc.AppendInt64(val)
+}
+
+func (enc *msgpackEncoder) AddReflected(key string, obj interface{}) error {
+	val, err := msgpackReflect(obj)
+	if err != nil {
+		return err
+	}
+	enc.addKey(key)
+	enc.appendReflected(val)
+	return nil
+}
+
+func (enc *msgpackEncoder) OpenNamespace(key string) {
+	enc.addKey(key)
+	enc.open(false)
+}
+
+func (enc *msgpackEncoder) AddString(key, val string) {
+	enc.addKey(key)
+	enc.AppendString(val)
+}
+
+func (enc *msgpackEncoder) AddTime(key string, val time.Time) {
+	enc.addKey(key)
+	enc.AppendTime(val)
+}
+
+func (enc *msgpackEncoder) AddUint64(key string, val uint64) {
+	enc.addKey(key)
+	enc.AppendUint64(val)
+}
+
+func (enc *msgpackEncoder) AppendArray(arr ArrayMarshaler) error {
+	enc.addElement()
+	depth := len(enc.containers)
+	enc.open(true)
+	err := arr.MarshalLogArray(enc)
+	enc.closeTo(depth)
+	return err
+}
+
+func (enc *msgpackEncoder) AppendObject(obj ObjectMarshaler) error {
+	enc.addElement()
+	// Closing the object also closes any namespaces it opened.
+	depth := len(enc.containers)
+	enc.open(false)
+	err := obj.MarshalLogObject(enc)
+	enc.closeTo(depth)
+	return err
+}
+
+func (enc *msgpackEncoder) AppendBool(val bool) {
+	enc.addElement()
+	if val {
+		enc.buf.AppendByte(_msgpackTrue)
+	} else {
+		enc.buf.AppendByte(_msgpackFalse)
+	}
+}
+
+func (enc *msgpackEncoder) AppendByteString(val []byte) {
+	if !utf8.Valid(val) {
+		// Rare, so allocating is fine.
+		enc.AppendString(string(val))
+		return
+	}
+	enc.addElement()
+	enc.appendStrHeader(len(val))
+	enc.buf.Write(val)
+}
+
+func (enc *msgpackEncoder) AppendComplex128(val complex128) {
+	// Cast to a platform-independent, fixed-size type.
+	r, i := float64(real(val)), float64(imag(val))
+	var scratch [64]byte
+	s := strconv.AppendFloat(scratch[:0], r, 'f', -1, 64)
+	s = append(s, '+')
+	s = strconv.AppendFloat(s, i, 'f', -1, 64)
+	s = append(s, 'i')
+	enc.AppendByteString(s)
+}
+
+func (enc *msgpackEncoder) AppendDuration(val time.Duration) {
+	enc.AppendInt64(int64(val))
+}
+
+func (enc *msgpackEncoder) AppendFloat64(val float64) {
+	enc.addElement()
+	enc.buf.AppendByte(_msgpackFloat64)
+	enc.appendUint64(math.Float64bits(val))
+}
+
+func (enc *msgpackEncoder) AppendFloat32(val float32) {
+	enc.addElement()
+	enc.buf.AppendByte(_msgpackFloat32)
+	enc.appendUint32(math.Float32bits(val))
+}
+
+func (enc *msgpackEncoder) AppendInt64(val int64) {
+	if val >= 0 {
+		enc.AppendUint64(uint64(val))
+		return
+	}
+	enc.addElement()
+	switch {
+	case val >= -32:
+		// Negative fixint.
+		enc.buf.AppendByte(byte(val))
+	case val >= math.MinInt8:
+		enc.buf.AppendByte(_msgpackInt8)
+		enc.buf.AppendByte(byte(val))
+	case val >= math.MinInt16:
+		enc.buf.AppendByte(_msgpackInt16)
+		enc.appendUint16(uint16(val))
+	case val >= math.MinInt32:
+		enc.buf.AppendByte(_msgpackInt32)
+		enc.appendUint32(uint32(val))
+	default:
+		enc.buf.AppendByte(_msgpackInt64)
+		enc.appendUint64(uint64(val))
+	}
+}
+
+func (enc *msgpackEncoder) AppendReflected(obj interface{}) error {
+	val, err := msgpackReflect(obj)
+	if err != nil {
+		return err
+	}
+	enc.appendReflected(val)
+	return nil
+}
+
+func (enc *msgpackEncoder) AppendString(val string) {
+	enc.addElement()
+	enc.appendStr(val)
+}
+
+func (enc *msgpackEncoder) AppendTime(val time.Time) {
+	enc.addElement()
+	sec, nsec := val.Unix(), uint64(val.Nanosecond())
+	switch {
+	case nsec == 0 && sec>>32 == 0:
+		enc.buf.AppendByte(_msgpackFixext4)
+		enc.buf.AppendByte(_msgpackTimestamp)
+		enc.appendUint32(uint32(sec))
+	case sec>>34 == 0:
+		enc.buf.AppendByte(_msgpackFixext8)
+		enc.buf.AppendByte(_msgpackTimestamp)
+		enc.appendUint64(nsec<<34 | uint64(sec))
+	default:
+		enc.buf.AppendByte(_msgpackExt8)
+		enc.buf.AppendByte(12)
+		enc.buf.AppendByte(_msgpackTimestamp)
+		enc.appendUint32(uint32(nsec))
+		enc.appendUint64(uint64(sec))
+	}
+}
+
+func (enc *msgpackEncoder) AppendUint64(val uint64) {
+	enc.addElement()
+	switch {
+	case val <= math.MaxInt8:
+		// Positive fixint.
+		enc.buf.AppendByte(byte(val))
+	case val <= math.MaxUint8:
+		enc.buf.AppendByte(_msgpackUint8)
+		enc.buf.AppendByte(byte(val))
+	case val <= math.MaxUint16:
+		enc.buf.AppendByte(_msgpackUint16)
+		enc.appendUint16(uint16(val))
+	case val <= math.MaxUint32:
+		enc.buf.AppendByte(_msgpackUint32)
+		enc.appendUint32(uint32(val))
+	default:
+		enc.buf.AppendByte(_msgpackUint64)
+		enc.appendUint64(val)
+	}
+}
+
+func (enc *msgpackEncoder) AddComplex64(k string, v complex64) { enc.AddComplex128(k, complex128(v)) }
+func (enc *msgpackEncoder) AddInt(k string, v int)             { enc.AddInt64(k, int64(v)) }
+func (enc *msgpackEncoder) AddInt32(k string, v int32)         { enc.AddInt64(k, int64(v)) }
+func (enc *msgpackEncoder) AddInt16(k string, v int16)         { enc.AddInt64(k, int64(v)) }
+func (enc *msgpackEncoder) AddInt8(k string, v int8)           { enc.AddInt64(k, int64(v)) }
+func (enc *msgpackEncoder) AddUint(k string, v uint)           { enc.AddUint64(k, uint64(v)) }
+func (enc *msgpackEncoder) AddUint32(k string, v uint32)       { enc.AddUint64(k, uint64(v)) }
+func (enc *msgpackEncoder) AddUint16(k string, v uint16)       { enc.AddUint64(k, uint64(v)) }
+func (enc *msgpackEncoder) AddUint8(k string, v uint8)         { enc.AddUint64(k, uint64(v)) }
+func (enc *msgpackEncoder) AddUintptr(k string, v uintptr)     { enc.AddUint64(k, uint64(v)) }
+func (enc *msgpackEncoder) AppendComplex64(v complex64)        { enc.AppendComplex128(complex128(v)) }
+func (enc *msgpackEncoder) AppendInt(v int)                    { enc.AppendInt64(int64(v)) }
+func (enc *msgpackEncoder) AppendInt32(v int32)                { enc.AppendInt64(int64(v)) }
+func (enc *msgpackEncoder) AppendInt16(v int16)                { enc.AppendInt64(int64(v)) }
+func (enc *msgpackEncoder) AppendInt8(v int8)                  { enc.AppendInt64(int64(v)) }
+func (enc *msgpackEncoder) AppendUint(v uint)                  { enc.AppendUint64(uint64(v)) }
+func (enc *msgpackEncoder) AppendUint32(v uint32)              { enc.AppendUint64(uint64(v)) }
+func (enc *msgpackEncoder) AppendUint16(v uint16)              { enc.AppendUint64(uint64(v)) }
+func (enc *msgpackEncoder) AppendUint8(v uint8)                { enc.AppendUint64(uint64(v)) }
+func (enc *msgpackEncoder) AppendUintptr(v uintptr)            { enc.AppendUint64(uint64(v)) }
+
+func (enc *msgpackEncoder) Clone() Encoder {
+	clone := enc.clone()
+	clone.buf.Write(enc.buf.Bytes())
+	clone.containers = append(clone.containers, enc.containers...)
+	return clone
+}
+
+func (enc *msgpackEncoder) clone() *msgpackEncoder {
+	clone := getMsgpackEncoder()
+	clone.EncoderConfig = enc.EncoderConfig
+	clone.buf = bufferpool.Get()
+	return clone
+}
+
+func (enc *msgpackEncoder) EncodeEntry(ent Entry, fields []Field) (*buffer.Buffer, error) {
+	final := enc.clone()
+	final.open(false)
+
+	if final.LevelKey != "" {
+		final.addKey(final.LevelKey)
+		cur := final.buf.Len()
+		final.EncodeLevel(ent.Level, final)
+		if cur == final.buf.Len() {
+			// User-supplied EncodeLevel was a no-op. Fall back to strings to keep
+			// output well-formed.
+			final.AppendString(ent.Level.String())
+		}
+	}
+	if final.TimeKey != "" {
+		final.AddTime(final.TimeKey, ent.Time)
+	}
+	if ent.LoggerName != "" && final.NameKey != "" {
+		final.addKey(final.NameKey)
+		cur := final.buf.Len()
+		nameEncoder := final.EncodeName
+
+		// if no name encoder provided, fall back to FullNameEncoder for
+		// backwards compatibility
+		if nameEncoder == nil {
+			nameEncoder = FullNameEncoder
+		}
+
+		nameEncoder(ent.LoggerName, final)
+		if cur == final.buf.Len() {
+			// User-supplied EncodeName was a no-op. Fall back to strings to
+			// keep output well-formed.
+			final.AppendString(ent.LoggerName)
+		}
+	}
+	if ent.Caller.Defined && final.CallerKey != "" {
+		final.addKey(final.CallerKey)
+		cur := final.buf.Len()
+		final.EncodeCaller(ent.Caller, final)
+		if cur == final.buf.Len() {
+			// User-supplied EncodeCaller was a no-op. Fall back to strings to
+			// keep output well-formed.
+			final.AppendString(ent.Caller.String())
+		}
+	}
+	if final.MessageKey != "" {
+		final.AddString(enc.MessageKey, ent.Message)
+	}
+
+	// Splice in the context, along with any namespaces it left open.
+	base := final.buf.Len()
+	final.buf.Write(enc.buf.Bytes())
+	final.containers[0].n += enc.containers[0].n
+	for _, c := range enc.containers[1:] {
+		c.header += base
+		final.containers = append(final.containers, c)
+	}
+	addFields(final, fields)
+	final.closeTo(1)
+	if ent.Stack != "" && final.StacktraceKey != "" {
+		final.AddString(final.StacktraceKey, ent.Stack)
+	}
+	final.closeTo(0)
+
+	ret := final.buf
+	putMsgpackEncoder(final)
+	return ret, nil
+}
+
+func (enc *msgpackEncoder) addKey(key string) {
+	enc.containers[len(enc.containers)-1].n++
+	enc.appendStr(key)
+}
+
+// addElement counts a new value if it's an array element; values in maps are
+// counted along with their keys.
+func (enc *msgpackEncoder) addElement() {
+	if last := len(enc.containers) - 1; last >= 0 && enc.containers[last].array {
+		enc.containers[last].n++
+	}
+}
+
+// open starts a map or an array.
+func (enc *msgpackEncoder) open(array bool) {
+	enc.containers = append(enc.containers, msgpackContainer{
+		header: enc.buf.Len(),
+		array:  array,
+	})
+	if array {
+		enc.buf.AppendByte(_msgpackArray32)
+	} else {
+		enc.buf.AppendByte(_msgpackMap32)
+	}
+	enc.appendUint32(0)
+}
+
+// closeTo closes containers until only depth remain open, filling in their
+// lengths.
+func (enc *msgpackEncoder) closeTo(depth int) {
+	bs := enc.buf.Bytes()
+	for len(enc.containers) > depth {
+		c := enc.containers[len(enc.containers)-1]
+		enc.containers = enc.containers[:len(enc.containers)-1]
+		binary.BigEndian.PutUint32(bs[c.header+1:], uint32(c.n))
+	}
+}
+
+func (enc *msgpackEncoder) appendStr(s string) {
+	if !utf8.ValidString(s) {
+		s = replaceInvalidUTF8(s)
+	}
+	enc.appendStrHeader(len(s))
+	enc.buf.AppendString(s)
+}
+
+func (enc *msgpackEncoder) appendStrHeader(n int) {
+	switch {
+	case n < 32:
+		enc.buf.AppendByte(_msgpackFixstr | byte(n))
+	case n <= math.MaxUint8:
+		enc.buf.AppendByte(_msgpackStr8)
+		enc.buf.AppendByte(byte(n))
+	case n <= math.MaxUint16:
+		enc.buf.AppendByte(_msgpackStr16)
+		enc.appendUint16(uint16(n))
+	default:
+		enc.buf.AppendByte(_msgpackStr32)
+		enc.appendUint32(uint32(n))
+	}
+}
+
+// appendReflected writes a value decoded from JSON by msgpackReflect.
+func (enc *msgpackEncoder) appendReflected(val interface{}) {
+	switch val := val.(type) {
+	case bool:
+		enc.AppendBool(val)
+	case string:
+		enc.AppendString(val)
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			enc.AppendInt64(i)
+		} else if u, err := strconv.ParseUint(string(val), 10, 64); err == nil {
+			enc.AppendUint64(u)
+		} else {
+			f, _ := val.Float64()
+			enc.AppendFloat64(f)
+		}
+	case []interface{}:
+		enc.addElement()
+		enc.open(true)
+		for _, v := range val {
+			enc.appendReflected(v)
+		}
+		enc.closeTo(len(enc.containers) - 1)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		enc.addElement()
+		enc.open(false)
+		for _, k := range keys {
+			enc.addKey(k)
+			enc.appendReflected(val[k])
+		}
+		enc.closeTo(len(enc.containers) - 1)
+	default:
+		enc.addElement()
+		enc.buf.AppendByte(_msgpackNil)
+	}
+}
+
+func (enc *msgpackEncoder) appendUint16(n uint16) {
+	enc.buf.AppendByte(byte(n >> 8))
+	enc.buf.AppendByte(byte(n))
+}
+
+func (enc *msgpackEncoder) appendUint32(n uint32) {
+	enc.buf.AppendByte(byte(n >> 24))
+	enc.buf.AppendByte(byte(n >> 16))
+	enc.buf.AppendByte(byte(n >> 8))
+	enc.buf.AppendByte(byte(n))
+}
+
+func (enc *msgpackEncoder) appendUint64(n uint64) {
+	enc.appendUint32(uint32(n >> 32))
+	enc.appendUint32(uint32(n))
+}
+
+// msgpackReflect converts a value to the generic maps, slices, and primitives
+// of its JSON representation, so that it can be written natively.
+func msgpackReflect(obj interface{}) (interface{}, error) {
+	marshaled, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(marshaled))
+	dec.UseNumber()
+	var val interface{}
+	err = dec.Decode(&val)
+	return val, err
+}
+
+// replaceInvalidUTF8 replaces each byte of invalid UTF-8 in s with U+FFFD.
+func replaceInvalidUTF8(s string) string {
+	b := make([]byte, 0, len(s)+2)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, string(utf8.RuneError)...)
+		} else {
+			b = append(b, s[i:i+size]...)
+		}
+		i += size
+	}
+	return string(b)
+}
@@ -0,0 +1,357 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeMsgpack is a minimal MessagePack decoder for the formats the encoder
+// writes. Integers decode to int64 (or uint64, if they don't fit), strings to
+// string, binary to []byte, and timestamps to time.Time.
+func decodeMsgpack(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, fmt.Errorf("unexpected end of input")
+	}
+	format, b := b[0], b[1:]
+	next := func(n int) []byte {
+		if len(b) < n {
+			panic("truncated input")
+		}
+		bs := b[:n]
+		b = b[n:]
+		return bs
+	}
+	str := func(n int) (interface{}, []byte, error) { return string(next(n)), b, nil }
+
+	switch {
+	case format <= 0x7f:
+		return int64(format), b, nil
+	case format >= 0xe0:
+		return int64(int8(format)), b, nil
+	case format&0xe0 == _msgpackFixstr:
+		return str(int(format & 0x1f))
+	}
+	switch format {
+	case _msgpackNil:
+		return nil, b, nil
+	case _msgpackFalse, _msgpackTrue:
+		return format == _msgpackTrue, b, nil
+	case _msgpackBin8:
+		return next(int(next(1)[0])), b, nil
+	case _msgpackBin16:
+		return next(int(binary.BigEndian.Uint16(next(2)))), b, nil
+	case _msgpackBin32:
+		return next(int(binary.BigEndian.Uint32(next(4)))), b, nil
+	case _msgpackFloat32:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(next(4)))), b, nil
+	case _msgpackFloat64:
+		return math.Float64frombits(binary.BigEndian.Uint64(next(8))), b, nil
+	case _msgpackUint8:
+		return int64(next(1)[0]), b, nil
+	case _msgpackUint16:
+		return int64(binary.BigEndian.Uint16(next(2))), b, nil
+	case _msgpackUint32:
+		return int64(binary.BigEndian.Uint32(next(4))), b, nil
+	case _msgpackUint64:
+		n := binary.BigEndian.Uint64(next(8))
+		if n > math.MaxInt64 {
+			return n, b, nil
+		}
+		return int64(n), b, nil
+	case _msgpackInt8:
+		return int64(int8(next(1)[0])), b, nil
+	case _msgpackInt16:
+		return int64(int16(binary.BigEndian.Uint16(next(2)))), b, nil
+	case _msgpackInt32:
+		return int64(int32(binary.BigEndian.Uint32(next(4)))), b, nil
+	case _msgpackInt64:
+		return int64(binary.BigEndian.Uint64(next(8))), b, nil
+	case _msgpackStr8:
+		return str(int(next(1)[0]))
+	case _msgpackStr16:
+		return str(int(binary.BigEndian.Uint16(next(2))))
+	case _msgpackStr32:
+		return str(int(binary.BigEndian.Uint32(next(4))))
+	case _msgpackFixext4:
+		if next(1)[0] != _msgpackTimestamp {
+			return nil, nil, fmt.Errorf("unknown extension type")
+		}
+		return time.Unix(int64(binary.BigEndian.Uint32(next(4))), 0), b, nil
+	case _msgpackFixext8:
+		if next(1)[0] != _msgpackTimestamp {
+			return nil, nil, fmt.Errorf("unknown extension type")
+		}
+		n := binary.BigEndian.Uint64(next(8))
+		return time.Unix(int64(n&(1<<34-1)), int64(n>>34)), b, nil
+	case _msgpackExt8:
+		if next(1)[0] != 12 || next(1)[0] != _msgpackTimestamp {
+			return nil, nil, fmt.Errorf("unknown extension type")
+		}
+		nsec := binary.BigEndian.Uint32(next(4))
+		return time.Unix(int64(binary.BigEndian.Uint64(next(8))), int64(nsec)), b, nil
+	case _msgpackArray32:
+		arr := []interface{}{}
+		for n := binary.BigEndian.Uint32(next(4)); n > 0; n-- {
+			v, rest, err := decodeMsgpack(b)
+			if err != nil {
+				return nil, nil, err
+			}
+			arr, b = append(arr, v), rest
+		}
+		return arr, b, nil
+	case _msgpackMap32:
+		m := map[string]interface{}{}
+		for n := binary.BigEndian.Uint32(next(4)); n > 0; n-- {
+			k, rest, err := decodeMsgpack(b)
+			if err != nil {
+				return nil, nil, err
+			}
+			v, rest, err := decodeMsgpack(rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[k.(string)], b = v, rest
+		}
+		return m, b, nil
+	}
+	return nil, nil, fmt.Errorf("unknown format %#x", format)
+}
+
+func msgpackEncoderConfig() EncoderConfig {
+	return EncoderConfig{
+		MessageKey:    "msg",
+		LevelKey:      "level",
+		TimeKey:       "ts",
+		NameKey:       "logger",
+		CallerKey:     "caller",
+		StacktraceKey: "stacktrace",
+		EncodeLevel:   LowercaseLevelEncoder,
+		EncodeCaller:  ShortCallerEncoder,
+	}
+}
+
+func TestMsgpackEncoderPrimitives(t *testing.T) {
+	tests := []struct {
+		desc     string
+		f        func(ArrayEncoder)
+		expected string
+	}{
+		{"positive fixint", func(e ArrayEncoder) { e.AppendUint(127) }, "7f"},
+		{"uint8", func(e ArrayEncoder) { e.AppendInt(200) }, "ccc8"},
+		{"uint16", func(e ArrayEncoder) { e.AppendUint16(1000) }, "cd03e8"},
+		{"uint32", func(e ArrayEncoder) { e.AppendUint32(1000000) }, "ce000f4240"},
+		{"uint64", func(e ArrayEncoder) { e.AppendUint64(math.MaxUint64) }, "cfffffffffffffffff"},
+		{"negative fixint", func(e ArrayEncoder) { e.AppendInt8(-32) }, "e0"},
+		{"int8", func(e ArrayEncoder) { e.AppendInt8(-33) }, "d0df"},
+		{"int16", func(e ArrayEncoder) { e.AppendInt16(-1000) }, "d1fc18"},
+		{"int32", func(e ArrayEncoder) { e.AppendInt32(math.MinInt32) }, "d280000000"},
+		{"int64", func(e ArrayEncoder) { e.AppendInt64(math.MinInt64) }, "d38000000000000000"},
+		{"bools", func(e ArrayEncoder) {
+			e.AppendBool(false)
+			e.AppendBool(true)
+		}, "c2c3"},
+		{"float64", func(e ArrayEncoder) { e.AppendFloat64(1.1) }, "cb3ff199999999999a"},
+		{"float32", func(e ArrayEncoder) { e.AppendFloat32(100000) }, "ca47c35000"},
+		{"complex", func(e ArrayEncoder) { e.AppendComplex64(1 + 2i) }, "a4312b3269"},
+		{"duration", func(e ArrayEncoder) { e.AppendDuration(time.Microsecond) }, "cd03e8"},
+		{"timestamp 32", func(e ArrayEncoder) { e.AppendTime(time.Unix(1363896240, 0)) }, "d6ff514b67b0"},
+		{"timestamp 64", func(e ArrayEncoder) { e.AppendTime(time.Unix(1363896240, 5e8)) }, "d7ff77359400514b67b0"},
+		{"timestamp 96", func(e ArrayEncoder) { e.AppendTime(time.Unix(-1, 1)) }, "c70cff00000001ffffffffffffffff"},
+		{"fixstr", func(e ArrayEncoder) { e.AppendString("IETF") }, "a449455446"},
+		{"str8", func(e ArrayEncoder) { e.AppendString("abcdefghijabcdefghijabcdefghijab") }, "d920" + hex.EncodeToString([]byte("abcdefghijabcdefghijabcdefghijab"))},
+		{"invalid UTF-8", func(e ArrayEncoder) { e.AppendString("a\xffb") }, "a561efbfbd62"},
+		{"byte string", func(e ArrayEncoder) { e.AppendByteString([]byte("ü")) }, "a2c3bc"},
+		{"invalid UTF-8 byte string", func(e ArrayEncoder) { e.AppendByteString([]byte{0xff}) }, "a3efbfbd"},
+		{"reflected", func(e ArrayEncoder) {
+			e.AppendReflected(map[string]interface{}{"b": []int{1}, "a": nil})
+		}, "df00000002a161c0a162dd0000000101"},
+		{"array", func(e ArrayEncoder) {
+			e.AppendArray(ArrayMarshalerFunc(func(arr ArrayEncoder) error {
+				arr.AppendInt(1)
+				return arr.AppendArray(ArrayMarshalerFunc(func(ArrayEncoder) error { return nil }))
+			}))
+		}, "dd0000000201dd00000000"},
+		{"object", func(e ArrayEncoder) { e.AppendObject(loggable{true}) }, "df00000001a86c6f676761626c65a3796573"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			enc := newMsgpackEncoder(msgpackEncoderConfig())
+			tt.f(enc)
+			assert.Equal(t, tt.expected, hex.EncodeToString(enc.buf.Bytes()), "Unexpected MessagePack.")
+		})
+	}
+}
+
+func TestMsgpackEncodeEntry(t *testing.T) {
+	ts := time.Unix(1533567845, 0)
+	caller := EntryCaller{Defined: true, File: "/src/app/main.go", Line: 42}
+
+	tests := []struct {
+		desc     string
+		cfg      func(*EncoderConfig)
+		ent      Entry
+		fields   []Field
+		expected map[string]interface{}
+	}{
+		{
+			desc: "metadata and fields",
+			ent: Entry{
+				Level:      ErrorLevel,
+				Time:       ts,
+				LoggerName: "main.db",
+				Message:    "query failed",
+				Caller:     caller,
+				Stack:      "goroutine 1",
+			},
+			fields: []Field{
+				{Key: "table", Type: StringType, String: "users"},
+				{Key: "elapsed", Type: DurationType, Integer: int64(time.Millisecond)},
+				{Key: "raw", Type: BinaryType, Interface: []byte("foo")},
+			},
+			expected: map[string]interface{}{
+				"level":      "error",
+				"ts":         ts,
+				"logger":     "main.db",
+				"caller":     "app/main.go:42",
+				"msg":        "query failed",
+				"table":      "users",
+				"elapsed":    int64(time.Millisecond),
+				"raw":        []byte("foo"),
+				"stacktrace": "goroutine 1",
+			},
+		},
+		{
+			desc: "omitted keys",
+			cfg: func(cfg *EncoderConfig) {
+				cfg.LevelKey = ""
+				cfg.TimeKey = ""
+				cfg.CallerKey = ""
+				cfg.StacktraceKey = ""
+			},
+			ent:      Entry{Message: "hi", Caller: caller, Stack: "s"},
+			expected: map[string]interface{}{"msg": "hi"},
+		},
+		{
+			desc: "no-op encoders",
+			cfg: func(cfg *EncoderConfig) {
+				cfg.TimeKey = ""
+				cfg.EncodeLevel = func(Level, PrimitiveArrayEncoder) {}
+				cfg.EncodeName = func(string, PrimitiveArrayEncoder) {}
+				cfg.EncodeCaller = func(EntryCaller, PrimitiveArrayEncoder) {}
+			},
+			ent: Entry{Level: WarnLevel, LoggerName: "svc", Caller: caller},
+			expected: map[string]interface{}{
+				"level":  "warn",
+				"logger": "svc",
+				"caller": "/src/app/main.go:42",
+				"msg":    "",
+			},
+		},
+		{
+			desc: "namespaces",
+			cfg:  func(cfg *EncoderConfig) { cfg.TimeKey = "" },
+			ent:  Entry{Level: InfoLevel, Message: "m", Stack: "s"},
+			fields: []Field{
+				{Key: "outer", Type: NamespaceType},
+				{Key: "obj", Type: ObjectMarshalerType, Interface: ObjectMarshalerFunc(func(enc ObjectEncoder) error {
+					enc.OpenNamespace("inner")
+					enc.AddInt("a", 1)
+					return nil
+				})},
+				{Key: "b", Type: BoolType, Integer: 1},
+			},
+			expected: map[string]interface{}{
+				"level": "info",
+				"msg":   "m",
+				"outer": map[string]interface{}{
+					"obj": map[string]interface{}{"inner": map[string]interface{}{"a": int64(1)}},
+					"b":   true,
+				},
+				"stacktrace": "s",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg := msgpackEncoderConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			buf, err := NewMsgpackEncoder(cfg).EncodeEntry(tt.ent, tt.fields)
+			require.NoError(t, err, "Unexpected MessagePack encoding error.")
+			decoded, rest, err := decodeMsgpack(buf.Bytes())
+			require.NoError(t, err, "Couldn't decode MessagePack.")
+			assert.Empty(t, rest, "Unexpected trailing bytes.")
+			assert.Equal(t, tt.expected, decoded, "Unexpected entry.")
+			buf.Free()
+		})
+	}
+}
+
+func TestMsgpackEncoderClone(t *testing.T) {
+	parent := NewMsgpackEncoder(EncoderConfig{MessageKey: "msg"})
+	parent.AddInt("top", 1)
+	parent.OpenNamespace("ns")
+	parent.AddString("parent", "yes")
+	clone := parent.Clone()
+	clone.AddString("child", "yes")
+
+	decode := func(enc Encoder) interface{} {
+		buf, err := enc.EncodeEntry(Entry{Message: "m"}, []Field{{Key: "entry", Type: StringType, String: "yes"}})
+		require.NoError(t, err, "Unexpected error encoding entry.")
+		decoded, _, err := decodeMsgpack(buf.Bytes())
+		require.NoError(t, err, "Couldn't decode MessagePack.")
+		return decoded
+	}
+	assert.Equal(t, map[string]interface{}{
+		"msg": "m",
+		"top": int64(1),
+		"ns":  map[string]interface{}{"parent": "yes", "entry": "yes"},
+	}, decode(parent), "Expected the parent to be unaffected by its clone.")
+	assert.Equal(t, map[string]interface{}{
+		"msg": "m",
+		"top": int64(1),
+		"ns":  map[string]interface{}{"parent": "yes", "child": "yes", "entry": "yes"},
+	}, decode(clone), "Expected the clone to inherit context and namespaces.")
+	assert.Equal(t, map[string]interface{}{
+		"msg": "m",
+		"top": int64(1),
+		"ns":  map[string]interface{}{"parent": "yes", "entry": "yes"},
+	}, decode(parent), "Expected encoding an entry to leave the context unchanged.")
+}
+
+func TestMsgpackEncoderErrors(t *testing.T) {
+	enc := NewMsgpackEncoder(msgpackEncoderConfig())
+	assert.Error(t, enc.AddObject("k", loggable{false}), "Expected object marshaling errors to propagate.")
+	assert.Error(t, enc.AddArray("k", loggable{false}), "Expected array marshaling errors to propagate.")
+	assert.Error(t, enc.AddReflected("k", func() {}), "Expected reflection errors to propagate.")
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	_defaultQueueSize   = 1024
+	_dropReportInterval = time.Second
+)
+
+// A DropPolicy decides which entries a NonBlocking WriteSyncer discards when
+// its queue is full.
+type DropPolicy int
+
+const (
+	// DropNewest discards the entry being written.
+	DropNewest DropPolicy = iota
+	// DropOldest discards the oldest queued entry to make room for the entry
+	// being written.
+	DropOldest
+)
+
+type nonBlockingWriteSyncer struct {
+	ws             WriteSyncer
+	enc            Encoder
+	policy         DropPolicy
+	syncTimeout    time.Duration
+	reportInterval time.Duration
+
+	queue   chan []byte
+	syncs   chan chan struct{}
+	dropped atomic.Int64
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+
+	errMu sync.Mutex
+	err   error // from a background write, reported by the next Sync
+}
+
+// NonBlocking wraps a WriteSyncer in a bounded queue that's drained by a
+// background goroutine, so that a slow destination (like a stalled pipe or
+// network filesystem) never blocks the goroutines that log. When the queue
+// already holds queueSize writes, the policy decides which write to discard;
+// a non-positive size defaults to 1024 writes.
+//
+// Dropped writes are counted, and at most once a second the background
+// goroutine writes a synthetic WarnLevel entry with a message like "dropped
+// 12 entries", encoded with a clone of enc, so that the loss is visible in
+// the output. If enc is nil, the record is written as a plain line of text.
+//
+// Write never fails; errors from the wrapped WriteSyncer are reported by the
+// next call to Sync, which waits for the queue to drain. If the queue doesn't
+// drain and sync within syncTimeout, Sync gives up and returns an error,
+// leaving any errors from the background writes for the next Sync; a
+// non-positive timeout waits as long as necessary. Since cores sync after
+// writing entries above ErrorLevel, a timeout keeps a stalled destination
+// from blocking them. Callers should use the returned CloseFunc to drain the
+// queue and stop the background goroutine before exiting. Writes after
+// closing go straight to the wrapped WriteSyncer.
+func NonBlocking(ws WriteSyncer, enc Encoder, queueSize int, policy DropPolicy, syncTimeout time.Duration) (WriteSyncer, CloseFunc) {
+	s := newNonBlockingWriteSyncer(ws, enc, queueSize, policy, syncTimeout, _dropReportInterval)
+	return s, s.close
+}
+
+func newNonBlockingWriteSyncer(ws WriteSyncer, enc Encoder, queueSize int, policy DropPolicy, syncTimeout, reportInterval time.Duration) *nonBlockingWriteSyncer {
+	if queueSize <= 0 {
+		queueSize = _defaultQueueSize
+	}
+	if enc != nil {
+		enc = enc.Clone()
+	}
+
+	s := &nonBlockingWriteSyncer{
+		ws:             ws,
+		enc:            enc,
+		policy:         policy,
+		syncTimeout:    syncTimeout,
+		reportInterval: reportInterval,
+		queue:          make(chan []byte, queueSize),
+		syncs:          make(chan chan struct{}),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *nonBlockingWriteSyncer) Write(bs []byte) (int, error) {
+	select {
+	case <-s.done:
+		return s.ws.Write(bs)
+	default:
+	}
+
+	// The caller may reuse bs as soon as we return.
+	entry := append([]byte(nil), bs...)
+	select {
+	case s.queue <- entry:
+		return len(bs), nil
+	default:
+	}
+
+	if s.policy == DropOldest {
+		select {
+		case <-s.queue:
+			s.dropped.Inc()
+		default:
+		}
+		select {
+		case s.queue <- entry:
+			return len(bs), nil
+		default:
+		}
+	}
+	s.dropped.Inc()
+	return len(bs), nil
+}
+
+// Sync waits, at most the sync timeout, until every queued write has been
+// handed to the wrapped WriteSyncer, then syncs it.
+func (s *nonBlockingWriteSyncer) Sync() error {
+	var expired <-chan struct{}
+	if s.syncTimeout > 0 {
+		var stop func() bool
+		expired, stop = closeAfter(s.syncTimeout)
+		defer stop()
+	}
+
+	synced := make(chan struct{})
+	select {
+	case s.syncs <- synced:
+	case <-s.done:
+		return s.ws.Sync()
+	case <-expired:
+		return s.timeoutError()
+	}
+	select {
+	case <-synced:
+		return s.takeError()
+	case <-expired:
+		return s.timeoutError()
+	}
+}
+
+func (s *nonBlockingWriteSyncer) timeoutError() error {
+	return fmt.Errorf("timed out after %v waiting for queued writes to sync", s.syncTimeout)
+}
+
+func (s *nonBlockingWriteSyncer) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.reportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry := <-s.queue:
+			s.write(entry)
+		case <-ticker.C:
+			s.reportDropped()
+		case synced := <-s.syncs:
+			s.drain()
+			s.setError(s.ws.Sync())
+			close(synced)
+		case <-s.stop:
+			s.drain()
+			return
+		}
+	}
+}
+
+// drain writes every queued entry, followed by a report of any dropped
+// entries.
+func (s *nonBlockingWriteSyncer) drain() {
+	for {
+		select {
+		case entry := <-s.queue:
+			s.write(entry)
+		default:
+			s.reportDropped()
+			return
+		}
+	}
+}
+
+func (s *nonBlockingWriteSyncer) write(entry []byte) {
+	_, err := s.ws.Write(entry)
+	s.setError(err)
+}
+
+// setError records err, unless an earlier error hasn't been reported yet.
+func (s *nonBlockingWriteSyncer) setError(err error) {
+	s.errMu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.errMu.Unlock()
+}
+
+func (s *nonBlockingWriteSyncer) takeError() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	err := s.err
+	s.err = nil
+	return err
+}
+
+func (s *nonBlockingWriteSyncer) reportDropped() {
+	n := s.dropped.Swap(0)
+	if n == 0 {
+		return
+	}
+	record, err := encodeDropReport(s.enc, fmt.Sprintf("dropped %d entries", n))
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	s.write(record)
+}
+
+// encodeDropReport encodes a synthetic WarnLevel entry that reports lost
+// output. If enc is nil, the message is returned as a plain line of text.
+func encodeDropReport(enc Encoder, msg string) ([]byte, error) {
+	if enc == nil {
+		return []byte(msg + "\n"), nil
+	}
+	buf, err := enc.EncodeEntry(Entry{Level: WarnLevel, Time: time.Now(), Message: msg}, nil)
+	if err != nil {
+		return nil, err
+	}
+	record := append([]byte(nil), buf.Bytes()...)
+	buf.Free()
+	return record, nil
+}
+
+func (s *nonBlockingWriteSyncer) close() error {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+
+	err := s.takeError()
+	if syncErr := s.ws.Sync(); err == nil {
+		err = syncErr
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/internal/ztest"
+)
+
+// gatedBuffer is a lockedBuffer whose writes block until the gate opens.
+type gatedBuffer struct {
+	lockedBuffer
+	gate chan struct{}
+}
+
+func (b *gatedBuffer) Write(bs []byte) (int, error) {
+	<-b.gate
+	return b.lockedBuffer.Write(bs)
+}
+
+// fillQueue writes entries until the background goroutine is blocked on the
+// gated destination and the queue is full.
+func fillQueue(t testing.TB, ws WriteSyncer, entries ...string) {
+	s := ws.(*nonBlockingWriteSyncer)
+	ws.Write([]byte(entries[0]))
+	deadline := time.Now().Add(ztest.Timeout(time.Second))
+	for len(s.queue) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	require.Equal(t, 0, len(s.queue), "Expected the first entry to be dequeued.")
+	for _, e := range entries[1:] {
+		ws.Write([]byte(e))
+	}
+}
+
+func TestNonBlockingDropPolicies(t *testing.T) {
+	tests := []struct {
+		policy DropPolicy
+		want   string
+	}{
+		{DropNewest, "1\n2\n3\ndropped 2 entries\n"},
+		{DropOldest, "1\n4\n5\ndropped 2 entries\n"},
+	}
+
+	for _, tt := range tests {
+		buf := &gatedBuffer{gate: make(chan struct{})}
+		ws, stop := NonBlocking(buf, nil, 2, tt.policy, 0)
+
+		done := make(chan struct{})
+		go func() {
+			fillQueue(t, ws, "1\n", "2\n", "3\n", "4\n", "5\n")
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(ztest.Timeout(time.Second)):
+			t.Fatal("Writes blocked on a stalled destination.")
+		}
+
+		close(buf.gate)
+		require.NoError(t, stop(), "Unexpected error closing.")
+		assert.Equal(t, tt.want, buf.String(), "Unexpected output with policy %v.", tt.policy)
+	}
+}
+
+func TestNonBlockingDroppedRecordUsesEncoder(t *testing.T) {
+	buf := &gatedBuffer{gate: make(chan struct{})}
+	enc := NewJSONEncoder(EncoderConfig{MessageKey: "msg", LevelKey: "level", EncodeLevel: LowercaseLevelEncoder})
+	ws, stop := NonBlocking(buf, enc, 1, DropNewest, 0)
+	fillQueue(t, ws, "{}\n", "{}\n", "{}\n")
+
+	close(buf.gate)
+	require.NoError(t, ws.Sync(), "Unexpected error syncing.")
+	assert.Equal(t, "{}\n{}\n"+`{"level":"warn","msg":"dropped 1 entries"}`+"\n", buf.String(), "Unexpected output.")
+	require.NoError(t, stop(), "Unexpected error closing.")
+}
+
+func TestNonBlockingPeriodicReport(t *testing.T) {
+	buf := &gatedBuffer{gate: make(chan struct{})}
+	ws := newNonBlockingWriteSyncer(buf, nil, 1, DropNewest, 0, time.Millisecond)
+	defer ws.close()
+	fillQueue(t, ws, "a\n", "b\n", "c\n")
+
+	close(buf.gate)
+	deadline := time.Now().Add(ztest.Timeout(time.Second))
+	for !strings.Contains(buf.String(), "dropped 1 entries") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Contains(t, buf.String(), "dropped 1 entries\n", "Expected dropped entries to be reported without a Sync.")
+}
+
+func TestNonBlockingErrors(t *testing.T) {
+	buf := &lockedBuffer{}
+	ws, stop := NonBlocking(buf, nil, 0, DropNewest, 0)
+
+	buf.SetError(errors.New("broken"))
+	n, err := ws.Write([]byte("foo"))
+	assert.NoError(t, err, "Expected writes never to fail.")
+	assert.Equal(t, 3, n, "Unexpected number of bytes written.")
+	assert.EqualError(t, ws.Sync(), "broken", "Expected Sync to report the background error.")
+	assert.NoError(t, ws.Sync(), "Expected the error to be reported once.")
+
+	buf.SetError(nil)
+	require.NoError(t, stop(), "Unexpected error closing.")
+	require.NoError(t, stop(), "Expected closing twice to succeed.")
+	ws.Write([]byte("bar"))
+	assert.Equal(t, "bar", buf.String(), "Expected writes after closing to go straight through.")
+	assert.NoError(t, ws.Sync(), "Unexpected error syncing after close.")
+}
+
+func TestNonBlockingSyncTimeout(t *testing.T) {
+	buf := &gatedBuffer{gate: make(chan struct{})}
+	ws, stop := NonBlocking(buf, nil, 1, DropNewest, 10*time.Millisecond)
+	fillQueue(t, ws, "a\n", "b\n")
+
+	buf.SetError(errors.New("broken"))
+	err := ws.Sync()
+	if assert.Error(t, err, "Expected Sync to give up on a stalled destination.") {
+		assert.Contains(t, err.Error(), "timed out", "Unexpected error syncing a stalled destination.")
+	}
+
+	close(buf.gate)
+	assert.EqualError(t, ws.Sync(), "broken", "Expected the background error to be reported after the timeout.")
+	buf.SetError(nil)
+	require.NoError(t, stop(), "Unexpected error closing.")
+}
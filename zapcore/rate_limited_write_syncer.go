@@ -0,0 +1,202 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// A RateLimitPolicy decides what a RateLimit WriteSyncer does with writes
+// that exceed its budget.
+type RateLimitPolicy int
+
+const (
+	// RateLimitDrop discards writes that exceed the budget.
+	RateLimitDrop RateLimitPolicy = iota
+	// RateLimitDelay blocks writes until they fit in the budget.
+	RateLimitDelay
+)
+
+// RateLimitStats counts the output a RateLimit WriteSyncer has dropped.
+type RateLimitStats struct {
+	DroppedEntries int64
+	DroppedBytes   int64
+}
+
+type rateLimitedWriteSyncer struct {
+	sync.Mutex
+
+	ws             WriteSyncer
+	enc            Encoder
+	rate           float64 // bytes per second
+	burst          float64
+	policy         RateLimitPolicy
+	reportInterval time.Duration
+	now            func() time.Time
+	sleep          func(time.Duration)
+
+	tokens      float64 // may be negative after a delayed write
+	last        time.Time
+	shedEntries int64
+	shedBytes   int64
+	nextReport  time.Time
+
+	droppedEntries atomic.Int64
+	droppedBytes   atomic.Int64
+}
+
+// RateLimit wraps a WriteSyncer in a token bucket that admits bytesPerSecond
+// bytes of output per second on average, and up to burst bytes at once. A
+// non-positive burst defaults to one second's worth of output. If
+// bytesPerSecond isn't positive, output isn't limited and RateLimit returns
+// ws unchanged.
+//
+// With RateLimitDrop, writes that don't fit in the remaining budget are
+// discarded without error; writes larger than burst never fit. Dropped
+// writes are counted, and at most once a second, the next write that's
+// admitted is followed by a synthetic WarnLevel entry with a message like
+// "rate limit exceeded: dropped 12 entries (3400 bytes)", encoded with a
+// clone of enc; Sync writes any pending record immediately. If enc is nil,
+// the record is written as a plain line of text. Records count against the
+// budget like any other output. The returned function reports the total
+// output dropped so far.
+//
+// With RateLimitDelay, writes wait until the budget allows them, which slows
+// the goroutines that log instead of losing output. Writes larger than burst
+// wait for a full bucket.
+func RateLimit(ws WriteSyncer, enc Encoder, bytesPerSecond, burst int, policy RateLimitPolicy) (WriteSyncer, func() RateLimitStats) {
+	if bytesPerSecond <= 0 {
+		return ws, func() RateLimitStats { return RateLimitStats{} }
+	}
+	s := newRateLimitedWriteSyncer(ws, enc, bytesPerSecond, burst, policy, time.Now, time.Sleep)
+	return s, s.stats
+}
+
+func newRateLimitedWriteSyncer(ws WriteSyncer, enc Encoder, bytesPerSecond, burst int, policy RateLimitPolicy, now func() time.Time, sleep func(time.Duration)) *rateLimitedWriteSyncer {
+	if burst <= 0 {
+		burst = bytesPerSecond
+	}
+	if enc != nil {
+		enc = enc.Clone()
+	}
+	return &rateLimitedWriteSyncer{
+		ws:             ws,
+		enc:            enc,
+		rate:           float64(bytesPerSecond),
+		burst:          float64(burst),
+		policy:         policy,
+		reportInterval: _dropReportInterval,
+		now:            now,
+		sleep:          sleep,
+		tokens:         float64(burst),
+		last:           now(),
+	}
+}
+
+func (s *rateLimitedWriteSyncer) Write(bs []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.refill()
+	n := float64(len(bs))
+	switch s.policy {
+	case RateLimitDelay:
+		// Take the whole write at once, waiting for the deficit to refill.
+		// Holding the lock while sleeping keeps writes in order.
+		need := n
+		if need > s.burst {
+			need = s.burst
+		}
+		if s.tokens < need {
+			s.sleep(time.Duration((need - s.tokens) / s.rate * float64(time.Second)))
+			s.refill()
+		}
+	default:
+		if s.tokens < n {
+			s.shedEntries++
+			s.shedBytes += int64(len(bs))
+			s.droppedEntries.Inc()
+			s.droppedBytes.Add(int64(len(bs)))
+			return len(bs), nil
+		}
+	}
+	s.tokens -= n
+
+	written, err := s.ws.Write(bs)
+	if err != nil {
+		return written, err
+	}
+	return written, s.report(false)
+}
+
+func (s *rateLimitedWriteSyncer) Sync() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.report(true); err != nil {
+		return err
+	}
+	return s.ws.Sync()
+}
+
+func (s *rateLimitedWriteSyncer) stats() RateLimitStats {
+	return RateLimitStats{
+		DroppedEntries: s.droppedEntries.Load(),
+		DroppedBytes:   s.droppedBytes.Load(),
+	}
+}
+
+// refill adds the tokens earned since the last refill. Callers must hold the
+// lock.
+func (s *rateLimitedWriteSyncer) refill() {
+	now := s.now()
+	s.tokens += now.Sub(s.last).Seconds() * s.rate
+	if s.tokens > s.burst {
+		s.tokens = s.burst
+	}
+	s.last = now
+}
+
+// report writes a record of any shed output, unless one was written too
+// recently, and takes its size out of the budget. Callers must hold the lock.
+func (s *rateLimitedWriteSyncer) report(force bool) error {
+	if s.shedEntries == 0 {
+		return nil
+	}
+	now := s.now()
+	if !force && now.Before(s.nextReport) {
+		return nil
+	}
+	msg := fmt.Sprintf("rate limit exceeded: dropped %d entries (%d bytes)", s.shedEntries, s.shedBytes)
+	record, err := encodeDropReport(s.enc, msg)
+	if err != nil {
+		return err
+	}
+	s.shedEntries, s.shedBytes = 0, 0
+	s.nextReport = now.Add(s.reportInterval)
+	s.tokens -= float64(len(record))
+	_, err = s.ws.Write(record)
+	return err
+}
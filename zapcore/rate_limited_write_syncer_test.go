@@ -0,0 +1,145 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/zap/internal/ztest"
+)
+
+// fakeClock is a clock for rate limiters whose sleeps advance time instantly.
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+}
+
+func newTestRateLimiter(ws WriteSyncer, enc Encoder, rate, burst int, policy RateLimitPolicy) (*rateLimitedWriteSyncer, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	return newRateLimitedWriteSyncer(ws, enc, rate, burst, policy, clock.Now, clock.Sleep), clock
+}
+
+func TestRateLimitDrop(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ws, clock := newTestRateLimiter(AddSync(buf), nil, 10, 20, RateLimitDrop)
+
+	for _, s := range []string{"0123456789", "0123456789", "dropped", "too big for the burst!"} {
+		n, err := ws.Write([]byte(s))
+		require.NoError(t, err, "Expected dropped writes to succeed.")
+		assert.Equal(t, len(s), n, "Unexpected number of bytes written.")
+	}
+	assert.Equal(t, "01234567890123456789", buf.String(), "Expected writes past the burst to be dropped.")
+
+	assert.Equal(t, RateLimitStats{DroppedEntries: 2, DroppedBytes: 29}, ws.stats(), "Unexpected stats.")
+
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	ws.Write([]byte("abcde"))
+	assert.Equal(t, "01234567890123456789abcderate limit exceeded: dropped 2 entries (29 bytes)\n", buf.String(), "Expected a report after the next write.")
+
+	// The report's 50 bytes are charged against the budget.
+	ws.Write([]byte("x"))
+	clock.now = clock.now.Add(4900 * time.Millisecond)
+	ws.Write([]byte("x"))
+	assert.Equal(t, "01234567890123456789abcderate limit exceeded: dropped 2 entries (29 bytes)\n", buf.String(), "Expected the report to use up the budget.")
+	clock.now = clock.now.Add(200 * time.Millisecond)
+	ws.Write([]byte("x"))
+	assert.Equal(t, "01234567890123456789abcderate limit exceeded: dropped 2 entries (29 bytes)\nxrate limit exceeded: dropped 2 entries (2 bytes)\n", buf.String(), "Expected the budget to refill.")
+	assert.Equal(t, RateLimitStats{DroppedEntries: 4, DroppedBytes: 31}, ws.stats(), "Expected stats to count every dropped write.")
+}
+
+func TestRateLimitDropReportInterval(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ws, clock := newTestRateLimiter(AddSync(buf), nil, 100, 100, RateLimitDrop)
+
+	ws.Write(bytes.Repeat([]byte("a"), 101))
+	ws.Write([]byte("b"))
+	assert.Equal(t, "brate limit exceeded: dropped 1 entries (101 bytes)\n", buf.String(), "Unexpected output.")
+
+	// Reports are limited to one per second.
+	ws.Write(bytes.Repeat([]byte("a"), 101))
+	clock.now = clock.now.Add(100 * time.Millisecond)
+	ws.Write([]byte("c"))
+	assert.Equal(t, "brate limit exceeded: dropped 1 entries (101 bytes)\nc", buf.String(), "Expected reports to be rate-limited.")
+	clock.now = clock.now.Add(time.Second)
+	ws.Write([]byte("d"))
+	assert.Equal(t, "brate limit exceeded: dropped 1 entries (101 bytes)\ncdrate limit exceeded: dropped 1 entries (101 bytes)\n", buf.String(), "Expected a report once the interval passes.")
+}
+
+func TestRateLimitDropReportEncoding(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := NewJSONEncoder(EncoderConfig{MessageKey: "msg", LevelKey: "level", EncodeLevel: LowercaseLevelEncoder})
+	ws, _ := newTestRateLimiter(AddSync(buf), enc, 1, 1, RateLimitDrop)
+
+	ws.Write([]byte("too long"))
+	require.NoError(t, ws.Sync(), "Unexpected error syncing.")
+	assert.Equal(t, `{"level":"warn","msg":"rate limit exceeded: dropped 1 entries (8 bytes)"}`+"\n", buf.String(), "Unexpected report.")
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ws, clock := newTestRateLimiter(AddSync(buf), nil, 10, 20, RateLimitDelay)
+
+	ws.Write([]byte("0123456789"))
+	ws.Write([]byte("0123456789"))
+	assert.Equal(t, 0, len(clock.sleeps), "Expected the burst to go through without delay.")
+
+	ws.Write([]byte("01234"))
+	ws.Write([]byte("too big for the burst!"))
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, 2 * time.Second}, clock.sleeps, "Unexpected delays.")
+	assert.Equal(t, "0123456789012345678901234too big for the burst!", buf.String(), "Expected every write to go through.")
+
+	// The oversized write leaves a deficit that must be repaid first.
+	ws.Write([]byte("a"))
+	assert.Equal(t, 300*time.Millisecond, clock.sleeps[2], "Expected the deficit to be repaid.")
+}
+
+func TestRateLimitUnlimited(t *testing.T) {
+	buf := &ztest.Buffer{}
+	for _, rate := range []int{0, -1} {
+		ws, stats := RateLimit(buf, nil, rate, 0, RateLimitDelay)
+		assert.Equal(t, buf, ws, "Expected a non-positive rate not to limit output.")
+		assert.Equal(t, RateLimitStats{}, stats(), "Expected no dropped output.")
+	}
+}
+
+func TestRateLimitErrors(t *testing.T) {
+	ws, _ := RateLimit(AddSync(&ztest.FailWriter{}), nil, 10, 0, RateLimitDrop)
+	_, err := ws.Write([]byte("foo"))
+	assert.Error(t, err, "Expected write errors to propagate.")
+
+	sink := &ztest.Buffer{}
+	sink.SetError(errors.New("fail"))
+	ws, _ = RateLimit(sink, nil, 10, 0, RateLimitDrop)
+	assert.Error(t, ws.Sync(), "Expected sync errors to propagate.")
+}
@@ -21,6 +21,7 @@
 package zapcore
 
 import (
+	"context"
 	"time"
 
 	"go.uber.org/atomic"
@@ -132,3 +133,7 @@ func (s *sampler) Check(ent Entry, ce *CheckedEntry) *CheckedEntry {
 	}
 	return s.Core.Check(ent, ce)
 }
+
+func (s *sampler) SyncContext(ctx context.Context) error {
+	return syncContext(ctx, s.Core)
+}
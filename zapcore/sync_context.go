@@ -0,0 +1,68 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import "context"
+
+// A ContextSyncer is a WriteSyncer or Core whose Sync method can be cut short.
+// SyncContext should return ctx's error promptly once ctx is done, even if
+// the sync is still in progress.
+type ContextSyncer interface {
+	SyncContext(ctx context.Context) error
+}
+
+// SyncContext syncs a WriteSyncer, returning early with ctx's error if ctx
+// is done first. WriteSyncers that implement ContextSyncer handle
+// cancellation themselves; for others, Sync runs in a separate goroutine,
+// which is abandoned (but keeps running) if ctx is done first.
+func SyncContext(ctx context.Context, ws WriteSyncer) error {
+	return syncContext(ctx, ws)
+}
+
+// SyncCoreContext syncs a Core like SyncContext syncs a WriteSyncer.
+func SyncCoreContext(ctx context.Context, core Core) error {
+	return syncContext(ctx, core)
+}
+
+func syncContext(ctx context.Context, s interface {
+	Sync() error
+}) error {
+	if cs, ok := s.(ContextSyncer); ok {
+		return cs.SyncContext(ctx)
+	}
+	return runContext(ctx, s.Sync)
+}
+
+// runContext calls f and returns its result, unless ctx is done first, in
+// which case it returns ctx's error without waiting for f to finish.
+func runContext(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- f() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
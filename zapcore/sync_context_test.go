@@ -0,0 +1,99 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.uber.org/zap/internal/ztest"
+)
+
+// hungSyncer is a WriteSyncer whose Sync blocks until it's released.
+type hungSyncer struct {
+	ztest.Discarder
+	release chan struct{}
+}
+
+func (s *hungSyncer) Sync() error {
+	<-s.release
+	return nil
+}
+
+// contextSyncSpy is a WriteSyncer that records the context it's synced with.
+type contextSyncSpy struct {
+	ztest.Discarder
+	ctx context.Context
+}
+
+func (s *contextSyncSpy) SyncContext(ctx context.Context) error {
+	s.ctx = ctx
+	return errors.New("synced")
+}
+
+func TestSyncContextAbandonsHungSyncs(t *testing.T) {
+	hung := &hungSyncer{release: make(chan struct{})}
+	defer close(hung.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, SyncContext(ctx, Lock(hung)), "Expected SyncContext to give up with the context.")
+
+	// The abandoned sync still holds the lock, so this one can't start.
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	core := NewCore(NewJSONEncoder(EncoderConfig{}), Lock(hung), DebugLevel)
+	assert.Equal(t, context.DeadlineExceeded, SyncCoreContext(ctx, core), "Expected SyncCoreContext to give up with the context.")
+}
+
+func TestSyncContextWithoutContextSupport(t *testing.T) {
+	sink := &ztest.Buffer{}
+	sink.SetError(errors.New("fail"))
+	assert.EqualError(t, SyncContext(context.Background(), sink), "fail", "Expected Sync's error.")
+	assert.True(t, sink.Called(), "Expected Sync to be called.")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sink = &ztest.Buffer{}
+	assert.Equal(t, context.Canceled, SyncContext(ctx, sink), "Expected a canceled context to fail immediately.")
+	assert.False(t, sink.Called(), "Expected Sync not to be called with a canceled context.")
+}
+
+func TestSyncContextPropagates(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+
+	spies := []*contextSyncSpy{{}, {}}
+	ws := NewMultiWriteSyncer(spies[0], Lock(spies[1]))
+	core := NewTee(
+		NewSampler(NewCore(NewJSONEncoder(EncoderConfig{}), spies[0], DebugLevel), time.Second, 1, 1),
+		RegisterHooks(NewCore(NewJSONEncoder(EncoderConfig{}), ws, DebugLevel)),
+	)
+
+	assert.EqualError(t, SyncCoreContext(ctx, core), "synced; synced; synced", "Expected errors from every WriteSyncer.")
+	for _, spy := range spies {
+		assert.Equal(t, ctx, spy.ctx, "Expected the context to reach the WriteSyncer.")
+	}
+}
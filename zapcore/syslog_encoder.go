@@ -0,0 +1,683 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/internal/bufferpool"
+)
+
+const (
+	// SyslogFacilityUser is the syslog facility for user-level messages, which
+	// the syslog encoder uses unless it's configured with another.
+	SyslogFacilityUser = 1
+
+	// SyslogSDID is the SD-ID of the structured data element that holds each
+	// entry's fields. It uses the enterprise number that RFC 5612 reserves
+	// for documentation and examples.
+	SyslogSDID = "zap@32473"
+
+	_syslogNil          = "-"
+	_syslogTimeFormat   = "2006-01-02T15:04:05.000000Z07:00"
+	_maxSyslogParamName = 32
+)
+
+var _syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3,
+	"auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// A SyslogFacility names a syslog facility, either by its keyword, like
+// "local0", or by its number, from 0 to 23.
+type SyslogFacility string
+
+// UnmarshalText unmarshals text to a SyslogFacility, rejecting unknown
+// facilities.
+func (f *SyslogFacility) UnmarshalText(text []byte) error {
+	if _, ok := SyslogFacility(text).code(); !ok {
+		return fmt.Errorf("unknown syslog facility %q", text)
+	}
+	*f = SyslogFacility(text)
+	return nil
+}
+
+func (f SyslogFacility) code() (int, bool) {
+	if f == "" {
+		return SyslogFacilityUser, true
+	}
+	if code, ok := _syslogFacilities[string(f)]; ok {
+		return code, true
+	}
+	code, err := strconv.Atoi(string(f))
+	if err != nil || code < 0 || code > 23 {
+		return 0, false
+	}
+	return code, true
+}
+
+// A SyslogFormat selects the format of the syslog encoder's messages.
+type SyslogFormat string
+
+const (
+	// SyslogRFC5424 is the format defined by RFC 5424. It's the default.
+	SyslogRFC5424 SyslogFormat = "rfc5424"
+	// SyslogRFC3164 is the older BSD format described by RFC 3164, which
+	// some remote collectors still expect.
+	SyslogRFC3164 SyslogFormat = "rfc3164"
+	// SyslogRFC3164Local is the BSD format without a hostname, which is what
+	// local syslog daemons expect on sockets like /dev/log.
+	SyslogRFC3164Local SyslogFormat = "rfc3164-local"
+)
+
+// UnmarshalText unmarshals text to a SyslogFormat, rejecting unknown
+// formats.
+func (f *SyslogFormat) UnmarshalText(text []byte) error {
+	switch SyslogFormat(text) {
+	case "", SyslogRFC5424, SyslogRFC3164, SyslogRFC3164Local:
+		*f = SyslogFormat(text)
+		return nil
+	}
+	return fmt.Errorf("unknown syslog format %q", text)
+}
+
+// SyslogOptions configures the header of the messages written by the syslog
+// encoder. Each field is optional.
+type SyslogOptions struct {
+	// The facility of every message. The default is the user-level facility.
+	Facility SyslogFacility
+	// The HOSTNAME, APP-NAME, and PROCID header fields, which default to the
+	// local hostname, the program's name, and the process ID.
+	Hostname string
+	AppName  string
+	ProcID   string
+	// The message format. The default is SyslogRFC5424.
+	Format SyslogFormat
+}
+
+// SyslogSeverity maps a Level to a syslog severity, as defined in RFC 5424.
+func SyslogSeverity(l Level) int {
+	switch l {
+	case DebugLevel:
+		return 7 // debug
+	case InfoLevel:
+		return 6 // informational
+	case WarnLevel:
+		return 4 // warning
+	case ErrorLevel:
+		return 3 // error
+	case DPanicLevel, PanicLevel:
+		return 2 // critical
+	case FatalLevel:
+		return 1 // alert
+	}
+	if l < DebugLevel {
+		return 7
+	}
+	return 1
+}
+
+var _syslogPool = sync.Pool{New: func() interface{} {
+	return &syslogEncoder{}
+}}
+
+func getSyslogEncoder() *syslogEncoder {
+	return _syslogPool.Get().(*syslogEncoder)
+}
+
+func putSyslogEncoder(enc *syslogEncoder) {
+	enc.EncoderConfig = nil
+	enc.buf = nil
+	enc.prefix = ""
+	enc.key = ""
+	_syslogPool.Put(enc)
+}
+
+type syslogEncoder struct {
+	*EncoderConfig
+	header *syslogHeader
+	buf    *buffer.Buffer // SD-PARAMs, each preceded by a space
+
+	prefix string // from namespaces and nested objects, like "a.b."
+	key    string // the key for Append* calls
+}
+
+// syslogHeader holds the parts of the header that don't vary by entry.
+type syslogHeader struct {
+	facility int
+	format   SyslogFormat
+	hostname string
+	appName  string
+	procID   string
+}
+
+func newSyslogHeader(opts SyslogOptions) (*syslogHeader, error) {
+	h := &syslogHeader{
+		hostname: opts.Hostname,
+		appName:  opts.AppName,
+		procID:   opts.ProcID,
+	}
+	var ok bool
+	if h.facility, ok = opts.Facility.code(); !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", opts.Facility)
+	}
+	if err := h.format.UnmarshalText([]byte(opts.Format)); err != nil {
+		return nil, err
+	}
+	if h.hostname == "" {
+		h.hostname, _ = os.Hostname()
+	}
+	if h.appName == "" && len(os.Args) > 0 {
+		h.appName = filepath.Base(os.Args[0])
+	}
+	if h.procID == "" {
+		h.procID = strconv.Itoa(os.Getpid())
+	}
+	h.hostname = sanitizeSyslogHeader(h.hostname, 255)
+	h.appName = sanitizeSyslogHeader(h.appName, 48)
+	h.procID = sanitizeSyslogHeader(h.procID, 128)
+	return h, nil
+}
+
+// NewSyslogEncoder creates an encoder that writes each entry as an RFC 5424
+// syslog message, mapping levels to severities with SyslogSeverity. Messages
+// use the user-level facility and a header that describes the running
+// process; use NewSyslogEncoderWithOptions to change them.
+//
+// The entry's fields, caller, logger name, and stacktrace are written as
+// parameters of a single SD-ELEMENT whose SD-ID is SyslogSDID. Nested
+// objects and namespaces are flattened into dotted parameter names, and each
+// element of an array is written as a separate parameter with the array's
+// name. The message, if MessageKey isn't empty, follows the structured data.
+// Newlines and carriage returns in parameters and in the message are escaped
+// as \n and \r, so that each message stays on a single line.
+func NewSyslogEncoder(cfg EncoderConfig) Encoder {
+	enc, _ := NewSyslogEncoderWithOptions(cfg, SyslogOptions{})
+	return enc
+}
+
+// NewSyslogEncoderWithOptions is like NewSyslogEncoder, but takes the
+// facility, the header fields, and the format from the SyslogOptions. It
+// returns an error if the facility or the format is unknown. In the BSD
+// formats of RFC 3164, the entry's time is always written and the structured
+// data starts the message's content.
+func NewSyslogEncoderWithOptions(cfg EncoderConfig, opts SyslogOptions) (Encoder, error) {
+	header, err := newSyslogHeader(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogEncoder{
+		EncoderConfig: &cfg,
+		header:        header,
+		buf:           bufferpool.Get(),
+	}, nil
+}
+
+func (enc *syslogEncoder) AddArray(key string, arr ArrayMarshaler) error {
+	enc.key = key
+	return arr.MarshalLogArray(enc)
+}
+
+func (enc *syslogEncoder) AddObject(key string, obj ObjectMarshaler) error {
+	enc.key = key
+	return enc.AppendObject(obj)
+}
+
+func (enc *syslogEncoder) AddBinary(key string, val []byte) {
+	enc.AddString(key, base64.StdEncoding.EncodeToString(val))
+}
+
+func (enc *syslogEncoder) AddByteString(key string, val []byte) {
+	enc.key = key
+	enc.AppendByteString(val)
+}
+
+func (enc *syslogEncoder) AddBool(key string, val bool) {
+	enc.key = key
+	enc.AppendBool(val)
+}
+
+func (enc *syslogEncoder) AddComplex128(key string, val complex128) {
+	enc.key = key
+	enc.AppendComplex128(val)
+}
+
+func (enc *syslogEncoder) AddDuration(key string, val time.Duration) {
+	enc.key = key
+	enc.AppendDuration(val)
+}
+
+func (enc *syslogEncoder) AddFloat64(key string, val float64) {
+	enc.key = key
+	enc.AppendFloat64(val)
+}
+
+func (enc *syslogEncoder) AddInt64(key string, val int64) {
+	enc.key = key
+	enc.AppendInt64(val)
+}
+
+func (enc *syslogEncoder) AddReflected(key string, obj interface{}) error {
+	enc.key = key
+	return enc.AppendReflected(obj)
+}
+
+func (enc *syslogEncoder) OpenNamespace(key string) {
+	enc.prefix += key + "."
+}
+
+func (enc *syslogEncoder) AddString(key, val string) {
+	enc.key = key
+	enc.AppendString(val)
+}
+
+func (enc *syslogEncoder) AddTime(key string, val time.Time) {
+	enc.key = key
+	enc.AppendTime(val)
+}
+
+func (enc *syslogEncoder) AddUint64(key string, val uint64) {
+	enc.key = key
+	enc.AppendUint64(val)
+}
+
+func (enc *syslogEncoder) AppendArray(arr ArrayMarshaler) error {
+	// Nested arrays are flattened into repeated parameters.
+	return arr.MarshalLogArray(enc)
+}
+
+func (enc *syslogEncoder) AppendObject(obj ObjectMarshaler) error {
+	prefix, key := enc.prefix, enc.key
+	enc.prefix = prefix + key + "."
+	err := obj.MarshalLogObject(enc)
+	enc.prefix, enc.key = prefix, key
+	return err
+}
+
+func (enc *syslogEncoder) AppendBool(val bool) {
+	enc.beginParam()
+	enc.buf.AppendBool(val)
+	enc.endParam()
+}
+
+func (enc *syslogEncoder) AppendByteString(val []byte) {
+	enc.beginParam()
+	enc.safeAddByteString(val)
+	enc.endParam()
+}
+
+func (enc *syslogEncoder) AppendComplex128(val complex128) {
+	// Cast to a platform-independent, fixed-size type.
+	r, i := float64(real(val)), float64(imag(val))
+	enc.beginParam()
+	enc.buf.AppendFloat(r, 64)
+	enc.buf.AppendByte('+')
+	enc.buf.AppendFloat(i, 64)
+	enc.buf.AppendByte('i')
+	enc.endParam()
+}
+
+func (enc *syslogEncoder) AppendDuration(val time.Duration) {
+	cur := enc.buf.Len()
+	if enc.EncodeDuration != nil {
+		enc.EncodeDuration(val, enc)
+	}
+	if cur == enc.buf.Len() {
+		// User-supplied EncodeDuration is missing or a no-op. Fall back to
+		// nanoseconds.
+		enc.AppendInt64(int64(val))
+	}
+}
+
+func (enc *syslogEncoder) AppendInt64(val int64) {
+	enc.beginParam()
+	enc.buf.AppendInt(val)
+	enc.endParam()
+}
+
+func (enc *syslogEncoder) AppendReflected(val interface{}) error {
+	marshaled, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	enc.AppendByteString(marshaled)
+	return nil
+}
+
+func (enc *syslogEncoder) AppendString(val string) {
+	enc.beginParam()
+	enc.safeAddString(val)
+	enc.endParam()
+}
+
+func (enc *syslogEncoder) AppendTime(val time.Time) {
+	cur := enc.buf.Len()
+	if enc.EncodeTime != nil {
+		enc.EncodeTime(val, enc)
+	}
+	if cur == enc.buf.Len() {
+		// User-supplied EncodeTime is missing or a no-op. Fall back to nanos
+		// since epoch.
+		enc.AppendInt64(val.UnixNano())
+	}
+}
+
+func (enc *syslogEncoder) AppendUint64(val uint64) {
+	enc.beginParam()
+	enc.buf.AppendUint(val)
+	enc.endParam()
+}
+
+func (enc *syslogEncoder) appendFloat(val float64, bitSize int) {
+	enc.beginParam()
+	switch {
+	case math.IsNaN(val):
+		enc.buf.AppendString("NaN")
+	case math.IsInf(val, 1):
+		enc.buf.AppendString("+Inf")
+	case math.IsInf(val, -1):
+		enc.buf.AppendString("-Inf")
+	default:
+		enc.buf.AppendFloat(val, bitSize)
+	}
+	enc.endParam()
+}
+
+func (enc *syslogEncoder) AddComplex64(k string, v complex64) { enc.AddComplex128(k, complex128(v)) }
+func (enc *syslogEncoder) AddFloat32(k string, v float32)     { enc.AddFloat64(k, float64(v)) }
+func (enc *syslogEncoder) AddInt(k string, v int)             { enc.AddInt64(k, int64(v)) }
+func (enc *syslogEncoder) AddInt32(k string, v int32)         { enc.AddInt64(k, int64(v)) }
+func (enc *syslogEncoder) AddInt16(k string, v int16)         { enc.AddInt64(k, int64(v)) }
+func (enc *syslogEncoder) AddInt8(k string, v int8)           { enc.AddInt64(k, int64(v)) }
+func (enc *syslogEncoder) AddUint(k string, v uint)           { enc.AddUint64(k, uint64(v)) }
+func (enc *syslogEncoder) AddUint32(k string, v uint32)       { enc.AddUint64(k, uint64(v)) }
+func (enc *syslogEncoder) AddUint16(k string, v uint16)       { enc.AddUint64(k, uint64(v)) }
+func (enc *syslogEncoder) AddUint8(k string, v uint8)         { enc.AddUint64(k, uint64(v)) }
+func (enc *syslogEncoder) AddUintptr(k string, v uintptr)     { enc.AddUint64(k, uint64(v)) }
+func (enc *syslogEncoder) AppendComplex64(v complex64)        { enc.AppendComplex128(complex128(v)) }
+func (enc *syslogEncoder) AppendFloat64(v float64)            { enc.appendFloat(v, 64) }
+func (enc *syslogEncoder) AppendFloat32(v float32)            { enc.appendFloat(float64(v), 32) }
+func (enc *syslogEncoder) AppendInt(v int)                    { enc.AppendInt64(int64(v)) }
+func (enc *syslogEncoder) AppendInt32(v int32)                { enc.AppendInt64(int64(v)) }
+func (enc *syslogEncoder) AppendInt16(v int16)                { enc.AppendInt64(int64(v)) }
+func (enc *syslogEncoder) AppendInt8(v int8)                  { enc.AppendInt64(int64(v)) }
+func (enc *syslogEncoder) AppendUint(v uint)                  { enc.AppendUint64(uint64(v)) }
+func (enc *syslogEncoder) AppendUint32(v uint32)              { enc.AppendUint64(uint64(v)) }
+func (enc *syslogEncoder) AppendUint16(v uint16)              { enc.AppendUint64(uint64(v)) }
+func (enc *syslogEncoder) AppendUint8(v uint8)                { enc.AppendUint64(uint64(v)) }
+func (enc *syslogEncoder) AppendUintptr(v uintptr)            { enc.AppendUint64(uint64(v)) }
+
+func (enc *syslogEncoder) Clone() Encoder {
+	clone := enc.clone()
+	clone.buf.Write(enc.buf.Bytes())
+	return clone
+}
+
+func (enc *syslogEncoder) clone() *syslogEncoder {
+	clone := getSyslogEncoder()
+	clone.EncoderConfig = enc.EncoderConfig
+	clone.header = enc.header
+	clone.prefix = enc.prefix
+	clone.buf = bufferpool.Get()
+	return clone
+}
+
+func (enc *syslogEncoder) EncodeEntry(ent Entry, fields []Field) (*buffer.Buffer, error) {
+	final := enc.clone()
+	final.buf.Write(enc.buf.Bytes())
+	addFields(final, fields)
+
+	// Entry metadata goes outside any open namespaces.
+	final.prefix = ""
+	if ent.LoggerName != "" && final.NameKey != "" {
+		final.key = final.NameKey
+		cur := final.buf.Len()
+		nameEncoder := final.EncodeName
+		if nameEncoder == nil {
+			nameEncoder = FullNameEncoder
+		}
+		nameEncoder(ent.LoggerName, final)
+		if cur == final.buf.Len() {
+			final.AppendString(ent.LoggerName)
+		}
+	}
+	if ent.Caller.Defined && final.CallerKey != "" {
+		final.key = final.CallerKey
+		cur := final.buf.Len()
+		if final.EncodeCaller != nil {
+			final.EncodeCaller(ent.Caller, final)
+		}
+		if cur == final.buf.Len() {
+			final.AppendString(ent.Caller.String())
+		}
+	}
+	if ent.Stack != "" && final.StacktraceKey != "" {
+		final.AddString(final.StacktraceKey, ent.Stack)
+	}
+
+	line := bufferpool.Get()
+	line.AppendByte('<')
+	line.AppendInt(int64(final.header.facility*8 + SyslogSeverity(ent.Level)))
+	line.AppendByte('>')
+	switch final.header.format {
+	case SyslogRFC3164, SyslogRFC3164Local:
+		final.appendRFC3164Header(line, ent)
+	default:
+		final.appendRFC5424Header(line, ent)
+	}
+	if final.MessageKey != "" && ent.Message != "" {
+		line.AppendByte(' ')
+		appendSyslogMsg(line, ent.Message)
+	}
+	if final.LineEnding != "" {
+		line.AppendString(final.LineEnding)
+	} else {
+		line.AppendString(DefaultLineEnding)
+	}
+
+	final.buf.Free()
+	putSyslogEncoder(final)
+	return line, nil
+}
+
+// appendRFC5424Header writes the header and structured data of an RFC 5424
+// message, after the PRI.
+func (enc *syslogEncoder) appendRFC5424Header(line *buffer.Buffer, ent Entry) {
+	line.AppendString("1 ")
+	if enc.TimeKey != "" {
+		line.AppendString(ent.Time.Format(_syslogTimeFormat))
+	} else {
+		line.AppendString(_syslogNil)
+	}
+	line.AppendByte(' ')
+	line.AppendString(enc.header.hostname)
+	line.AppendByte(' ')
+	line.AppendString(enc.header.appName)
+	line.AppendByte(' ')
+	line.AppendString(enc.header.procID)
+	line.AppendString(" - ") // MSGID
+	if enc.buf.Len() == 0 {
+		line.AppendString(_syslogNil)
+	} else {
+		enc.appendStructuredData(line)
+	}
+}
+
+// appendRFC3164Header writes the header of a BSD message, like "Jan _2
+// 15:04:05 HOST TAG[PID]:", after the PRI, followed by any structured data.
+func (enc *syslogEncoder) appendRFC3164Header(line *buffer.Buffer, ent Entry) {
+	line.AppendString(ent.Time.Format(time.Stamp))
+	line.AppendByte(' ')
+	if enc.header.format != SyslogRFC3164Local && enc.header.hostname != _syslogNil {
+		line.AppendString(enc.header.hostname)
+		line.AppendByte(' ')
+	}
+	line.AppendString(enc.header.appName)
+	if enc.header.procID != _syslogNil {
+		line.AppendByte('[')
+		line.AppendString(enc.header.procID)
+		line.AppendByte(']')
+	}
+	line.AppendByte(':')
+	if enc.buf.Len() > 0 {
+		line.AppendByte(' ')
+		enc.appendStructuredData(line)
+	}
+}
+
+func (enc *syslogEncoder) appendStructuredData(line *buffer.Buffer) {
+	line.AppendByte('[')
+	line.AppendString(SyslogSDID)
+	line.Write(enc.buf.Bytes())
+	line.AppendByte(']')
+}
+
+// appendSyslogMsg writes the MSG part of a message, escaping line breaks.
+func appendSyslogMsg(line *buffer.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\n':
+			line.AppendString(`\n`)
+		case '\r':
+			line.AppendString(`\r`)
+		default:
+			line.AppendByte(c)
+		}
+	}
+}
+
+// beginParam starts an SD-PARAM for the current key.
+func (enc *syslogEncoder) beginParam() {
+	enc.buf.AppendByte(' ')
+	start := enc.buf.Len()
+	enc.addParamName(enc.prefix)
+	enc.addParamName(enc.key)
+	if enc.buf.Len() == start {
+		enc.buf.AppendByte('_')
+	}
+	if enc.buf.Len()-start > _maxSyslogParamName {
+		// Trim in place; all the bytes we wrote are ASCII.
+		enc.truncate(start + _maxSyslogParamName)
+	}
+	enc.buf.AppendString(`="`)
+}
+
+func (enc *syslogEncoder) endParam() {
+	enc.buf.AppendByte('"')
+}
+
+func (enc *syslogEncoder) truncate(n int) {
+	b := enc.buf.Bytes()[:n]
+	enc.buf.Reset()
+	enc.buf.Write(b)
+}
+
+// addParamName appends a PARAM-NAME, replacing the characters RFC 5424
+// forbids with underscores.
+func (enc *syslogEncoder) addParamName(s string) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		enc.buf.AppendByte(c)
+	}
+}
+
+// safeAddString escapes a PARAM-VALUE and appends it to the internal buffer.
+func (enc *syslogEncoder) safeAddString(s string) {
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			enc.addEscapedByte(b)
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			enc.buf.AppendString("\ufffd")
+			i++
+			continue
+		}
+		enc.buf.AppendString(s[i : i+size])
+		i += size
+	}
+}
+
+// safeAddByteString is no-alloc equivalent of safeAddString(string(s)) for s []byte.
+func (enc *syslogEncoder) safeAddByteString(s []byte) {
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			enc.addEscapedByte(b)
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			enc.buf.AppendString("\ufffd")
+			i++
+			continue
+		}
+		enc.buf.Write(s[i : i+size])
+		i += size
+	}
+}
+
+func (enc *syslogEncoder) addEscapedByte(b byte) {
+	switch b {
+	case '"', '\\', ']':
+		enc.buf.AppendByte('\\')
+	case '\n':
+		enc.buf.AppendString(`\n`)
+		return
+	case '\r':
+		enc.buf.AppendString(`\r`)
+		return
+	}
+	enc.buf.AppendByte(b)
+}
+
+// sanitizeSyslogHeader makes s safe for use as a header field: printable
+// US-ASCII, no longer than max bytes, and never empty.
+func sanitizeSyslogHeader(s string, max int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < max; i++ {
+		if c := s[i]; c > ' ' && c <= '~' {
+			b = append(b, c)
+		}
+	}
+	if len(b) == 0 {
+		return _syslogNil
+	}
+	return string(b)
+}
@@ -0,0 +1,311 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// _testSyslogOptions fixes the header fields that default to properties of
+// the running process.
+var _testSyslogOptions = SyslogOptions{Hostname: "host", AppName: "app", ProcID: "42"}
+
+func newTestSyslogEncoder(cfg EncoderConfig) *syslogEncoder {
+	enc, _ := NewSyslogEncoderWithOptions(cfg, _testSyslogOptions)
+	return enc.(*syslogEncoder)
+}
+
+func syslogEncoderConfig() EncoderConfig {
+	return EncoderConfig{
+		MessageKey:     "msg",
+		LevelKey:       "level",
+		TimeKey:        "ts",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		StacktraceKey:  "stacktrace",
+		EncodeLevel:    LowercaseLevelEncoder,
+		EncodeTime:     ISO8601TimeEncoder,
+		EncodeDuration: StringDurationEncoder,
+		EncodeCaller:   ShortCallerEncoder,
+	}
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	tests := []struct {
+		level    Level
+		severity int
+	}{
+		{DebugLevel - 1, 7},
+		{DebugLevel, 7},
+		{InfoLevel, 6},
+		{WarnLevel, 4},
+		{ErrorLevel, 3},
+		{DPanicLevel, 2},
+		{PanicLevel, 2},
+		{FatalLevel, 1},
+		{FatalLevel + 1, 1},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.severity, SyslogSeverity(tt.level), "Unexpected severity for %v.", tt.level)
+	}
+}
+
+func TestSyslogEncodeEntry(t *testing.T) {
+	ts := time.Date(2018, 8, 6, 15, 4, 5, 123456000, time.UTC)
+	tests := []struct {
+		desc     string
+		cfg      func(*EncoderConfig)
+		opts     *SyslogOptions
+		ent      Entry
+		fields   []Field
+		expected string
+	}{
+		{
+			desc:     "message only",
+			ent:      Entry{Level: InfoLevel, Time: ts, Message: "hello"},
+			expected: "<14>1 2018-08-06T15:04:05.123456Z host app 42 - - hello\n",
+		},
+		{
+			desc: "metadata and fields",
+			ent: Entry{
+				Level:      ErrorLevel,
+				Time:       ts,
+				LoggerName: "main.db",
+				Message:    "query failed",
+				Caller:     EntryCaller{Defined: true, File: "/src/db/query.go", Line: 42},
+				Stack:      "goroutine 1",
+			},
+			fields: []Field{
+				{Key: "table", Type: StringType, String: "users"},
+				{Key: "rows", Type: Int64Type, Integer: 3},
+			},
+			expected: `<11>1 2018-08-06T15:04:05.123456Z host app 42 - [zap@32473 table="users" rows="3" logger="main.db" caller="db/query.go:42" stacktrace="goroutine 1"] query failed` + "\n",
+		},
+		{
+			desc: "no message or time keys",
+			cfg: func(cfg *EncoderConfig) {
+				cfg.MessageKey = ""
+				cfg.TimeKey = ""
+				cfg.LineEnding = "\r\n"
+			},
+			ent:      Entry{Level: WarnLevel, Time: ts, Message: "ignored"},
+			fields:   []Field{{Key: "k", Type: BoolType, Integer: 1}},
+			expected: `<12>1 - host app 42 - [zap@32473 k="true"]` + "\r\n",
+		},
+		{
+			desc: "namespaces apply to fields, not metadata",
+			ent:  Entry{Level: DebugLevel, Time: ts, LoggerName: "svc"},
+			fields: []Field{
+				{Key: "outer", Type: NamespaceType},
+				{Key: "inner", Type: NamespaceType},
+				{Key: "k", Type: StringType, String: "v"},
+			},
+			expected: `<15>1 2018-08-06T15:04:05.123456Z host app 42 - [zap@32473 outer.inner.k="v" logger="svc"]` + "\n",
+		},
+		{
+			desc:     "line breaks are escaped",
+			ent:      Entry{Level: InfoLevel, Time: ts, Message: "two\r\nlines"},
+			fields:   []Field{{Key: "k", Type: StringType, String: "a\nb"}},
+			expected: `<14>1 2018-08-06T15:04:05.123456Z host app 42 - [zap@32473 k="a\nb"] two\r\nlines` + "\n",
+		},
+		{
+			desc:     "facility and header",
+			opts:     &SyslogOptions{Facility: "local0", Hostname: "web 1", AppName: "api", ProcID: "7"},
+			ent:      Entry{Level: InfoLevel, Time: ts, Message: "hello"},
+			expected: "<134>1 2018-08-06T15:04:05.123456Z web1 api 7 - - hello\n",
+		},
+		{
+			desc:     "RFC 3164",
+			cfg:      func(cfg *EncoderConfig) { cfg.TimeKey = "" },
+			opts:     &SyslogOptions{Facility: "3", Hostname: "host", AppName: "app", ProcID: "42", Format: SyslogRFC3164},
+			ent:      Entry{Level: InfoLevel, Time: ts, Message: "hello"},
+			fields:   []Field{{Key: "foo", Type: StringType, String: "bar"}},
+			expected: `<30>Aug  6 15:04:05 host app[42]: [zap@32473 foo="bar"] hello` + "\n",
+		},
+		{
+			desc:     "RFC 3164 for local sockets",
+			opts:     &SyslogOptions{Hostname: "host", AppName: "app", ProcID: "-", Format: SyslogRFC3164Local},
+			ent:      Entry{Level: ErrorLevel, Time: ts},
+			expected: "<11>Aug  6 15:04:05 app:\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg := syslogEncoderConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			opts := _testSyslogOptions
+			if tt.opts != nil {
+				opts = *tt.opts
+			}
+			enc, err := NewSyslogEncoderWithOptions(cfg, opts)
+			if !assert.NoError(t, err, "Unexpected error constructing a syslog encoder.") {
+				return
+			}
+			buf, err := enc.EncodeEntry(tt.ent, tt.fields)
+			if assert.NoError(t, err, "Unexpected syslog encoding error.") {
+				assert.Equal(t, tt.expected, buf.String(), "Unexpected syslog message.")
+			}
+			buf.Free()
+		})
+	}
+}
+
+func TestSyslogEncoderClone(t *testing.T) {
+	parent := newTestSyslogEncoder(syslogEncoderConfig())
+	parent.OpenNamespace("ns")
+	parent.AddString("parent", "yes")
+	clone := parent.Clone()
+	clone.AddString("child", "yes")
+
+	ent := Entry{Level: InfoLevel, Time: time.Unix(0, 0).UTC()}
+	buf, err := parent.EncodeEntry(ent, nil)
+	assert.NoError(t, err, "Unexpected error encoding entry.")
+	assert.Contains(t, buf.String(), `[zap@32473 ns.parent="yes"]`, "Expected the parent to be unaffected by its clone.")
+
+	buf, err = clone.EncodeEntry(ent, []Field{{Key: "entry", Type: StringType, String: "yes"}})
+	assert.NoError(t, err, "Unexpected error encoding entry.")
+	assert.Contains(t, buf.String(), `[zap@32473 ns.parent="yes" ns.child="yes" ns.entry="yes"]`, "Expected the clone to inherit context and namespaces.")
+}
+
+func TestSyslogEncoderFields(t *testing.T) {
+	tests := []struct {
+		desc     string
+		expected string
+		f        func(Encoder)
+	}{
+		{"binary", `k="Zm9v"`, func(e Encoder) { e.AddBinary("k", []byte("foo")) }},
+		{"byte string", `k="a\"b\\c\]d"`, func(e Encoder) { e.AddByteString("k", []byte(`a"b\c]d`)) }},
+		{"string", `k="a\"b\\c\]d"`, func(e Encoder) { e.AddString("k", `a"b\c]d`) }},
+		{"invalid UTF-8", `k="�"`, func(e Encoder) { e.AddString("k", "\xff") }},
+		{"multi-byte UTF-8", `k="☃"`, func(e Encoder) { e.AddByteString("k", []byte("☃")) }},
+		{"complex", `k="1+2i"`, func(e Encoder) { e.AddComplex64("k", 1+2i) }},
+		{"duration", `k="1s"`, func(e Encoder) { e.AddDuration("k", time.Second) }},
+		{"float NaN", `k="NaN"`, func(e Encoder) { e.AddFloat64("k", math.NaN()) }},
+		{"float +Inf", `k="+Inf"`, func(e Encoder) { e.AddFloat32("k", float32(math.Inf(1))) }},
+		{"float -Inf", `k="-Inf"`, func(e Encoder) { e.AddFloat64("k", math.Inf(-1)) }},
+		{"float", `k="1.5"`, func(e Encoder) { e.AddFloat64("k", 1.5) }},
+		{"ints", `a="-1" b="-2" c="-3" d="-4"`, func(e Encoder) {
+			e.AddInt("a", -1)
+			e.AddInt32("b", -2)
+			e.AddInt16("c", -3)
+			e.AddInt8("d", -4)
+		}},
+		{"uints", `a="1" b="2" c="3" d="4" e="5"`, func(e Encoder) {
+			e.AddUint("a", 1)
+			e.AddUint32("b", 2)
+			e.AddUint16("c", 3)
+			e.AddUint8("d", 4)
+			e.AddUintptr("e", 5)
+		}},
+		{"time", `k="1970-01-01T00:00:00.000Z"`, func(e Encoder) { e.AddTime("k", time.Unix(0, 0).UTC()) }},
+		{"reflected", `k="{\"a\":1}"`, func(e Encoder) { e.AddReflected("k", map[string]int{"a": 1}) }},
+		{"object", `k.loggable="yes"`, func(e Encoder) { e.AddObject("k", loggable{true}) }},
+		{"nested arrays and objects", `k.ducks.in="chicken" k.ducks.in="chicken"`, func(e Encoder) {
+			e.AddArray("k", ArrayMarshalerFunc(func(arr ArrayEncoder) error {
+				return arr.AppendArray(turduckens(1))
+			}))
+		}},
+		{"array", `k="true" k="false"`, func(e Encoder) {
+			e.AddArray("k", ArrayMarshalerFunc(func(arr ArrayEncoder) error {
+				arr.AppendBool(true)
+				arr.AppendBool(false)
+				return nil
+			}))
+		}},
+		{"param names are sanitized", `a_b_c_d_e="v"`, func(e Encoder) { e.AddString(`a b=c]d"e`, "v") }},
+		{"param names are truncated", `abcdefghijklmnopqrstuvwxyzabcdef="v"`, func(e Encoder) {
+			e.AddString("abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz", "v")
+		}},
+		{"empty param names", `_="v"`, func(e Encoder) { e.AddString("", "v") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			enc := newTestSyslogEncoder(syslogEncoderConfig())
+			tt.f(enc)
+			assert.Equal(t, " "+tt.expected, enc.buf.String(), "Unexpected SD-PARAMs.")
+		})
+	}
+}
+
+func TestSyslogEncoderMarshalerErrors(t *testing.T) {
+	enc := newTestSyslogEncoder(syslogEncoderConfig())
+	assert.Error(t, enc.AddObject("k", loggable{false}), "Expected object marshaling errors to propagate.")
+	assert.Error(t, enc.AddArray("k", loggable{false}), "Expected array marshaling errors to propagate.")
+	assert.Error(t, enc.AddReflected("k", noJSON{}), "Expected reflection errors to propagate.")
+
+	err := errors.New("boom")
+	buf, _ := enc.EncodeEntry(Entry{}, []Field{{Key: "error", Type: ErrorType, Interface: err}})
+	assert.Contains(t, buf.String(), `error="boom"`, "Expected errors to be encoded as parameters.")
+}
+
+func TestSyslogEncoderFallbacks(t *testing.T) {
+	enc := newTestSyslogEncoder(EncoderConfig{
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		EncodeTime:     func(time.Time, PrimitiveArrayEncoder) {},
+		EncodeDuration: func(time.Duration, PrimitiveArrayEncoder) {},
+		EncodeName:     func(string, PrimitiveArrayEncoder) {},
+	})
+	enc.AddTime("t", time.Unix(0, 1))
+	enc.AddDuration("d", 2)
+	buf, _ := enc.EncodeEntry(Entry{
+		LoggerName: "name",
+		Caller:     EntryCaller{Defined: true, File: "foo.go", Line: 1},
+	}, nil)
+	assert.Equal(t, `<14>1 - host app 42 - [zap@32473 t="1" d="2" logger="name" caller="foo.go:1"]`+"\n", buf.String(), "Expected no-op encoders to fall back to defaults.")
+}
+
+func TestSyslogEncoderUnknownOptions(t *testing.T) {
+	_, err := NewSyslogEncoderWithOptions(syslogEncoderConfig(), SyslogOptions{Facility: "24"})
+	assert.Error(t, err, "Expected an error for an unknown facility.")
+	_, err = NewSyslogEncoderWithOptions(syslogEncoderConfig(), SyslogOptions{Format: "json"})
+	assert.Error(t, err, "Expected an error for an unknown format.")
+}
+
+func TestSyslogOptionsUnmarshalText(t *testing.T) {
+	var cfg SyslogOptions
+	assert.NoError(t, cfg.Facility.UnmarshalText([]byte("local7")), "Unexpected error unmarshaling a facility name.")
+	assert.NoError(t, cfg.Facility.UnmarshalText([]byte("23")), "Unexpected error unmarshaling a facility number.")
+	assert.Equal(t, SyslogFacility("23"), cfg.Facility, "Unexpected facility.")
+	assert.Error(t, cfg.Facility.UnmarshalText([]byte("local8")), "Expected an error for an unknown facility.")
+	assert.Error(t, cfg.Facility.UnmarshalText([]byte("-1")), "Expected an error for an out-of-range facility.")
+	assert.Equal(t, SyslogFacility("23"), cfg.Facility, "Expected errors to leave the facility unchanged.")
+
+	assert.NoError(t, cfg.Format.UnmarshalText([]byte("rfc3164-local")), "Unexpected error unmarshaling a format.")
+	assert.Equal(t, SyslogRFC3164Local, cfg.Format, "Unexpected format.")
+	assert.Error(t, cfg.Format.UnmarshalText([]byte("json")), "Expected an error for an unknown format.")
+}
+
+func TestSanitizeSyslogHeader(t *testing.T) {
+	assert.Equal(t, "-", sanitizeSyslogHeader("", 10), "Expected empty values to become NILVALUE.")
+	assert.Equal(t, "-", sanitizeSyslogHeader(" \t\n", 10), "Expected unprintable values to become NILVALUE.")
+	assert.Equal(t, "myapp", sanitizeSyslogHeader("my app", 10), "Expected spaces to be removed.")
+	assert.Equal(t, "abc", sanitizeSyslogHeader("abcdef", 3), "Expected values to be truncated.")
+}
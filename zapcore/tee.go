@@ -20,7 +20,11 @@
 
 package zapcore
 
-import "go.uber.org/multierr"
+import (
+	"context"
+
+	"go.uber.org/multierr"
+)
 
 type multiCore []Core
 
@@ -79,3 +83,14 @@ func (mc multiCore) Sync() error {
 	}
 	return err
 }
+
+func (mc multiCore) SyncContext(ctx context.Context) error {
+	var err error
+	for i := range mc {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return multierr.Append(err, ctxErr)
+		}
+		err = multierr.Append(err, syncContext(ctx, mc[i]))
+	}
+	return err
+}
@@ -21,6 +21,7 @@
 package zapcore
 
 import (
+	"context"
 	"io"
 	"sync"
 
@@ -75,6 +76,16 @@ func (s *lockedWriteSyncer) Sync() error {
 	return err
 }
 
+func (s *lockedWriteSyncer) SyncContext(ctx context.Context) error {
+	// Waiting for the lock can block as long as a write to a hung
+	// destination, so the whole sync runs in the background.
+	return runContext(ctx, func() error {
+		s.Lock()
+		defer s.Unlock()
+		return syncContext(ctx, s.ws)
+	})
+}
+
 type writerWrapper struct {
 	io.Writer
 }
@@ -121,3 +132,14 @@ func (ws multiWriteSyncer) Sync() error {
 	}
 	return err
 }
+
+func (ws multiWriteSyncer) SyncContext(ctx context.Context) error {
+	var err error
+	for _, w := range ws {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return multierr.Append(err, ctxErr)
+		}
+		err = multierr.Append(err, syncContext(ctx, w))
+	}
+	return err
+}